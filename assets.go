@@ -0,0 +1,169 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The templates, resources and demo data are bundled into the binary,
+// so the installer runs from any directory.
+//
+//go:embed templates resources demoData
+var bundledAssets embed.FS
+
+// File system the installer reads its templates, resources and demo data from
+var assets fs.FS = bundledAssets
+
+// Serves the files from the override directory first and falls back
+// to the bundled ones, so a re-skin only needs the files it changes.
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.override.Open(name)
+	if err == nil {
+		return file, nil
+	}
+	return o.base.Open(name)
+}
+
+// ReadDir merges both directories, the override entries win on name clashes.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	overrideEntries, overrideErr := fs.ReadDir(o.override, name)
+	if baseErr != nil && overrideErr != nil {
+		return nil, baseErr
+	}
+
+	entries := map[string]fs.DirEntry{}
+	names := []string{}
+	for _, list := range [][]fs.DirEntry{baseEntries, overrideEntries} {
+		for _, entry := range list {
+			if _, found := entries[entry.Name()]; !found {
+				names = append(names, entry.Name())
+			}
+			entries[entry.Name()] = entry
+		}
+	}
+
+	merged := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		merged = append(merged, entries[name])
+	}
+	return merged, nil
+}
+
+// Sets up the assets (with the optional override directory) and parses the templates.
+func loadAssets(overrideDir string) error {
+	assets = bundledAssets
+	if overrideDir != "" {
+		info, err := os.Stat(overrideDir)
+		if err != nil {
+			return fmt.Errorf("can't use the assets directory: %v", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("the assets directory %s is not a directory", overrideDir)
+		}
+
+		assets = overlayFS{override: os.DirFS(overrideDir), base: bundledAssets}
+		log.Printf("Using assets from %s (falling back to the bundled ones)\n", overrideDir)
+	}
+
+	return loadTemplates()
+}
+
+// initialize the templates,
+// couldn't have used http://golang.org/pkg/html/template/#ParseGlob
+// since we have custom delimiters.
+func loadTemplates() error {
+	basePath := "templates/"
+	templates = nil
+	return fs.WalkDir(assets, strings.TrimSuffix(basePath, "/"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// don't process folders themselves
+		if entry.IsDir() {
+			return nil
+		}
+		content, err := fs.ReadFile(assets, path)
+		if err != nil {
+			return err
+		}
+		templateName := path[len(basePath):]
+		if templates == nil {
+			templates = template.New(templateName)
+			_, err = templates.Parse(string(content))
+		} else {
+			_, err = templates.New(templateName).Parse(string(content))
+		}
+		log.Printf("Processed template %s\n", templateName)
+		return err
+	})
+}
+
+// Returns the sub directory of the assets (e.g. "resources")
+func assetsDir(dir string) fs.FS {
+	sub, err := fs.Sub(assets, dir)
+	if err != nil {
+		// fs.Sub only fails on invalid paths, which are constants here
+		panic(err)
+	}
+	return sub
+}
+
+// Tools, used to copy the avatars out of the bundled demo data
+func CopyAsset(src, dst string) (err error) {
+	sfi, err := fs.Stat(assets, src)
+	if err != nil {
+		return
+	}
+	if !sfi.Mode().IsRegular() {
+		return fmt.Errorf("CopyAsset: non-regular source file %s (%q)", sfi.Name(), sfi.Mode().String())
+	}
+	dfi, err := os.Stat(dst)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+	} else if !(dfi.Mode().IsRegular()) {
+		return fmt.Errorf("CopyAsset: non-regular destination file %s (%q)", dfi.Name(), dfi.Mode().String())
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return
+	}
+	err = copyAssetContents(src, dst)
+	return
+}
+
+func copyAssetContents(src, dst string) (err error) {
+	in, err := assets.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	if _, err = io.Copy(out, in); err != nil {
+		return
+	}
+	err = out.Sync()
+	return
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Default directory the database backups are written to
+const DEFAULT_BACKUP_DIR = "./backups"
+
+// Identifies the backups of the installer (and the version of their format)
+const (
+	BACKUP_FORMAT         = "kumquat-academy-backup"
+	BACKUP_FORMAT_VERSION = 1
+)
+
+// Rows inserted per transaction when restoring
+const RESTORE_BATCH_SIZE = 500
+
+// First line of a backup: the database it was taken from and the schema of its tables.
+//
+// A backup is a gzipped file of JSON lines, this header and then one BackupRow per row,
+// in the order of the tables (every table comes after the ones it references).
+type BackupHeader struct {
+	Format   string        `json:"format"`
+	Version  int           `json:"version"`
+	Created  time.Time     `json:"created"`
+	Dialect  string        `json:"dialect"`
+	Database string        `json:"database"`
+	Tables   []BackupTable `json:"tables"`
+}
+
+// The schema of a table in the backup
+type BackupTable struct {
+	Name        string          `json:"name"`
+	Columns     []CatalogColumn `json:"columns"`
+	Indexes     []CatalogIndex  `json:"indexes"`
+	ForeignKeys []ForeignKey    `json:"foreign_keys"`
+	Rows        int64           `json:"rows"`
+}
+
+// A row in the backup (the values follow the order of the columns).
+//
+// Binary values are written as {"$bytes": base64} and times as {"$time": RFC 3339},
+// so they are restored with their type.
+type BackupRow struct {
+	Table  string        `json:"table"`
+	Values []interface{} `json:"values"`
+}
+
+// Lists the tables of the platform that exist, in the order they are created
+func existingSchemaTables(db *gorm.DB) []string {
+	tables := []string{}
+	for _, table := range schemaTables {
+		if name := table.Name(db); db.Dialect().HasTable(name) {
+			tables = append(tables, name)
+		}
+	}
+	return tables
+}
+
+// Returns the directory the backups of the installation are written to
+func backupDir(form url.Values) string {
+	if dir := form.Get("db-backup-dir"); dir != "" {
+		return dir
+	}
+	return DEFAULT_BACKUP_DIR
+}
+
+// Backs up the tables of the platform (schema and rows) before the installer changes them.
+//
+// Returns the path of the backup, or an empty path when there was nothing to back up.
+func backupDatabase(db *gorm.DB, database string, dir string, job *InstallJob) (string, error) {
+	tables := existingSchemaTables(db)
+	if len(tables) == 0 {
+		return "", nil
+	}
+
+	header := BackupHeader{
+		Format:   BACKUP_FORMAT,
+		Version:  BACKUP_FORMAT_VERSION,
+		Created:  time.Now(),
+		Dialect:  db.Dialect().GetName(),
+		Database: database,
+	}
+	for _, name := range tables {
+		table := BackupTable{Name: name}
+		var err error
+		if table.Columns, err = listColumns(db, name); err != nil {
+			return "", fmt.Errorf("can't inspect the columns of %s: %v", name, err)
+		}
+		if table.Indexes, err = listIndexes(db, name); err != nil {
+			return "", fmt.Errorf("can't inspect the indexes of %s: %v", name, err)
+		}
+		if table.ForeignKeys, err = listForeignKeys(db, name); err != nil {
+			return "", fmt.Errorf("can't inspect the foreign keys of %s: %v", name, err)
+		}
+		if err := db.Table(name).Count(&table.Rows).Error; err != nil {
+			return "", fmt.Errorf("can't count the rows of %s: %v", name, err)
+		}
+		header.Tables = append(header.Tables, table)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("can't create the backup directory: %v", err)
+	}
+
+	// The name is taken first, so a backup in the same second doesn't replace this one
+	reserved, path, err := createBackupFile(filepath.Join(dir, database), ".jsonl.gz", header.Created)
+	if err != nil {
+		return "", fmt.Errorf("can't create the backup: %v", err)
+	}
+	reserved.Close()
+	complete := false
+	defer func() {
+		if !complete {
+			os.Remove(path)
+		}
+	}()
+
+	// Written aside and renamed once complete, so a failed backup never looks like a good one
+	file, err := os.OpenFile(path+".partial", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("can't create the backup: %v", err)
+	}
+	defer os.Remove(path + ".partial")
+
+	if err := writeBackup(db, header, file); err != nil {
+		file.Close()
+		return "", fmt.Errorf("can't back up the database: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("can't back up the database: %v", err)
+	}
+	if err := os.Rename(path+".partial", path); err != nil {
+		return "", err
+	}
+	complete = true
+
+	var rows int64
+	for _, table := range header.Tables {
+		rows += table.Rows
+	}
+	job.Log("Backed up %d tables (%d rows) to %s", len(header.Tables), rows, path)
+	return path, nil
+}
+
+// Writes the header and the rows of every table
+func writeBackup(db *gorm.DB, header BackupHeader, out io.Writer) error {
+	compressed := gzip.NewWriter(out)
+	buffered := bufio.NewWriter(compressed)
+	encoder := json.NewEncoder(buffered)
+
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+	for _, table := range header.Tables {
+		if err := writeBackupRows(db, table, encoder); err != nil {
+			return fmt.Errorf("%s: %v", table.Name, err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// Writes the rows of a table
+func writeBackupRows(db *gorm.DB, table BackupTable, encoder *json.Encoder) error {
+	quote := db.Dialect().Quote
+	columns := []string{}
+	for _, column := range table.Columns {
+		columns = append(columns, quote(column.Name))
+	}
+
+	rows, err := db.DB().Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), quote(table.Name)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		row := BackupRow{Table: table.Name, Values: make([]interface{}, len(values))}
+		for i, value := range values {
+			row.Values[i] = encodeBackupValue(value)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Converts a value read from the database into one JSON keeps
+func encodeBackupValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return map[string]string{"$bytes": base64.StdEncoding.EncodeToString(v)}
+	case time.Time:
+		return map[string]string{"$time": v.Format(time.RFC3339Nano)}
+	default:
+		return v
+	}
+}
+
+// Converts a value of the backup back into one the drivers take
+func decodeBackupValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			return integer, nil
+		}
+		return v.Float64()
+	case map[string]interface{}:
+		if encoded, ok := v["$bytes"].(string); ok {
+			return base64.StdEncoding.DecodeString(encoded)
+		}
+		if encoded, ok := v["$time"].(string); ok {
+			return time.Parse(time.RFC3339Nano, encoded)
+		}
+		return nil, fmt.Errorf("unknown value %v", v)
+	default:
+		return v, nil
+	}
+}
+
+// Opens a backup, returning its header and a decoder positioned on the first row
+func openBackup(path string) (*BackupHeader, *json.Decoder, io.Closer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("%s is not a backup: %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(compressed))
+	decoder.UseNumber()
+	header := &BackupHeader{}
+	if err := decoder.Decode(header); err != nil || header.Format != BACKUP_FORMAT {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("%s is not a backup of the installer", path)
+	}
+	if header.Version > BACKUP_FORMAT_VERSION {
+		file.Close()
+		return nil, nil, nil, fmt.Errorf("%s was written by a newer installer (format %d)", path, header.Version)
+	}
+	return header, decoder, file, nil
+}
+
+// Replaces the tables of the platform with the ones in the backup.
+//
+// The tables of the platform (and the ones in the backup) are dropped, then created
+// again as they were, with their rows, indexes and foreign keys. The schema is
+// recreated with the types of the original dialect, so a backup is restored into
+// the same kind of database.
+func restoreDatabase(db *gorm.DB, path string, job *InstallJob) error {
+	header, decoder, closer, err := openBackup(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if dialect := db.Dialect().GetName(); dialect != header.Dialect {
+		return fmt.Errorf("the backup is of a %s database, it can't be restored into %s", header.Dialect, dialect)
+	}
+
+	// Children first, the foreign keys would stop the parents from going
+	dropping := []string{}
+	inBackup := map[string]bool{}
+	for i := len(header.Tables) - 1; i >= 0; i-- {
+		inBackup[header.Tables[i].Name] = true
+	}
+	existing := existingSchemaTables(db)
+	for i := len(existing) - 1; i >= 0; i-- {
+		if !inBackup[existing[i]] {
+			dropping = append(dropping, existing[i])
+		}
+	}
+	for i := len(header.Tables) - 1; i >= 0; i-- {
+		if db.Dialect().HasTable(header.Tables[i].Name) {
+			dropping = append(dropping, header.Tables[i].Name)
+		}
+	}
+	for _, name := range dropping {
+		if err := db.Exec("DROP TABLE " + db.Dialect().Quote(name)).Error; err != nil {
+			return fmt.Errorf("can't drop the table %s: %v", name, err)
+		}
+		job.Log("Dropped table %s", name)
+	}
+
+	for _, table := range header.Tables {
+		if err := db.Exec(createTableStatement(db, table)).Error; err != nil {
+			return fmt.Errorf("can't create the table %s: %v", table.Name, err)
+		}
+	}
+
+	if err := restoreBackupRows(db, header, decoder, job); err != nil {
+		return err
+	}
+
+	for _, table := range header.Tables {
+		statements, err := restoreTableStatements(db, table)
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("can't restore %s: %v", table.Name, err)
+			}
+		}
+		job.Log("Restored table %s (%d rows)", table.Name, table.Rows)
+	}
+	return nil
+}
+
+// Builds the CREATE TABLE of a table in the backup (SQLite gets its foreign keys here too)
+func createTableStatement(db *gorm.DB, table BackupTable) string {
+	dialect := db.Dialect().GetName()
+	quote := db.Dialect().Quote
+
+	definitions := []string{}
+	primaryKeys := []string{}
+	rowid := false
+	for _, column := range table.Columns {
+		definition := quote(column.Name) + " " + column.Type
+		inlineKey := false
+		if column.AutoIncrement {
+			switch dialect {
+			case "mysql":
+				definition += " AUTO_INCREMENT"
+			case "postgres":
+				serials := map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}
+				if serial, found := serials[strings.ToLower(column.Type)]; found {
+					definition = quote(column.Name) + " " + serial
+				}
+			case "sqlite3":
+				definition += " PRIMARY KEY AUTOINCREMENT"
+				rowid, inlineKey = true, true
+			}
+		}
+		if !column.Nullable && !inlineKey {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+		if column.PrimaryKey {
+			primaryKeys = append(primaryKeys, quote(column.Name))
+		}
+	}
+	if len(primaryKeys) > 0 && !rowid {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKeys, ", ")))
+	}
+	if dialect == "sqlite3" {
+		for _, key := range table.ForeignKeys {
+			definitions = append(definitions, foreignKeyClause(db, key))
+		}
+	}
+
+	statement := fmt.Sprintf("CREATE TABLE %s (%s)", quote(table.Name), strings.Join(definitions, ", "))
+	if options := tableOptions(db); options != "" {
+		statement += " " + options
+	}
+	return statement
+}
+
+// Builds the indexes and foreign keys of a table in the backup, added once its rows are in
+func restoreTableStatements(db *gorm.DB, table BackupTable) ([]string, error) {
+	quote := db.Dialect().Quote
+	statements := []string{}
+	for _, index := range table.Indexes {
+		columns := []string{}
+		for _, column := range index.Columns {
+			columns = append(columns, quote(column))
+		}
+		create := "CREATE INDEX"
+		if index.Unique {
+			create = "CREATE UNIQUE INDEX"
+		}
+
+		// SQLite reserves the names of the indexes of its UNIQUE columns
+		name := index.Name
+		if strings.HasPrefix(name, "sqlite_autoindex_") {
+			name = fmt.Sprintf("uix_%s_%s", table.Name, strings.Join(index.Columns, "_"))
+		}
+		statements = append(statements, fmt.Sprintf("%s %s ON %s (%s)", create, quote(name), quote(table.Name), strings.Join(columns, ", ")))
+	}
+
+	dialect := db.Dialect().GetName()
+	if dialect != "sqlite3" {
+		for _, key := range table.ForeignKeys {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD %s", quote(table.Name), foreignKeyClause(db, key)))
+		}
+	}
+
+	// Moves the sequences past the restored ids
+	sequences, err := sequenceResetStatements(db, table.Name, table.Columns)
+	if err != nil {
+		return nil, err
+	}
+	return append(statements, sequences...), nil
+}
+
+// Builds the constraint of a foreign key (unnamed if it had no name, like on SQLite)
+func foreignKeyClause(db *gorm.DB, key ForeignKey) string {
+	quote := db.Dialect().Quote
+	quoteAll := func(columns []string) string {
+		quoted := []string{}
+		for _, column := range columns {
+			quoted = append(quoted, quote(column))
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	clause := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", quoteAll(key.Columns), quote(key.RefTable), quoteAll(key.RefColumns))
+	if key.Name != "" {
+		clause = "CONSTRAINT " + quote(key.Name) + " " + clause
+	}
+	return clause
+}
+
+// Inserts the rows of the backup, in batches
+func restoreBackupRows(db *gorm.DB, header *BackupHeader, decoder *json.Decoder, job *InstallJob) error {
+	quote := db.Dialect().Quote
+	statements := map[string]string{}
+	for _, table := range header.Tables {
+		columns := []string{}
+		placeholders := []string{}
+		for i, column := range table.Columns {
+			columns = append(columns, quote(column.Name))
+			if db.Dialect().GetName() == "postgres" {
+				placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+			} else {
+				placeholders = append(placeholders, "?")
+			}
+		}
+		statements[table.Name] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quote(table.Name), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	}
+
+	tx, err := db.DB().Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	batch := 0
+	for {
+		if err := job.Err(); err != nil {
+			return err
+		}
+
+		var row BackupRow
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("the backup is damaged: %v", err)
+		}
+
+		statement, found := statements[row.Table]
+		if !found {
+			return fmt.Errorf("the backup has rows of %s, a table it doesn't describe", row.Table)
+		}
+		for i := range row.Values {
+			if row.Values[i], err = decodeBackupValue(row.Values[i]); err != nil {
+				return fmt.Errorf("the backup is damaged: %v", err)
+			}
+		}
+		if _, err := tx.Exec(statement, row.Values...); err != nil {
+			return fmt.Errorf("can't restore a row of %s: %v", row.Table, err)
+		}
+
+		if batch++; batch == RESTORE_BATCH_SIZE {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			if tx, err = db.DB().Begin(); err != nil {
+				return err
+			}
+			batch = 0
+		}
+	}
+
+	err = tx.Commit()
+	tx = nil
+	return err
+}
+
+// Lists the backups in the directory (oldest first)
+func listDatabaseBackups(dir string) ([]string, error) {
+	backups, err := filepath.Glob(filepath.Join(dir, "*.jsonl.gz"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backupTimestamp(backups[i]) < backupTimestamp(backups[j])
+	})
+	return backups, nil
+}
+
+// Returns the timestamp in the name of a backup
+func backupTimestamp(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".jsonl.gz")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// Prints the progress of the commands working on the database
+func printJobEvents(event InstallEvent) {
+	if event.Type == EVENT_WARNING {
+		fmt.Println("Warning: " + event.Message)
+		return
+	}
+	fmt.Println(event.Message)
+}
+
+// Backs up the tables of the platform
+func backupCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	dir := ""
+
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.StringVar(&dir, "dir", dir, "directory the backup is written to (default KUMQUAT_DB_BACKUP_DIR, or ./backups)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if dir == "" {
+		dir = backupDir(form)
+	}
+
+	job := newInstallJob()
+	job.output = printJobEvents
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	path, err := backupDatabase(db, config.Name, dir, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if path == "" {
+		fmt.Printf("The database %s has none of the tables of the platform, there is nothing to back up.\n", config.Name)
+	}
+	return 0
+}
+
+// Lists the backups of the database, or restores one of them
+func restoreCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	dir := ""
+	lockTimeout := time.Duration(0)
+
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.StringVar(&dir, "dir", dir, "directory of the backups (default KUMQUAT_DB_BACKUP_DIR, or ./backups)")
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another migrator to finish (default KUMQUAT_DB_LOCK_TIMEOUT, or 5m)")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer restore [--settings path] [--dir path] [backup]")
+		fmt.Println("Without a backup, lists the available ones. The current tables are backed up before restoring.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Listing the backups works without an installation
+	_, form, formErr := loadInstallerForm(settingsPath)
+	if dir == "" {
+		dir = DEFAULT_BACKUP_DIR
+		if formErr == nil {
+			dir = backupDir(form)
+		}
+	}
+	backups, err := listDatabaseBackups(dir)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if flags.NArg() == 0 {
+		if len(backups) == 0 {
+			fmt.Printf("There are no backups in %s\n", dir)
+			return 0
+		}
+		for _, backup := range backups {
+			header, _, closer, err := openBackup(backup)
+			if err != nil {
+				fmt.Printf("%s (%v)\n", backup, err)
+				continue
+			}
+			closer.Close()
+			fmt.Printf("%s (%s, %d tables, %s)\n", backup, header.Dialect, len(header.Tables), header.Created.Format(time.RFC3339))
+		}
+		return 0
+	}
+
+	if formErr != nil {
+		fmt.Println(formErr)
+		return 1
+	}
+
+	// Accepts the backup path, or just its timestamp
+	backupPath := flags.Arg(0)
+	for _, backup := range backups {
+		if backupTimestamp(backup) == backupPath {
+			backupPath = backup
+		}
+	}
+	_, _, closer, err := openBackup(backupPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	closer.Close()
+
+	job := newInstallJob()
+	job.output = printJobEvents
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	lock, err := lockMigrations(db, form, lockTimeout, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer lock.Release()
+
+	run := beginInstallerRun(db, "restore", true, false, "", job)
+	if run.Backup, err = backupDatabase(db, config.Name, dir, job); err != nil {
+		run.Finish(db, err, job)
+		fmt.Println(err)
+		return 1
+	}
+	err = restoreDatabase(db, backupPath, job)
+	run.Finish(db, err, job)
+	if err != nil {
+		// The tables may be half restored, the backup taken first undoes it
+		fmt.Println(err)
+		fmt.Printf("The database may be half restored, restore %s to undo it:\n  installer restore --settings %s %s\n", run.Backup, settingsPath, run.Backup)
+		return 1
+	}
+	fmt.Printf("Restored %s from %s\n", config.Name, backupPath)
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+// A backup restores the tables as they were when it was taken
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	db := openTestDatabaseFile(t)
+	migrateTestSchema(t, db)
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+
+	created := time.Date(2016, 9, 12, 12, 0, 0, 0, time.UTC)
+	for i, username := range []string{"admin", "teacher"} {
+		user := models.User{ID: uint32(i + 1), Username: username, Email: username + "@example.com", MatricNumber: fmt.Sprint(i), Active: true}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	session := models.Session{Token: "11111111-admin-laptop", UserID: 1, DeviceID: "laptop", CreatedOn: created, ExpiresIn: created.Add(time.Hour)}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := backupDatabase(db, "kumquat", t.TempDir(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes after the backup
+	if err := db.Exec("DELETE FROM sessions").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", 2).Update("username", "changed").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreDatabase(db, path, job); err != nil {
+		t.Fatal(err)
+	}
+
+	var usernames []string
+	if err := db.Model(&models.User{}).Order("id").Pluck("username", &usernames).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"admin", "teacher"}; !reflect.DeepEqual(usernames, want) {
+		t.Errorf("the users are %q after the restore, want %q", usernames, want)
+	}
+	var restored models.Session
+	if err := db.Where("token = ?", session.Token).First(&restored).Error; err != nil {
+		t.Fatalf("the session wasn't restored: %v", err)
+	}
+	if restored.DeviceID != "laptop" || !restored.ExpiresIn.Equal(session.ExpiresIn) {
+		t.Errorf("the session is %+v after the restore, want %+v", restored, session)
+	}
+	if differences, err := diffSchema(db); err != nil || len(differences) > 0 {
+		t.Errorf("the restored database differs from the schema: %+v (%v)", differences, err)
+	}
+}
+
+// Two backups in the same second are both kept
+func TestBackupDatabaseSameSecond(t *testing.T) {
+	db := openTestDatabaseFile(t, &models.User{})
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+
+	dir := t.TempDir()
+	first, err := backupDatabase(db, "kumquat", dir, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := backupDatabase(db, "kumquat", dir, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := listDatabaseBackups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{first, second}; first == second || !reflect.DeepEqual(backups, want) {
+		t.Errorf("listDatabaseBackups = %q, want %q", backups, want)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// A column as the database has it
+type CatalogColumn struct {
+	Name          string
+	Type          string // As the database reports it (see normalizeColumnType)
+	Nullable      bool
+	PrimaryKey    bool
+	AutoIncrement bool // AUTO_INCREMENT, a serial or the SQLite rowid
+}
+
+// An index as the database has it
+type CatalogIndex struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// Lists the columns of a table (in their order)
+func listColumns(db *gorm.DB, table string) ([]CatalogColumn, error) {
+	var query string
+	switch db.Dialect().GetName() {
+	case "mysql":
+		query = `SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_KEY = 'PRI', EXTRA LIKE '%auto_increment%'
+			FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+			ORDER BY ORDINAL_POSITION`
+	case "postgres":
+		query = `SELECT c.column_name,
+				CASE WHEN c.character_maximum_length IS NOT NULL
+					THEN c.data_type || '(' || c.character_maximum_length || ')' ELSE c.data_type END,
+				c.is_nullable = 'YES',
+				EXISTS (SELECT 1 FROM information_schema.table_constraints tc
+					JOIN information_schema.key_column_usage k
+						ON k.constraint_schema = tc.constraint_schema AND k.constraint_name = tc.constraint_name
+					WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+						AND tc.table_name = c.table_name AND k.column_name = c.column_name),
+				COALESCE(c.column_default LIKE 'nextval(%', false)
+			FROM information_schema.columns c
+			WHERE c.table_schema = CURRENT_SCHEMA() AND c.table_name = $1
+			ORDER BY c.ordinal_position`
+	case "sqlite3":
+		return listSQLiteColumns(db, table)
+	default:
+		return nil, fmt.Errorf("can't inspect the columns of a %s database", db.Dialect().GetName())
+	}
+
+	rows, err := db.DB().Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []CatalogColumn{}
+	for rows.Next() {
+		var column CatalogColumn
+		if err := rows.Scan(&column.Name, &column.Type, &column.Nullable, &column.PrimaryKey, &column.AutoIncrement); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// Lists the columns with PRAGMA table_info
+func listSQLiteColumns(db *gorm.DB, table string) ([]CatalogColumn, error) {
+	rows, err := db.DB().Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteSQLite(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []CatalogColumn{}
+	primaryKeys := []int{}
+	for rows.Next() {
+		var cid, primaryKey int
+		var name, columnType string
+		var notNull bool
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return nil, err
+		}
+		if primaryKey > 0 {
+			primaryKeys = append(primaryKeys, len(columns))
+		}
+		columns = append(columns, CatalogColumn{Name: name, Type: columnType, Nullable: !notNull && primaryKey == 0, PrimaryKey: primaryKey > 0})
+	}
+
+	// A single INTEGER primary key is the rowid, it increments by itself
+	if len(primaryKeys) == 1 && strings.EqualFold(columns[primaryKeys[0]].Type, "integer") {
+		columns[primaryKeys[0]].AutoIncrement = true
+	}
+	return columns, rows.Err()
+}
+
+// Lists the indexes of a table (without the primary key)
+func listIndexes(db *gorm.DB, table string) ([]CatalogIndex, error) {
+	var query string
+	switch db.Dialect().GetName() {
+	case "mysql":
+		query = `SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE = 0 FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME <> 'PRIMARY'
+			ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+	case "postgres":
+		query = `SELECT i.relname, a.attname, ix.indisunique
+			FROM pg_class t
+			JOIN pg_index ix ON ix.indrelid = t.oid
+			JOIN pg_class i ON i.oid = ix.indexrelid
+			JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)
+			WHERE t.relname = $1 AND NOT ix.indisprimary AND pg_table_is_visible(t.oid)
+			ORDER BY i.relname, array_position(ix.indkey::int2[], a.attnum)`
+	case "sqlite3":
+		return listSQLiteIndexes(db, table)
+	default:
+		return nil, fmt.Errorf("can't inspect the indexes of a %s database", db.Dialect().GetName())
+	}
+
+	rows, err := db.DB().Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := []CatalogIndex{}
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &column, &unique); err != nil {
+			return nil, err
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, CatalogIndex{Name: name, Unique: unique})
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+// Lists the indexes with the SQLite pragmas (they don't take bound parameters)
+func listSQLiteIndexes(db *gorm.DB, table string) ([]CatalogIndex, error) {
+	rows, err := db.DB().Query(fmt.Sprintf("PRAGMA index_list(%s)", quoteSQLite(table)))
+	if err != nil {
+		return nil, err
+	}
+	indexes := []CatalogIndex{}
+	for rows.Next() {
+		var seq int
+		var name, origin string
+		var unique, partial bool
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// The primary key shows up as an index too
+		if origin != "pk" {
+			indexes = append(indexes, CatalogIndex{Name: name, Unique: unique})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range indexes {
+		rows, err := db.DB().Query(fmt.Sprintf("PRAGMA index_info(%s)", quoteSQLite(indexes[i].Name)))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var seqno, cid int
+			var column string
+			if err := rows.Scan(&seqno, &cid, &column); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			indexes[i].Columns = append(indexes[i].Columns, column)
+		}
+		rows.Close()
+	}
+	return indexes, nil
+}
+
+// Lists the foreign keys of a table.
+//
+// SQLite doesn't name its foreign keys, so their Name is empty there.
+func listForeignKeys(db *gorm.DB, table string) ([]ForeignKey, error) {
+	var query string
+	switch db.Dialect().GetName() {
+	case "mysql":
+		query = `SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+			FROM information_schema.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+			ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`
+	case "postgres":
+		query = `SELECT kcu.constraint_name, kcu.column_name, ref.table_name, ref.column_name
+			FROM information_schema.key_column_usage kcu
+			JOIN information_schema.referential_constraints rc
+				ON rc.constraint_schema = kcu.constraint_schema AND rc.constraint_name = kcu.constraint_name
+			JOIN information_schema.key_column_usage ref
+				ON ref.constraint_schema = rc.unique_constraint_schema AND ref.constraint_name = rc.unique_constraint_name
+				AND ref.ordinal_position = kcu.position_in_unique_constraint
+			WHERE kcu.table_schema = CURRENT_SCHEMA() AND kcu.table_name = $1
+			ORDER BY kcu.constraint_name, kcu.ordinal_position`
+	case "sqlite3":
+		return listSQLiteForeignKeys(db, table)
+	default:
+		return nil, fmt.Errorf("can't inspect the foreign keys of a %s database", db.Dialect().GetName())
+	}
+
+	rows, err := db.DB().Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []ForeignKey{}
+	for rows.Next() {
+		var name, column, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 || keys[len(keys)-1].Name != name {
+			keys = append(keys, ForeignKey{Name: name, RefTable: refTable})
+		}
+		last := &keys[len(keys)-1]
+		last.Columns = append(last.Columns, column)
+		last.RefColumns = append(last.RefColumns, refColumn)
+	}
+	return keys, rows.Err()
+}
+
+// Lists the foreign keys with PRAGMA foreign_key_list
+func listSQLiteForeignKeys(db *gorm.DB, table string) ([]ForeignKey, error) {
+	rows, err := db.DB().Query(fmt.Sprintf("PRAGMA foreign_key_list(%s)", quoteSQLite(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]int{}
+	keys := []ForeignKey{}
+	for rows.Next() {
+		var id, seq int
+		var refTable, from string
+		var to, onUpdate, onDelete, match interface{}
+		if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, err
+		}
+		position, found := byID[id]
+		if !found {
+			position = len(keys)
+			byID[id] = position
+			keys = append(keys, ForeignKey{RefTable: refTable})
+		}
+		keys[position].Columns = append(keys[position].Columns, from)
+		keys[position].RefColumns = append(keys[position].RefColumns, fmt.Sprint(to))
+	}
+	return keys, rows.Err()
+}
+
+// Reads an index from the catalog (nil if it doesn't exist).
+//
+// The names are case insensitive, Postgres lowercases the ones it wasn't given quoted.
+func inspectIndex(db *gorm.DB, table, name string) (*CatalogIndex, error) {
+	indexes, err := listIndexes(db, table)
+	if err != nil {
+		return nil, err
+	}
+	for i := range indexes {
+		if strings.EqualFold(indexes[i].Name, name) {
+			return &indexes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Reads a foreign key from the catalog (nil if it doesn't exist).
+//
+// The names are case insensitive (like in inspectIndex), and SQLite doesn't name its
+// foreign keys, so they are matched by their columns there.
+func inspectForeignKey(db *gorm.DB, table string, key ForeignKey, name string) (*ForeignKey, error) {
+	keys, err := listForeignKeys(db, table)
+	if err != nil {
+		return nil, err
+	}
+	return findForeignKey(keys, key, name), nil
+}
+
+// Finds a foreign key by its name, or by its columns if the database doesn't name it (nil if missing)
+func findForeignKey(keys []ForeignKey, key ForeignKey, name string) *ForeignKey {
+	for i := range keys {
+		if keys[i].Name != "" && strings.EqualFold(keys[i].Name, name) || keys[i].Name == "" && sameColumns(keys[i].Columns, key.Columns) {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+// Quotes an identifier for the SQLite pragmas
+func quoteSQLite(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Compares two lists of columns (case insensitive, like MySQL)
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(strings.TrimSpace(a[i]), strings.TrimSpace(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the index in the database is the one the installer creates
+func (index *CatalogIndex) Matches(expected UniqueIndex) bool {
+	return index.Unique && sameColumns(index.Columns, expected.Columns)
+}
+
+// Checks if the key in the database is the one the installer creates
+func (key ForeignKey) Matches(expected ForeignKey) bool {
+	return strings.EqualFold(key.RefTable, expected.RefTable) &&
+		sameColumns(key.Columns, expected.Columns) &&
+		sameColumns(key.RefColumns, expected.RefColumns)
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+// The names are found whatever case the database reports them in
+func TestInspectIndexIgnoresCase(t *testing.T) {
+	db := openTestDatabase(t)
+	for _, statement := range []string{
+		"CREATE TABLE courses (id INTEGER PRIMARY KEY, title VARCHAR(255))",
+		"CREATE TABLE classes (id INTEGER PRIMARY KEY, course_id INTEGER REFERENCES courses (id), title VARCHAR(255))",
+		"CREATE UNIQUE INDEX idx_courseLevels_title ON classes (title)",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"idx_courseLevels_title", "idx_courselevels_title"} {
+		index, err := inspectIndex(db, "classes", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index == nil || !index.Unique || !sameColumns(index.Columns, []string{"title"}) {
+			t.Errorf("inspectIndex(%s) = %+v", name, index)
+		}
+	}
+	if index, _ := inspectIndex(db, "classes", "idx_classes_title"); index != nil {
+		t.Errorf("inspectIndex found another index: %+v", index)
+	}
+
+	key, err := inspectForeignKey(db, "classes", foreignKey("course_id", "courses", "id"), "fk_courseLevels_classes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil || key.RefTable != "courses" {
+		t.Errorf("inspectForeignKey = %+v", key)
+	}
+}
+
+// The named foreign keys are found whatever case the database reports their names in,
+// the unnamed ones (SQLite) by their columns
+func TestFindForeignKey(t *testing.T) {
+	keys := []ForeignKey{
+		{Name: "fk_courselevels_classes", Columns: []string{"class_id", "course_id"}, RefTable: "classes", RefColumns: []string{"id", "course_id"}},
+		{Name: "", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}},
+	}
+	tests := []struct {
+		key  ForeignKey
+		name string
+		want int // Position of the key found (-1 if missing)
+	}{
+		{ForeignKey{Columns: []string{"class_id", "course_id"}}, "fk_courseLevels_classes", 0},
+		{ForeignKey{Columns: []string{"class_id", "course_id"}}, "FK_COURSELEVELS_CLASSES", 0},
+		{ForeignKey{Columns: []string{"class_id", "course_id"}}, "fk_courseLevels_courses", -1},
+		{foreignKey("user_id", "users", "id"), "sessions_user_id_users_id_foreign", 1},
+		{foreignKey("class_id", "classes", "id"), "user_modules_class_id_classes_id_foreign", -1},
+	}
+	for _, test := range tests {
+		found := findForeignKey(keys, test.key, test.name)
+		if test.want < 0 && found != nil || test.want >= 0 && found != &keys[test.want] {
+			t.Errorf("findForeignKey(%s) = %+v, want %d", test.name, found, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Command is a tool of the installer binary, run as `installer <name> [flags]`.
+//
+// Without a command (or with `serve`) the installer starts the wizard.
+type Command struct {
+	Name        string
+	Description string
+	Run         func(args []string) int // Returns the exit code
+}
+
+var commands = []Command{
+	{"serve", "Starts the installation wizard (the default)", serveCommand},
+	{"doctor", "Checks the environment the platform is going to be installed on", doctorCommand},
+	{"restore-settings", "Lists the backups of settings.toml, or restores one", restoreSettingsCommand},
+	{"verify-schema", "Compares the database with the schema the installer creates", verifySchemaCommand},
+	{"migrate", "Migrates the database (and seeds it) without the wizard, then exits", migrateCommand},
+	{"backup", "Backs up the tables of the platform (schema and rows)", backupCommand},
+	{"restore", "Lists the backups of the database, or restores one", restoreCommand},
+	{"migrate-data", "Copies the installation to another database (e.g. from MySQL to Postgres)", migrateDataCommand},
+	{"upgrade", "Upgrades a database built from the 2015 create_tables.sql to the current schema", upgradeCommand},
+	{"status", "Shows the runs of the installer recorded in the database, and if the schema is up to date", statusCommand},
+	{"user", "Creates and manages the users of the installation (create, set-password, promote-admin, deactivate, list, import)", userCommand},
+	{"session", "Lists and revokes the sessions of the users, purges the expired ones (list, revoke, purge)", sessionCommand},
+	{"enrol", "Enrols the users into modules and courses from a CSV or XLSX file (--remove, --sync)", enrolCommand},
+	{"institution", "Plans and applies a spec of the courses, classes, levels, modules and roles (plan, apply)", institutionCommand},
+	{"sql", "Writes the schema (and the demo data) as SQL files for each database", sqlCommand},
+}
+
+// Starts the installation wizard
+func serveCommand(args []string) int {
+	config, err := parseServerConfig(args)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	// Loads the bundled templates and resources (or the re-skinned ones)
+	if err := loadAssets(config.AssetsDir); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if err := StartInstallServer(config); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// Lists the commands
+func printUsage() {
+	fmt.Println("Usage: installer [command] [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range commands {
+		fmt.Printf("  %-16s %s\n", command.Name, command.Description)
+	}
+	fmt.Println()
+	fmt.Println("Run `installer <command> -h` to see the flags of a command.")
+}
+
+// Starts the Server (or runs the command given)
+func main() {
+	args := os.Args[1:]
+
+	// The flags without a command belong to the wizard (e.g. `installer --listen :8080`)
+	if len(args) == 0 || len(args[0]) > 0 && args[0][0] == '-' {
+		os.Exit(serveCommand(args))
+	}
+
+	if args[0] == "help" {
+		printUsage()
+		return
+	}
+
+	for _, command := range commands {
+		if command.Name == args[0] {
+			os.Exit(command.Run(args[1:]))
+		}
+	}
+
+	fmt.Printf("Unknown command %q\n\n", args[0])
+	printUsage()
+	os.Exit(2)
+}
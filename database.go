@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// Backoff policies while waiting for the database
+const (
+	BACKOFF_EXPONENTIAL = "exponential"
+	BACKOFF_CONSTANT    = "constant"
+)
+
+// Longest a single connection attempt can take
+const MAX_ATTEMPT_TIMEOUT = 10 * time.Second
+
+// DatabaseWait is how long (and how often) the installer retries a database
+// that is still starting, like in docker-compose or Kubernetes.
+type DatabaseWait struct {
+	Timeout     time.Duration // 0 tries only once
+	Interval    time.Duration // Wait after the first attempt
+	MaxInterval time.Duration // Longest wait between attempts
+	Backoff     string
+}
+
+// MySQL errors that mean the server is starting, stopping or busy
+var retryableMySQLErrors = map[uint16]bool{
+	1040: true, // Too many connections
+	1053: true, // Server shutdown in progress
+	1205: true, // Lock wait timeout
+}
+
+// Reads the wait settings from the wizard values (the defaults for the ones missing)
+func databaseWaitFromForm(form url.Values) (DatabaseWait, error) {
+	wait := DatabaseWait{
+		Timeout:     60 * time.Second,
+		Interval:    time.Second,
+		MaxInterval: 10 * time.Second,
+		Backoff:     BACKOFF_EXPONENTIAL,
+	}
+
+	for field, duration := range map[string]*time.Duration{
+		"db-wait-timeout":      &wait.Timeout,
+		"db-wait-interval":     &wait.Interval,
+		"db-wait-max-interval": &wait.MaxInterval,
+	} {
+		if value := form.Get(field); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return wait, fmt.Errorf("invalid %s %q, use a duration like 30s", field, value)
+			}
+			*duration = parsed
+		}
+	}
+
+	if backoff := form.Get("db-wait-backoff"); backoff != "" {
+		if backoff != BACKOFF_EXPONENTIAL && backoff != BACKOFF_CONSTANT {
+			return wait, fmt.Errorf("invalid db-wait-backoff %q, use %s or %s", backoff, BACKOFF_EXPONENTIAL, BACKOFF_CONSTANT)
+		}
+		wait.Backoff = backoff
+	}
+	return wait, nil
+}
+
+// Returns how long to wait after the given wait
+func (wait DatabaseWait) next(interval time.Duration) time.Duration {
+	if wait.Backoff == BACKOFF_EXPONENTIAL {
+		interval *= 2
+	}
+	if wait.MaxInterval > 0 && interval > wait.MaxInterval {
+		interval = wait.MaxInterval
+	}
+	return interval
+}
+
+// Checks if the error means the database isn't up yet (instead of a wrong setting, like the password)
+func isDatabaseStarting(err error) bool {
+	var mysqlError *mysql.MySQLError
+	if errors.As(err, &mysqlError) {
+		return retryableMySQLErrors[mysqlError.Number]
+	}
+
+	// The database system is starting up, or has too many connections
+	var postgresError *pq.Error
+	if errors.As(err, &postgresError) {
+		return postgresError.Code == "57P03" || postgresError.Code == "53300"
+	}
+
+	// Connection refused, host not found yet, socket not created yet, timeouts...
+	var netError net.Error
+	var opError *net.OpError
+	var dnsError *net.DNSError
+	if errors.As(err, &opError) || errors.As(err, &dnsError) || errors.As(err, &netError) {
+		return true
+	}
+
+	return errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Pings the database until it answers, the wait runs out, or the job is canceled.
+//
+// Errors that waiting won't fix (e.g. access denied) are returned straight away.
+func waitForDatabase(db *sql.DB, wait DatabaseWait, address string, job *InstallJob) error {
+	deadline := time.Now().Add(wait.Timeout)
+	interval := wait.Interval
+
+	for attempt := 1; ; attempt++ {
+		attemptTimeout := MAX_ATTEMPT_TIMEOUT
+		if remaining := time.Until(deadline); wait.Timeout > 0 && remaining < attemptTimeout {
+			attemptTimeout = remaining
+		}
+		ctx, cancel := context.WithTimeout(job.ctx, attemptTimeout)
+		err := db.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			if attempt > 1 {
+				job.Log("The database at %s is up (after %d attempts)", address, attempt)
+			}
+			return nil
+		}
+		if jobErr := job.Err(); jobErr != nil {
+			return jobErr
+		}
+
+		if !isDatabaseStarting(err) {
+			return fmt.Errorf("can't connect to the database at %s: %v", address, err)
+		}
+		if wait.Timeout <= 0 || time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("the database at %s isn't up after %d attempts: %v", address, attempt, err)
+		}
+
+		job.Log("The database at %s isn't up yet (attempt %d, retrying in %s): %v", address, attempt, interval, err)
+		select {
+		case <-time.After(interval):
+		case <-job.ctx.Done():
+			return errJobCanceled
+		}
+		interval = wait.next(interval)
+	}
+}
+
+// Connects to the database described by the wizard values, waiting for it to start
+func openDatabase(form url.Values, job *InstallJob) (*gorm.DB, *DatabaseConfig, error) {
+	config, err := databaseConfigFromForm(form)
+	if err != nil {
+		return nil, nil, err
+	}
+	wait, err := databaseWaitFromForm(form)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dsn string
+	switch config.Dialect {
+	case "mysql":
+		if dsn, err = config.DSN(); err != nil {
+			return nil, nil, err
+		}
+	case "postgres":
+		dsn = config.PostgresDSN()
+	case "sqlite3":
+		if config.Path == "" {
+			return nil, nil, fmt.Errorf("the SQLite database has no path")
+		}
+		dsn = config.Path
+	}
+
+	// Open doesn't open a connection, the wait pings until one works
+	sqlDB, err := sql.Open(config.Dialect, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := waitForDatabase(sqlDB, wait, config.Address(), job); err != nil {
+		sqlDB.Close()
+		return nil, nil, err
+	}
+
+	db, err := gorm.Open(config.Dialect, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, nil, err
+	}
+	return db, config, nil
+}
+
+// Connects to the database described by the wizard values without waiting for it
+// (the pages of the wizard don't wait for a database that isn't there)
+func openDatabaseNow(form url.Values) (*gorm.DB, error) {
+	values := url.Values{}
+	for key := range form {
+		values.Set(key, form.Get(key))
+	}
+	values.Set("db-wait-timeout", "0")
+
+	job := newInstallJob()
+	job.output = func(event InstallEvent) {}
+	defer job.Cancel()
+
+	db, _, err := openDatabase(values, job)
+	if err != nil {
+		return nil, err
+	}
+	db.LogMode(false)
+	return db, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsDatabaseStarting(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1040, Message: "Too many connections"}, true},
+		{&mysql.MySQLError{Number: 1053, Message: "Server shutdown in progress"}, true},
+		{&mysql.MySQLError{Number: 1045, Message: "Access denied for user 'root'"}, false},
+		{&mysql.MySQLError{Number: 1049, Message: "Unknown database 'kumquat'"}, false},
+		{&pq.Error{Code: "57P03", Message: "the database system is starting up"}, true},
+		{&pq.Error{Code: "53300", Message: "sorry, too many clients already"}, true},
+		{&pq.Error{Code: "28P01", Message: "password authentication failed"}, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&net.DNSError{Err: "no such host", Name: "db"}, true},
+		{fmt.Errorf("can't ping: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true},
+		{mysql.ErrInvalidConn, true},
+		{driver.ErrBadConn, true},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{context.DeadlineExceeded, true},
+		{errors.New("unknown driver \"oracle\""), false},
+	}
+	for _, test := range tests {
+		if got := isDatabaseStarting(test.err); got != test.want {
+			t.Errorf("isDatabaseStarting(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// The waits between the attempts, from the first one
+func TestDatabaseWaitNext(t *testing.T) {
+	tests := []struct {
+		wait DatabaseWait
+		want []time.Duration
+	}{
+		{DatabaseWait{Interval: time.Second, MaxInterval: 10 * time.Second, Backoff: BACKOFF_EXPONENTIAL},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}},
+		{DatabaseWait{Interval: time.Second, Backoff: BACKOFF_EXPONENTIAL},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}},
+		{DatabaseWait{Interval: 3 * time.Second, MaxInterval: 10 * time.Second, Backoff: BACKOFF_CONSTANT},
+			[]time.Duration{3 * time.Second, 3 * time.Second, 3 * time.Second}},
+		{DatabaseWait{Interval: 30 * time.Second, MaxInterval: 10 * time.Second, Backoff: BACKOFF_CONSTANT},
+			[]time.Duration{30 * time.Second, 10 * time.Second, 10 * time.Second}},
+	}
+	for _, test := range tests {
+		got := []time.Duration{test.wait.Interval}
+		for len(got) < len(test.want) {
+			got = append(got, test.wait.next(got[len(got)-1]))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("the waits of %+v are %v, want %v", test.wait, got, test.want)
+		}
+	}
+}
+
+func TestDatabaseWaitFromForm(t *testing.T) {
+	tests := []struct {
+		form url.Values
+		want DatabaseWait
+		err  bool
+	}{
+		{url.Values{}, DatabaseWait{Timeout: time.Minute, Interval: time.Second, MaxInterval: 10 * time.Second, Backoff: BACKOFF_EXPONENTIAL}, false},
+		{url.Values{"db-wait-timeout": {"0s"}, "db-wait-interval": {"500ms"}, "db-wait-backoff": {"constant"}},
+			DatabaseWait{Timeout: 0, Interval: 500 * time.Millisecond, MaxInterval: 10 * time.Second, Backoff: BACKOFF_CONSTANT}, false},
+		{url.Values{"db-wait-timeout": {"a minute"}}, DatabaseWait{}, true},
+		{url.Values{"db-wait-interval": {"-1s"}}, DatabaseWait{}, true},
+		{url.Values{"db-wait-backoff": {"linear"}}, DatabaseWait{}, true},
+	}
+	for _, test := range tests {
+		got, err := databaseWaitFromForm(test.form)
+		if test.err {
+			if err == nil {
+				t.Errorf("databaseWaitFromForm(%v) = %+v, want an error", test.form, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("databaseWaitFromForm(%v) = %+v (%v), want %+v", test.form, got, err, test.want)
+		}
+	}
+}
+
+// The wait retries a refused connection until the timeout, unless the job is canceled
+func TestWaitForDatabase(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close() // Nothing listens there now
+
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://kumquat@%s/kumquat?sslmode=disable", address))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+	wait := DatabaseWait{Timeout: 300 * time.Millisecond, Interval: 50 * time.Millisecond, MaxInterval: 100 * time.Millisecond, Backoff: BACKOFF_EXPONENTIAL}
+	started := time.Now()
+	err = waitForDatabase(db, wait, address, job)
+	if err == nil || time.Since(started) < 100*time.Millisecond {
+		t.Errorf("the wait for a refused connection = %v after %s", err, time.Since(started))
+	}
+
+	// A canceled job stops waiting
+	job = newInstallJob()
+	job.output = func(InstallEvent) {}
+	job.cancel()
+	if err := waitForDatabase(db, DatabaseWait{Timeout: time.Minute, Interval: time.Second}, address, job); !errors.Is(err, errJobCanceled) {
+		t.Errorf("the wait of a canceled job = %v, want %v", err, errJobCanceled)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Default rows copied per INSERT
+const DEFAULT_COPY_BATCH_SIZE = 500
+
+// Most values an INSERT can bind (SQLite's limit is the lowest)
+var maxBoundValues = map[string]int{
+	"mysql":    65535,
+	"postgres": 65535,
+	"sqlite3":  999,
+}
+
+// The rows of a table copied by migrate-data
+type TableCopy struct {
+	Table  string
+	Source int64
+	Target int64
+}
+
+// Builds the statements that move the counters of a table past its ids
+// (the Postgres sequences and the MySQL AUTO_INCREMENT, SQLite moves its own)
+func sequenceResetStatements(db *gorm.DB, table string, columns []CatalogColumn) ([]string, error) {
+	quote := db.Dialect().Quote
+	statements := []string{}
+	for _, column := range columns {
+		if !column.AutoIncrement {
+			continue
+		}
+		switch db.Dialect().GetName() {
+		case "postgres":
+			statements = append(statements, fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 1)) FROM %s",
+				table, column.Name, quote(column.Name), quote(table)))
+		case "mysql":
+			var next int64
+			err := db.DB().QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) + 1 FROM %s", quote(column.Name), quote(table))).Scan(&next)
+			if err != nil {
+				return nil, fmt.Errorf("can't read the last %s of %s: %v", column.Name, table, err)
+			}
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", quote(table), next))
+		}
+	}
+	return statements, nil
+}
+
+// Checks if a column keeps booleans (tinyint(1) on MySQL)
+func isBooleanColumn(dialect string, column CatalogColumn) bool {
+	switch normalizeColumnType(dialect, column.Type) {
+	case "tinyint(1)", "boolean", "bool":
+		return true
+	}
+	return false
+}
+
+// Checks if a column keeps binary data
+func isBinaryColumn(column CatalogColumn) bool {
+	columnType := strings.ToLower(column.Type)
+	return strings.Contains(columnType, "blob") || strings.Contains(columnType, "binary") || columnType == "bytea"
+}
+
+// Converts a value read from one database into the type the column of the other one takes.
+//
+// MySQL returns the text as bytes (Postgres would store them as bytea) and the
+// booleans as numbers (Postgres wants true or false).
+func convertCopiedValue(value interface{}, dialect string, column CatalogColumn) interface{} {
+	if bytes, ok := value.([]byte); ok && !isBinaryColumn(column) {
+		value = string(bytes)
+	}
+	if !isBooleanColumn(dialect, column) {
+		return value
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return v != 0
+	case string:
+		if parsed, err := strconv.ParseBool(v); err == nil {
+			return parsed
+		}
+	}
+	return value
+}
+
+// Counts the rows of a table
+func countTableRows(db *gorm.DB, table string) (int64, error) {
+	var count int64
+	err := db.DB().QueryRow("SELECT COUNT(*) FROM " + db.Dialect().Quote(table)).Scan(&count)
+	return count, err
+}
+
+// Copies the rows of a table, batchSize rows per INSERT (or fewer, see maxBoundValues).
+//
+// Only the columns both tables have are copied (the target has the columns of the models).
+func copyTableRows(source, target *gorm.DB, table string, batchSize int, job *InstallJob) (int64, error) {
+	sourceColumns, err := listColumns(source, table)
+	if err != nil {
+		return 0, fmt.Errorf("can't inspect the columns of %s: %v", table, err)
+	}
+	targetColumns, err := listColumns(target, table)
+	if err != nil {
+		return 0, fmt.Errorf("can't inspect the columns of %s: %v", table, err)
+	}
+
+	inSource := map[string]bool{}
+	for _, column := range sourceColumns {
+		inSource[strings.ToLower(column.Name)] = true
+	}
+	columns := []CatalogColumn{}
+	for _, column := range targetColumns {
+		if inSource[strings.ToLower(column.Name)] {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+
+	selected := []string{}
+	inserted := []string{}
+	for _, column := range columns {
+		selected = append(selected, source.Dialect().Quote(column.Name))
+		inserted = append(inserted, target.Dialect().Quote(column.Name))
+	}
+	rows, err := source.DB().Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ", "), source.Dialect().Quote(table)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Fewer rows per INSERT if they would bind more values than the target takes
+	dialect := target.Dialect().GetName()
+	if limit := maxBoundValues[dialect]; limit > 0 && batchSize*len(columns) > limit {
+		batchSize = limit / len(columns)
+		if batchSize < 1 {
+			batchSize = 1
+		}
+	}
+
+	insert := func(batch [][]interface{}) error {
+		placeholders := []string{}
+		args := []interface{}{}
+		for _, row := range batch {
+			values := []string{}
+			for _, value := range row {
+				args = append(args, value)
+				if dialect == "postgres" {
+					values = append(values, fmt.Sprintf("$%d", len(args)))
+				} else {
+					values = append(values, "?")
+				}
+			}
+			placeholders = append(placeholders, "("+strings.Join(values, ", ")+")")
+		}
+
+		_, err := target.DB().Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+			target.Dialect().Quote(table), strings.Join(inserted, ", "), strings.Join(placeholders, ", ")), args...)
+		return err
+	}
+
+	var copied int64
+	batch := [][]interface{}{}
+	for rows.Next() {
+		if err := job.Err(); err != nil {
+			return copied, err
+		}
+
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return copied, err
+		}
+		for i := range values {
+			values[i] = convertCopiedValue(values[i], dialect, columns[i])
+		}
+
+		if batch = append(batch, values); len(batch) == batchSize {
+			if err := insert(batch); err != nil {
+				return copied, fmt.Errorf("can't copy the rows of %s: %v", table, err)
+			}
+			copied += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, err
+	}
+	if len(batch) > 0 {
+		if err := insert(batch); err != nil {
+			return copied, fmt.Errorf("can't copy the rows of %s: %v", table, err)
+		}
+		copied += int64(len(batch))
+	}
+
+	statements, err := sequenceResetStatements(target, table, targetColumns)
+	if err != nil {
+		return copied, err
+	}
+	for _, statement := range statements {
+		if err := target.Exec(statement).Error; err != nil {
+			return copied, fmt.Errorf("can't reset the counter of %s: %v", table, err)
+		}
+	}
+	return copied, nil
+}
+
+// Copies the tables of the platform from one database to another (of any dialect).
+//
+// The schema is created on the target first, then the tables are copied in the
+// order of the registry (every table after the ones it references) and their
+// rows counted on both sides.
+func migrateData(source, target *gorm.DB, batchSize int, truncate bool, job *InstallJob) ([]TableCopy, error) {
+	if isLegacySchema(source) {
+		return nil, fmt.Errorf("the source database has the 2015 schema, run `installer upgrade` on it first")
+	}
+
+	// The rows have to be copied into empty tables (the ids are kept)
+	existing := existingSchemaTables(target)
+	for i := len(existing) - 1; i >= 0; i-- {
+		count, err := countTableRows(target, existing[i])
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+		if !truncate {
+			return nil, fmt.Errorf("the table %s of the target has %d rows, empty it first (or use --truncate)", existing[i], count)
+		}
+		if err := target.Exec("DELETE FROM " + target.Dialect().Quote(existing[i])).Error; err != nil {
+			return nil, fmt.Errorf("can't empty the table %s of the target: %v", existing[i], err)
+		}
+		job.Log("Emptied table %s of the target (%d rows)", existing[i], count)
+	}
+
+	if err := migrateSchema(target, job); err != nil {
+		return nil, err
+	}
+
+	copies := []TableCopy{}
+	for _, table := range schemaTables {
+		name := table.Name(source)
+		if !source.Dialect().HasTable(name) {
+			job.Warn("The source has no table %s, it's left empty", name)
+			continue
+		}
+
+		started := time.Now()
+		copied, err := copyTableRows(source, target, name, batchSize, job)
+		if err != nil {
+			return nil, err
+		}
+		job.Log("Copied %d rows of %s (%s)", copied, name, time.Since(started).Round(time.Millisecond))
+		copies = append(copies, TableCopy{Table: name})
+	}
+
+	// Counts again on both sides, once everything is copied
+	mismatches := 0
+	for i := range copies {
+		var err error
+		if copies[i].Source, err = countTableRows(source, copies[i].Table); err != nil {
+			return nil, err
+		}
+		if copies[i].Target, err = countTableRows(target, copies[i].Table); err != nil {
+			return nil, err
+		}
+		if copies[i].Source != copies[i].Target {
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		return copies, fmt.Errorf("%d tables have a different number of rows on the target (was the source written to while copying?)", mismatches)
+	}
+	return copies, nil
+}
+
+// Opens the database of a settings file, for migrate-data
+func openSettingsDatabase(path string, job *InstallJob) (*gorm.DB, *DatabaseConfig, url.Values, error) {
+	form, err := loadSettingsForm(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("can't connect to the database of %s: %v", path, err)
+	}
+	db.LogMode(false)
+	return db, config, form, nil
+}
+
+// Copies an installation to another database (e.g. from MySQL to Postgres)
+func migrateDataCommand(args []string) int {
+	batchSize := DEFAULT_COPY_BATCH_SIZE
+	truncate := false
+	lockTimeout := time.Duration(0)
+
+	flags := flag.NewFlagSet("migrate-data", flag.ContinueOnError)
+	flags.IntVar(&batchSize, "batch-size", batchSize, "rows copied per INSERT")
+	flags.BoolVar(&truncate, "truncate", truncate, "empty the tables of the target if they have rows")
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another migrator on the target (default 5m)")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer migrate-data [flags] <source settings.toml> <target settings.toml>")
+		fmt.Println("Creates the schema on the target and copies every table of the platform into it.")
+		fmt.Println("The database type of each file (MySQL, Postgres or SQLite) picks the driver, the KUMQUAT_* variables don't apply.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 || batchSize < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	job := newInstallJob()
+	job.output = printJobEvents
+
+	source, sourceConfig, _, err := openSettingsDatabase(flags.Arg(0), job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer source.Close()
+
+	target, targetConfig, targetForm, err := openSettingsDatabase(flags.Arg(1), job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer target.Close()
+
+	fmt.Printf("Copying %s %s into %s %s\n", sourceConfig.Dialect, sourceConfig.Address(), targetConfig.Dialect, targetConfig.Address())
+
+	lock, err := lockMigrations(target, targetForm, lockTimeout, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer lock.Release()
+
+	run := beginInstallerRun(target, "migrate-data", true, false, "", job)
+
+	// The rows of the target go, so they are backed up first
+	if truncate {
+		if run.Backup, err = backupDatabase(target, targetConfig.Name, backupDir(targetForm), job); err != nil {
+			run.Finish(target, err, job)
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	copies, err := migrateData(source, target, batchSize, truncate, job)
+	run.Finish(target, err, job)
+
+	// The counts (only there once everything was copied)
+	if len(copies) > 0 {
+		fmt.Println()
+		fmt.Printf("%-24s %10s %10s\n", "Table", "Source", "Target")
+	}
+	for _, copy := range copies {
+		mark := ""
+		if copy.Source != copy.Target {
+			mark = "  <- differs"
+		}
+		fmt.Printf("%-24s %10d %10d%s\n", copy.Table, copy.Source, copy.Target, mark)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+// Copies between two SQLite databases, more rows than SQLite binds in one INSERT
+func TestMigrateDataSQLite(t *testing.T) {
+	source := openTestDatabaseFile(t)
+	migrateTestSchema(t, source)
+	target := openTestDatabaseFile(t)
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+
+	// 3000 users of 12 columns, more than an INSERT of 5000 rows can bind
+	err := source.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 3000)
+		INSERT INTO users (id, username, email, matric_number) SELECT i, 'user' || i, 'user' || i || '@example.com', i FROM n`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2016, 9, 12, 12, 0, 0, 0, time.UTC)
+	session := models.Session{Token: "11111111-user1-laptop", UserID: 1, DeviceID: "laptop", CreatedOn: created, ExpiresIn: created.Add(time.Hour)}
+	if err := source.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	copies, err := migrateData(source, target, 5000, false, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int64{}
+	for _, copy := range copies {
+		counts[copy.Table] = copy.Target
+	}
+	if counts["users"] != 3000 || counts["sessions"] != 1 {
+		t.Errorf("copied %d users and %d sessions, want 3000 and 1", counts["users"], counts["sessions"])
+	}
+
+	var copied models.Session
+	if err := target.Where("token = ?", session.Token).First(&copied).Error; err != nil {
+		t.Fatalf("the session wasn't copied: %v", err)
+	}
+	if copied.DeviceID != "laptop" || !copied.ExpiresIn.Equal(session.ExpiresIn) {
+		t.Errorf("the session is %+v on the target, want %+v", copied, session)
+	}
+
+	// The ids go on after the copied ones
+	user := models.User{Username: "new", Email: "new@example.com", MatricNumber: "new"}
+	if err := target.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 3001 {
+		t.Errorf("a new user on the target has the id %d, want 3001", user.ID)
+	}
+
+	// The target has rows now
+	if _, err := migrateData(source, target, DEFAULT_COPY_BATCH_SIZE, false, job); err == nil || !strings.Contains(err.Error(), "--truncate") {
+		t.Errorf("copying into a target with rows = %v", err)
+	}
+	if _, err := migrateData(source, target, DEFAULT_COPY_BATCH_SIZE, true, job); err != nil {
+		t.Errorf("copying with --truncate failed: %v", err)
+	}
+}
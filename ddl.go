@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Dialects the installer renders SQL for
+var sqlDialects = []string{"mysql", "postgres", "sqlite3"}
+
+// Default directory the SQL files are written to
+const DEFAULT_SQL_DIR = "./sql"
+
+// Day the demo data of the SQL files is relative to (so they are the same on every run)
+var demoSQLDate = time.Date(2016, 9, 12, 0, 0, 0, 0, time.FixedZone("GMT", 0))
+
+// First line of the generated files
+const SQL_HEADER = "-- Generated by `installer sql` from the models of the platform, don't edit it by hand.\n"
+
+// Opens gorm with the dialect, without a server (only to render SQL).
+//
+// The dialect only decides the SQL, the connection is an in-memory SQLite.
+func offlineDatabase(dialect string) (*gorm.DB, error) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialect, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	db.LogMode(false)
+	return db, nil
+}
+
+// Returns the options added to the tables (only MySQL has them)
+func tableOptions(db *gorm.DB) string {
+	if db.Dialect().GetName() == "mysql" {
+		return "ENGINE=InnoDB"
+	}
+	return ""
+}
+
+// Renders the CREATE TABLE statements (with the indexes and foreign keys), like migrateSchema creates them
+func renderSchemaSQL(db *gorm.DB) string {
+	var out bytes.Buffer
+	out.WriteString(SQL_HEADER)
+
+	foreignKeys := []string{}
+	for _, table := range schemaTables {
+		scope := db.NewScope(table.Model)
+		tableName := scope.TableName()
+
+		statement, keys := renderCreateTable(db, table)
+		fmt.Fprintf(&out, "\n-- %s\n", tableName)
+		out.WriteString(statement)
+		for _, key := range keys {
+			foreignKeys = append(foreignKeys, fmt.Sprintf("ALTER TABLE %s ADD %s;", scope.Quote(tableName), key))
+		}
+
+		for _, index := range expectedTableSchema(db, table).Indexes {
+			if index.Name == "" {
+				continue // Unique columns, created with the table
+			}
+			create := "CREATE INDEX"
+			if index.Unique {
+				create = "CREATE UNIQUE INDEX"
+			}
+			quoted := []string{}
+			for _, column := range index.Columns {
+				quoted = append(quoted, scope.Quote(column))
+			}
+			fmt.Fprintf(&out, "%s %s ON %s (%s);\n", create, scope.Quote(index.Name), scope.Quote(tableName), strings.Join(quoted, ", "))
+		}
+	}
+
+	if len(foreignKeys) > 0 {
+		out.WriteString("\n-- Foreign keys\n")
+		out.WriteString(strings.Join(foreignKeys, "\n"))
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// Renders the CREATE TABLE statement of a table, returning the foreign keys to add after
+// every table is created (SQLite only creates them with the table, so they are in it there)
+func renderCreateTable(db *gorm.DB, table SchemaTable) (string, []string) {
+	scope := db.NewScope(table.Model)
+	tableName := scope.TableName()
+
+	columns := []string{}
+	primaryKeys := []string{}
+	primaryKeyInColumn := false
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal || field.IsIgnored {
+			continue
+		}
+		definition := scope.Dialect().DataTypeOf(field)
+		if strings.Contains(strings.ToLower(definition), "primary key") {
+			primaryKeyInColumn = true
+		}
+		columns = append(columns, "  "+scope.Quote(field.DBName)+" "+definition)
+		if field.IsPrimaryKey {
+			primaryKeys = append(primaryKeys, scope.Quote(field.DBName))
+		}
+	}
+	if len(primaryKeys) > 0 && !primaryKeyInColumn {
+		columns = append(columns, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(primaryKeys, ", ")))
+	}
+
+	keys := []string{}
+	for _, key := range table.ForeignKeys {
+		keys = append(keys, renderForeignKey(scope, tableName, key))
+	}
+	if db.Dialect().GetName() == "sqlite3" {
+		for _, key := range keys {
+			columns = append(columns, "  "+key)
+		}
+		keys = nil
+	}
+
+	options := tableOptions(db)
+	if options != "" {
+		options = " " + options
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)%s;\n", scope.Quote(tableName), strings.Join(columns, ",\n"), options), keys
+}
+
+// Renders a foreign key constraint (gorm's keys are RESTRICT on delete and update)
+func renderForeignKey(scope *gorm.Scope, tableName string, key ForeignKey) string {
+	quote := func(columns []string) string {
+		quoted := []string{}
+		for _, column := range columns {
+			quoted = append(quoted, scope.Quote(column))
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	constraint := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		scope.Quote(key.KeyName(scope.DB(), tableName)), quote(key.Columns), scope.Quote(key.RefTable), quote(key.RefColumns))
+	if key.Name == "" {
+		constraint += " ON DELETE RESTRICT ON UPDATE RESTRICT"
+	}
+	return constraint
+}
+
+// Renders a record as an INSERT that does nothing if the record exists already
+func insertStatement(db *gorm.DB, record interface{}) string {
+	scope := db.NewScope(record)
+	dialect := db.Dialect().GetName()
+
+	columns := []string{}
+	values := []string{}
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || field.IsPrimaryKey && field.IsBlank {
+			continue
+		}
+		columns = append(columns, scope.Quote(field.DBName))
+		values = append(values, sqlLiteral(dialect, field.Field.Interface()))
+	}
+
+	statement := fmt.Sprintf("INTO %s (%s) VALUES (%s)", scope.QuotedTableName(), strings.Join(columns, ", "), strings.Join(values, ", "))
+	switch dialect {
+	case "mysql":
+		return "INSERT IGNORE " + statement + ";"
+	case "postgres":
+		return "INSERT " + statement + " ON CONFLICT DO NOTHING;"
+	default:
+		return "INSERT OR IGNORE " + statement + ";"
+	}
+}
+
+// Renders a value as a SQL literal of the dialect
+func sqlLiteral(dialect string, value interface{}) string {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.Ptr && reflected.IsNil() {
+			return "NULL"
+		}
+		var err error
+		if value, err = valuer.Value(); err != nil {
+			return "NULL"
+		}
+	}
+
+	reflected := reflect.ValueOf(value)
+	for reflected.Kind() == reflect.Ptr {
+		if reflected.IsNil() {
+			return "NULL"
+		}
+		reflected = reflected.Elem()
+		value = reflected.Interface()
+	}
+	if value == nil {
+		return "NULL"
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		if dialect == "postgres" {
+			return "'" + v.UTC().Format("2006-01-02 15:04:05") + "+00'"
+		}
+		return "'" + v.UTC().Format("2006-01-02 15:04:05") + "'"
+	case bool:
+		if dialect == "postgres" {
+			if v {
+				return "TRUE"
+			}
+			return "FALSE"
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	case []byte:
+		if dialect == "postgres" {
+			return "decode('" + hex.EncodeToString(v) + "', 'hex')"
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return quoteSQLString(dialect, v)
+	}
+
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(value)
+	case reflect.String:
+		return quoteSQLString(dialect, reflected.String())
+	}
+	return quoteSQLString(dialect, fmt.Sprint(value))
+}
+
+// Quotes a string (MySQL also treats the backslashes as escapes)
+func quoteSQLString(dialect, value string) string {
+	if dialect == "mysql" {
+		value = strings.Replace(value, `\`, `\\`, -1)
+	}
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// Renders the statements that move the Postgres sequences past the inserted ids
+func renderSequenceResets(db *gorm.DB) string {
+	if db.Dialect().GetName() != "postgres" {
+		return ""
+	}
+
+	var out bytes.Buffer
+	for _, table := range schemaTables {
+		scope := db.NewScope(table.Model)
+		primaryKeys := scope.GetModelStruct().PrimaryFields
+		// Only the tables with an id of their own have a sequence
+		if len(primaryKeys) != 1 {
+			continue
+		}
+		field := primaryKeys[0]
+		if strings.Contains(strings.ToLower(scope.Dialect().DataTypeOf(field)), "serial") {
+			fmt.Fprintf(&out, "SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 1)) FROM %s;\n",
+				scope.TableName(), field.DBName, scope.Quote(field.DBName), scope.QuotedTableName())
+		}
+	}
+	return out.String()
+}
+
+// Renders the demo data as INSERT statements
+func renderDemoDataSQL(db *gorm.DB) (string, error) {
+	var out bytes.Buffer
+	out.WriteString(SQL_HEADER)
+	out.WriteString("-- Apply the create_tables.sql of this directory first, the records that exist already are skipped.\n")
+	fmt.Fprintf(&out, "-- The dates are relative to %s.\n\n", demoSQLDate.Format("2006-01-02"))
+
+	job := newInstallJob()
+	job.output = func(event InstallEvent) {}
+	defer job.Cancel()
+
+	seeder := newSeeder(db, job)
+	seeder.output = &out
+	seeder.now = demoSQLDate
+	if err := insertDemoData(seeder); err != nil {
+		return "", err
+	}
+
+	if resets := renderSequenceResets(db); resets != "" {
+		out.WriteString("-- Moves the sequences past the inserted ids\n")
+		out.WriteString(resets)
+	}
+	return out.String(), nil
+}
+
+// Renders the SQL files of a dialect (file name => content)
+func renderSQLFiles(dialect string, demo bool) (map[string]string, error) {
+	db, err := offlineDatabase(dialect)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	files := map[string]string{
+		filepath.Join(dialect, "create_tables.sql"): renderSchemaSQL(db),
+	}
+	if demo {
+		content, err := renderDemoDataSQL(db)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.Join(dialect, "demo_data.sql")] = content
+	}
+	return files, nil
+}
+
+// Writes the schema (and the demo data) as SQL for each dialect, or checks that the files are up to date
+func sqlCommand(args []string) int {
+	outputDir := DEFAULT_SQL_DIR
+	dialect := "all"
+	demo := true
+	check := false
+
+	flags := flag.NewFlagSet("sql", flag.ContinueOnError)
+	flags.StringVar(&outputDir, "out", outputDir, "directory the files are written to (one directory per dialect)")
+	flags.StringVar(&dialect, "dialect", dialect, "mysql, postgres, sqlite3 or all")
+	flags.BoolVar(&demo, "demo", demo, "also write the demo data")
+	flags.BoolVar(&check, "check", check, "don't write, exit with 1 if the files differ from the models (for CI)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	dialects := sqlDialects
+	if dialect != "all" {
+		dialects = []string{dialect}
+	}
+
+	drifted := 0
+	for _, name := range dialects {
+		files, err := renderSQLFiles(name, demo)
+		if err != nil {
+			fmt.Printf("Can't render the %s SQL: %v\n", name, err)
+			return 1
+		}
+
+		for file, content := range files {
+			path := filepath.Join(outputDir, file)
+			if check {
+				existing, err := ioutil.ReadFile(path)
+				if err != nil || string(existing) != content {
+					fmt.Printf("%s is out of date, run `installer sql` to regenerate it\n", path)
+					drifted++
+				}
+				continue
+			}
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			fmt.Printf("Wrote %s\n", path)
+		}
+	}
+
+	if drifted > 0 {
+		return 1
+	}
+	if check {
+		fmt.Println("The SQL files are up to date")
+	}
+	return 0
+}
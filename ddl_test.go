@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The committed SQL files match the models (run `installer sql` when this fails)
+func TestSQLFilesUpToDate(t *testing.T) {
+	for _, dialect := range sqlDialects {
+		files, err := renderSQLFiles(dialect, true)
+		if err != nil {
+			t.Fatalf("can't render the %s SQL: %v", dialect, err)
+		}
+		for file, content := range files {
+			path := filepath.Join(DEFAULT_SQL_DIR, file)
+			existing, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Errorf("can't read %s: %v", path, err)
+				continue
+			}
+			if string(existing) != content {
+				t.Errorf("%s is out of date, run `installer sql` to regenerate it", path)
+			}
+		}
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	date := time.Date(2016, 9, 12, 10, 30, 0, 0, time.FixedZone("BST", 3600))
+	var missing *string
+	name := "O'Neill"
+	tests := []struct {
+		dialect string
+		value   interface{}
+		want    string
+	}{
+		{"mysql", "O'Neill", "'O''Neill'"},
+		{"mysql", `C:\path`, `'C:\\path'`},
+		{"postgres", `C:\path`, `'C:\path'`},
+		{"sqlite3", &name, "'O''Neill'"},
+		{"sqlite3", missing, "NULL"},
+		{"sqlite3", nil, "NULL"},
+		{"mysql", true, "1"},
+		{"postgres", false, "FALSE"},
+		{"mysql", uint(42), "42"},
+		{"sqlite3", 1.5, "1.5"},
+		{"mysql", date, "'2016-09-12 09:30:00'"},
+		{"postgres", date, "'2016-09-12 09:30:00+00'"},
+		{"mysql", []byte{0xca, 0xfe}, "X'cafe'"},
+		{"postgres", []byte{0xca, 0xfe}, "decode('cafe', 'hex')"},
+		{"sqlite3", sql.NullString{}, "NULL"},
+		{"sqlite3", sql.NullString{String: "x", Valid: true}, "'x'"},
+	}
+	for _, test := range tests {
+		if got := sqlLiteral(test.dialect, test.value); got != test.want {
+			t.Errorf("sqlLiteral(%s, %#v) = %s, want %s", test.dialect, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// File written by settings.Save()
+const SETTINGS_FILE = "./settings.toml"
+
+// Free space needed to install (and to warn about)
+const (
+	MIN_FREE_SPACE  = 50 << 20  // 50 MB
+	WARN_FREE_SPACE = 500 << 20 // 500 MB
+)
+
+// Results of the environment checks
+const (
+	CHECK_PASS = "pass"
+	CHECK_WARN = "warning"
+	CHECK_FAIL = "fail"
+)
+
+// EnvironmentCheck is the result of a pre-flight check, with a hint on how to fix it.
+type EnvironmentCheck struct {
+	Name    string
+	Status  string
+	Message string
+	Hint    string
+}
+
+// What the environment checks look at
+type DoctorOptions struct {
+	SettingsPath    string
+	PrivateKey      string
+	PublicKey       string
+	UploadsPath     string
+	ServerPort      int
+	InstallerListen string
+}
+
+// Returns the options for the values entered in the wizard
+func doctorOptionsFromForm(form url.Values, installerListen string) DoctorOptions {
+	serverPort, _ := strconv.Atoi(form.Get("server-port"))
+	return DoctorOptions{
+		SettingsPath:    SETTINGS_FILE,
+		PrivateKey:      form.Get("private-key"),
+		PublicKey:       form.Get("public-key"),
+		UploadsPath:     form.Get("uploads-path"),
+		ServerPort:      serverPort,
+		InstallerListen: installerListen,
+	}
+}
+
+// Checks if any of the checks failed
+func checksFailed(checks []EnvironmentCheck) bool {
+	for _, check := range checks {
+		if check.Status == CHECK_FAIL {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs every environment check
+func runEnvironmentChecks(options DoctorOptions) []EnvironmentCheck {
+	// The uploads path is a directory, so it checks a file inside it
+	uploadFile := ""
+	if options.UploadsPath != "" {
+		uploadFile = filepath.Join(options.UploadsPath, "upload")
+	}
+
+	checks := []EnvironmentCheck{
+		checkTemplates(),
+		checkResources(),
+		checkWritable("Settings directory", options.SettingsPath),
+		checkWritable("Private key directory", options.PrivateKey),
+		checkWritable("Public key directory", options.PublicKey),
+		checkWritable("Uploads directory", uploadFile),
+		checkDiskSpace(options.UploadsPath),
+		checkServerPort(options.ServerPort, options.InstallerListen),
+		checkExistingSettings(options.SettingsPath),
+		checkExistingKeys(options.PrivateKey, options.PublicKey),
+	}
+	return checks
+}
+
+// Checks that every template used by the wizard is loaded
+func checkTemplates() EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Templates"}
+
+	required := []string{"header", "wizardStart", "wizardEnd", "installProgressPage", "installFinishPage", "installedPage"}
+	for _, step := range wizardSteps {
+		required = append(required, "step-"+step.ID)
+	}
+
+	for _, name := range required {
+		if templates == nil || templates.Lookup(name) == nil {
+			check.Status = CHECK_FAIL
+			check.Message = fmt.Sprintf("The template %q is missing.", name)
+			check.Hint = "Make sure the assets directory (if any) defines every template, or remove it to use the bundled ones."
+			return check
+		}
+	}
+
+	check.Status = CHECK_PASS
+	check.Message = fmt.Sprintf("%d templates loaded.", len(required))
+	return check
+}
+
+// Checks that the stylesheets and the favicon can be served
+func checkResources() EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Resources"}
+
+	for _, name := range []string{"resources/normalize.css", "resources/skeleton.css", "resources/favicon.png"} {
+		if _, err := fs.Stat(assets, name); err != nil {
+			check.Status = CHECK_FAIL
+			check.Message = fmt.Sprintf("The resource %s can't be loaded: %v", name, err)
+			check.Hint = "Make sure the assets directory (if any) is readable, or remove it to use the bundled ones."
+			return check
+		}
+	}
+
+	check.Status = CHECK_PASS
+	check.Message = "Stylesheets and icons loaded."
+	return check
+}
+
+// Checks that the file can be created (its directory, or the closest existing parent, is writable)
+func checkWritable(name, path string) EnvironmentCheck {
+	check := EnvironmentCheck{Name: name}
+	if path == "" {
+		check.Status = CHECK_WARN
+		check.Message = "No path set yet."
+		check.Hint = "It will be checked again once the path is entered."
+		return check
+	}
+
+	// Goes up until a directory that exists (the installer creates the rest)
+	dir := filepath.Dir(path)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				check.Status = CHECK_FAIL
+				check.Message = fmt.Sprintf("%s is not a directory.", dir)
+				check.Hint = "Choose a path inside a directory."
+				return check
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	file, err := ioutil.TempFile(dir, ".kumquat-installer-")
+	if err != nil {
+		check.Status = CHECK_FAIL
+		check.Message = fmt.Sprintf("%s is not writable: %v", dir, err)
+		check.Hint = fmt.Sprintf("Give the user running the installer write access to %s, or choose another path.", dir)
+		return check
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	check.Status = CHECK_PASS
+	check.Message = fmt.Sprintf("%s is writable.", dir)
+	return check
+}
+
+// Checks that there is room for the uploads
+func checkDiskSpace(path string) EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Free disk space"}
+	if path == "" {
+		check.Status = CHECK_WARN
+		check.Message = "No uploads path set yet."
+		check.Hint = "It will be checked again once the path is entered."
+		return check
+	}
+
+	// Measures the closest directory that exists
+	dir, _ := filepath.Abs(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("The free space can't be checked: %v", err)
+		check.Hint = "Make sure there is enough space for the uploaded files."
+		return check
+	}
+
+	check.Message = fmt.Sprintf("%d MB free in %s.", free>>20, dir)
+	switch {
+	case free < MIN_FREE_SPACE:
+		check.Status = CHECK_FAIL
+		check.Hint = fmt.Sprintf("At least %d MB are needed, free some space or choose another uploads path.", MIN_FREE_SPACE>>20)
+	case free < WARN_FREE_SPACE:
+		check.Status = CHECK_WARN
+		check.Hint = "The uploaded files will fill this soon, consider a bigger disk."
+	default:
+		check.Status = CHECK_PASS
+	}
+	return check
+}
+
+// Checks that the API port is free and isn't the one the installer uses
+// (a busy port only warns, it is the API itself when the platform is running already)
+func checkServerPort(port int, installerListen string) EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Server port"}
+	if port <= 0 {
+		check.Status = CHECK_WARN
+		check.Message = "No server port set yet."
+		check.Hint = "It will be checked again once the port is entered."
+		return check
+	}
+
+	if _, installerPort, err := net.SplitHostPort(installerListen); err == nil && installerPort == strconv.Itoa(port) {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("The port %d is the one the installer is using.", port)
+		check.Hint = "Stop the installer before starting the API, or choose another port."
+		return check
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("The port %d is not available: %v", port, err)
+		check.Hint = "Fine if the API is running already, otherwise stop whatever is using the port, or choose another one."
+		return check
+	}
+	listener.Close()
+
+	check.Status = CHECK_PASS
+	check.Message = fmt.Sprintf("The port %d is free.", port)
+	return check
+}
+
+// Warns when the installation is going to replace the settings
+func checkExistingSettings(path string) EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Existing settings"}
+	if _, err := os.Stat(path); err == nil {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("%s already exists.", path)
+		check.Hint = "The platform seems installed already, the installation will back it up and update it."
+		return check
+	}
+
+	check.Status = CHECK_PASS
+	check.Message = "No previous settings found."
+	return check
+}
+
+// Warns when there are keys already (they are kept)
+func checkExistingKeys(privateKey, publicKey string) EnvironmentCheck {
+	check := EnvironmentCheck{Name: "Existing keys"}
+
+	found := []string{}
+	for _, path := range []string{privateKey, publicKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+
+	if len(found) > 0 {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("Found existing keys: %v", found)
+		check.Hint = "Existing keys are kept, delete them first to generate new ones (that logs everyone out)."
+		return check
+	}
+
+	check.Status = CHECK_PASS
+	check.Message = "No previous keys found."
+	return check
+}
+
+// Runs the environment checks from the command line (exits with 1 if any fails)
+func doctorCommand(args []string) int {
+	options := DoctorOptions{
+		SettingsPath:    SETTINGS_FILE,
+		InstallerListen: DEFAULT_LISTEN,
+	}
+	assetsDir := os.Getenv("KUMQUAT_INSTALLER_ASSETS")
+
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.StringVar(&options.SettingsPath, "settings", options.SettingsPath, "settings file the installation writes")
+	flags.StringVar(&options.PrivateKey, "private-key", "", "private key path (defaults to the one of the settings)")
+	flags.StringVar(&options.PublicKey, "public-key", "", "public key path (defaults to the one of the settings)")
+	flags.StringVar(&options.UploadsPath, "uploads-path", "", "uploads directory (defaults to the one of the settings)")
+	flags.IntVar(&options.ServerPort, "server-port", 0, "port the API is going to use (defaults to the one of the settings)")
+	flags.StringVar(&options.InstallerListen, "listen", options.InstallerListen, "address the installer listens on")
+	flags.StringVar(&assetsDir, "assets", assetsDir, "directory with templates/resources overriding the bundled ones")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	applyDoctorDefaults(&options, flags)
+
+	if err := loadAssets(assetsDir); err != nil {
+		fmt.Println(err)
+	}
+
+	checks := runEnvironmentChecks(options)
+	for _, check := range checks {
+		fmt.Printf("[%-7s] %s: %s\n", check.Status, check.Name, check.Message)
+		if check.Hint != "" && check.Status != CHECK_PASS {
+			fmt.Printf("          %s\n", check.Hint)
+		}
+	}
+
+	if checksFailed(checks) {
+		return 1
+	}
+	return 0
+}
+
+// Fills the options that weren't passed with the installation at options.SettingsPath
+// (or the environment), and the wizard defaults when there is none
+func applyDoctorDefaults(options *DoctorOptions, flags *flag.FlagSet) {
+	defaults := newWizardState().Values
+	serverPort, _ := strconv.Atoi(defaults["server-port"])
+	if settings, err := loadInstallerSettings(options.SettingsPath); err == nil {
+		defaults["private-key"] = settings.Server.PrivateKey
+		defaults["public-key"] = settings.Server.PublicKey
+		defaults["uploads-path"] = settings.Server.UploadsPath
+		serverPort = settings.Server.Port
+	}
+
+	passed := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { passed[f.Name] = true })
+	if !passed["private-key"] {
+		options.PrivateKey = defaults["private-key"]
+	}
+	if !passed["public-key"] {
+		options.PublicKey = defaults["public-key"]
+	}
+	if !passed["uploads-path"] {
+		options.UploadsPath = defaults["uploads-path"]
+	}
+	if !passed["server-port"] {
+		options.ServerPort = serverPort
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// The defaults come from the settings passed with --settings, the flags win over them
+func TestApplyDoctorDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.toml")
+	settings := "[server]\nport=4000\nprivate_key=\"/etc/kumquat/private.pem\"\npublic_key=\"/etc/kumquat/public.pub\"\nuploads_path=\"/srv/kumquat/uploads\"\n"
+	if err := ioutil.WriteFile(path, []byte(settings), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := DoctorOptions{SettingsPath: SETTINGS_FILE}
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.StringVar(&options.SettingsPath, "settings", options.SettingsPath, "")
+	flags.StringVar(&options.PrivateKey, "private-key", "", "")
+	flags.StringVar(&options.PublicKey, "public-key", "", "")
+	flags.StringVar(&options.UploadsPath, "uploads-path", "", "")
+	flags.IntVar(&options.ServerPort, "server-port", 0, "")
+	if err := flags.Parse([]string{"--settings", path, "--public-key", "./public.pub"}); err != nil {
+		t.Fatal(err)
+	}
+	applyDoctorDefaults(&options, flags)
+
+	want := DoctorOptions{
+		SettingsPath: path,
+		PrivateKey:   "/etc/kumquat/private.pem",
+		PublicKey:    "./public.pub",
+		UploadsPath:  "/srv/kumquat/uploads",
+		ServerPort:   4000,
+	}
+	if options != want {
+		t.Errorf("applyDoctorDefaults = %+v, want %+v", options, want)
+	}
+}
+
+// An empty uploads path is reported as missing, not checked as the current directory
+func TestEnvironmentChecksWithoutUploadsPath(t *testing.T) {
+	for _, check := range runEnvironmentChecks(DoctorOptions{SettingsPath: filepath.Join(t.TempDir(), "settings.toml")}) {
+		if (check.Name == "Uploads directory" || check.Name == "Free disk space") && check.Status != CHECK_WARN {
+			t.Errorf("%s without a path: %s (%s)", check.Name, check.Status, check.Message)
+		}
+	}
+}
+
+// A running API only warns
+func TestCheckServerPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	if check := checkServerPort(port, DEFAULT_LISTEN); check.Status != CHECK_WARN {
+		t.Errorf("checkServerPort on a busy port = %s (%s)", check.Status, check.Message)
+	}
+	if check := checkServerPort(port, "localhost:"+strconv.Itoa(port)); check.Status != CHECK_WARN {
+		t.Errorf("checkServerPort on the installer port = %s (%s)", check.Status, check.Message)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Result of the enrolments the import (or the sync) removed
+const IMPORT_REMOVED = "removed"
+
+// Fields of the enrolment import, and the headers they are also known by
+var enrolmentFields = []string{"matric_number", "module_code", "class_title", "role_name"}
+
+var enrolmentAliases = map[string][]string{
+	"matric_number": {"matric", "matriculation number", "student id", "student number"},
+	"module_code":   {"module", "code"},
+	"class_title":   {"class", "academic year", "year"},
+	"role_name":     {"role"},
+}
+
+// The result of a row of the enrolment import
+type EnrolmentResult struct {
+	Line         int
+	Status       string
+	MatricNumber string
+	ModuleCode   string
+	Message      string
+}
+
+// An enrolment of a row, with everything it refers to resolved
+type enrolment struct {
+	UserID     uint32
+	ModuleCode string
+	ClassID    uint32
+	CourseID   uint32
+	RoleID     uint32
+}
+
+// Resolves the matric numbers, module codes, classes and roles of the rows
+// (the modules, classes and roles are few, they are read once)
+type enrolmentResolver struct {
+	db           *gorm.DB
+	users        map[string]uint32 // By matric number
+	matrics      map[uint32]string // By user id
+	levelModules map[string]models.LevelModule
+	classes      map[uint32]models.Class
+	roles        map[string]models.Role
+	roleNames    []string
+}
+
+func newEnrolmentResolver(db *gorm.DB) (*enrolmentResolver, error) {
+	resolver := &enrolmentResolver{
+		db:           db,
+		users:        map[string]uint32{},
+		matrics:      map[uint32]string{},
+		levelModules: map[string]models.LevelModule{},
+		classes:      map[uint32]models.Class{},
+		roles:        map[string]models.Role{},
+	}
+
+	levelModules := []models.LevelModule{}
+	if err := db.Find(&levelModules).Error; err != nil {
+		return nil, fmt.Errorf("can't read the level modules: %v", err)
+	}
+	for _, levelModule := range levelModules {
+		resolver.levelModules[strings.ToUpper(levelModule.Code)] = levelModule
+	}
+
+	classes := []models.Class{}
+	if err := db.Find(&classes).Error; err != nil {
+		return nil, fmt.Errorf("can't read the classes: %v", err)
+	}
+	for _, class := range classes {
+		resolver.classes[class.ID] = class
+	}
+
+	roles := []models.Role{}
+	if err := db.Order("id").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("can't read the roles: %v", err)
+	}
+	for _, role := range roles {
+		resolver.roles[strings.ToLower(role.Name)] = role
+		resolver.roleNames = append(resolver.roleNames, role.Name)
+	}
+	return resolver, nil
+}
+
+// Returns the id of the user with a matric number
+func (resolver *enrolmentResolver) userID(matricNumber string) (uint32, error) {
+	if id, found := resolver.users[matricNumber]; found {
+		return id, nil
+	}
+	user := models.User{}
+	err := resolver.db.Where("matric_number = ?", matricNumber).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, fmt.Errorf("there is no user with the matric number %s", matricNumber)
+	}
+	if err != nil {
+		return 0, err
+	}
+	resolver.users[matricNumber], resolver.matrics[user.ID] = user.ID, matricNumber
+	return user.ID, nil
+}
+
+// Returns the matric number of a user (for the enrolments only the database has)
+func (resolver *enrolmentResolver) matricNumber(userID uint32) string {
+	if matric, found := resolver.matrics[userID]; found {
+		return matric
+	}
+	user := models.User{}
+	resolver.db.Select("id, matric_number").Where("id = ?", userID).First(&user)
+	resolver.matrics[userID] = user.MatricNumber
+	return user.MatricNumber
+}
+
+// Returns the course a module is taught in (the one of the class of its level)
+func (resolver *enrolmentResolver) moduleCourse(code string) (uint32, bool) {
+	levelModule, found := resolver.levelModules[strings.ToUpper(code)]
+	if !found {
+		return 0, false
+	}
+	class, found := resolver.classes[levelModule.ClassID]
+	return class.CourseID, found
+}
+
+// Resolves a row into an enrolment
+func (resolver *enrolmentResolver) Resolve(values map[string]string) (enrolment, error) {
+	for _, field := range enrolmentFields {
+		if values[field] == "" {
+			return enrolment{}, fmt.Errorf("the %s is missing", strings.Replace(field, "_", " ", -1))
+		}
+	}
+
+	userID, err := resolver.userID(values["matric_number"])
+	if err != nil {
+		return enrolment{}, err
+	}
+
+	levelModule, found := resolver.levelModules[strings.ToUpper(values["module_code"])]
+	if !found {
+		return enrolment{}, fmt.Errorf("there is no module %s", values["module_code"])
+	}
+	courseID, found := resolver.moduleCourse(levelModule.Code)
+	if !found {
+		return enrolment{}, fmt.Errorf("the module %s has no class", levelModule.Code)
+	}
+
+	// The titles (e.g. 2016/2017) repeat across the courses, the one of the module's course is used
+	var class *models.Class
+	otherCourses := map[string]bool{}
+	for _, candidate := range resolver.classes {
+		if candidate.Title != values["class_title"] {
+			continue
+		}
+		if candidate.CourseID == courseID {
+			class = &candidate
+			break
+		}
+		otherCourses[fmt.Sprint(candidate.CourseID)] = true
+	}
+	if class == nil && len(otherCourses) > 0 {
+		courses := []string{}
+		for course := range otherCourses {
+			courses = append(courses, course)
+		}
+		sort.Strings(courses)
+		return enrolment{}, fmt.Errorf("the class %s belongs to the course %s, not to the course %d of %s",
+			values["class_title"], strings.Join(courses, ", "), courseID, levelModule.Code)
+	}
+	if class == nil {
+		return enrolment{}, fmt.Errorf("there is no class %s", values["class_title"])
+	}
+
+	role, found := resolver.roles[strings.ToLower(values["role_name"])]
+	if !found {
+		return enrolment{}, fmt.Errorf("there is no role %s (use %s)", values["role_name"], strings.Join(resolver.roleNames, ", "))
+	}
+
+	return enrolment{UserID: userID, ModuleCode: levelModule.Code, ClassID: class.ID, CourseID: courseID, RoleID: role.ID}, nil
+}
+
+// Returns the name of a role, for the results
+func (resolver *enrolmentResolver) roleName(id uint32) string {
+	for _, role := range resolver.roles {
+		if role.ID == id {
+			return role.Name
+		}
+	}
+	return fmt.Sprint(id)
+}
+
+// Enrols a user into a module (and its course), or changes the role and class of the enrolment
+func (resolver *enrolmentResolver) Enrol(tx *gorm.DB, e enrolment) (string, string, error) {
+	status, message := IMPORT_SKIPPED, "already enrolled"
+
+	existing := models.UserModule{}
+	err := tx.Where("user_id = ? AND module_code = ?", e.UserID, e.ModuleCode).First(&existing).Error
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		userModule := models.UserModule{UserID: e.UserID, ModuleCode: e.ModuleCode, RoleID: e.RoleID, ClassID: e.ClassID}
+		if err := tx.Create(&userModule).Error; err != nil {
+			return "", "", err
+		}
+		status, message = IMPORT_CREATED, "enrolled as "+resolver.roleName(e.RoleID)
+	case err != nil:
+		return "", "", err
+	case existing.RoleID != e.RoleID || existing.ClassID != e.ClassID:
+		changes := []string{}
+		if existing.RoleID != e.RoleID {
+			changes = append(changes, fmt.Sprintf("role %s -> %s", resolver.roleName(existing.RoleID), resolver.roleName(e.RoleID)))
+		}
+		if existing.ClassID != e.ClassID {
+			changes = append(changes, fmt.Sprintf("class %s -> %s", resolver.classes[existing.ClassID].Title, resolver.classes[e.ClassID].Title))
+		}
+		err := tx.Model(&models.UserModule{}).Where("user_id = ? AND module_code = ?", e.UserID, e.ModuleCode).
+			Updates(map[string]interface{}{"role_id": e.RoleID, "class_id": e.ClassID}).Error
+		if err != nil {
+			return "", "", err
+		}
+		status, message = IMPORT_UPDATED, strings.Join(changes, ", ")
+	}
+
+	// The users of a module are users of its course too
+	var courses int
+	if err := tx.Model(&models.UserCourse{}).Where("user_id = ? AND course_id = ?", e.UserID, e.CourseID).Count(&courses).Error; err != nil {
+		return "", "", err
+	}
+	if courses == 0 {
+		userCourse := models.UserCourse{UserID: e.UserID, CourseID: e.CourseID, RoleID: e.RoleID}
+		if err := tx.Create(&userCourse).Error; err != nil {
+			return "", "", err
+		}
+		message += fmt.Sprintf(", and in the course %d", e.CourseID)
+		if status == IMPORT_SKIPPED {
+			status = IMPORT_UPDATED
+		}
+	}
+	return status, message, nil
+}
+
+// Removes a user from a module (and from its course, if it was their last module of it)
+func (resolver *enrolmentResolver) Unenrol(tx *gorm.DB, userID uint32, code string) (string, string, error) {
+	deleted := tx.Where("user_id = ? AND module_code = ?", userID, code).Delete(&models.UserModule{})
+	if deleted.Error != nil {
+		return "", "", deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return IMPORT_SKIPPED, "not enrolled", nil
+	}
+
+	courseID, found := resolver.moduleCourse(code)
+	if !found {
+		return IMPORT_REMOVED, "unenrolled", nil
+	}
+	remaining := []models.UserModule{}
+	if err := tx.Where("user_id = ?", userID).Find(&remaining).Error; err != nil {
+		return "", "", err
+	}
+	for _, userModule := range remaining {
+		if course, _ := resolver.moduleCourse(userModule.ModuleCode); course == courseID {
+			return IMPORT_REMOVED, "unenrolled", nil
+		}
+	}
+	if err := tx.Where("user_id = ? AND course_id = ?", userID, courseID).Delete(&models.UserCourse{}).Error; err != nil {
+		return "", "", err
+	}
+	return IMPORT_REMOVED, fmt.Sprintf("unenrolled, and from the course %d", courseID), nil
+}
+
+// Removes the enrolments the file doesn't have (the sync mode)
+func (resolver *enrolmentResolver) Prune(tx *gorm.DB, wanted []enrolment) ([]EnrolmentResult, error) {
+	modules := map[string]bool{}
+	courses := map[string]bool{}
+	for _, e := range wanted {
+		modules[fmt.Sprintf("%d/%s", e.UserID, strings.ToUpper(e.ModuleCode))] = true
+		courses[fmt.Sprintf("%d/%d", e.UserID, e.CourseID)] = true
+	}
+
+	results := []EnrolmentResult{}
+	userModules := []models.UserModule{}
+	if err := tx.Order("user_id, module_code").Find(&userModules).Error; err != nil {
+		return nil, err
+	}
+	for _, userModule := range userModules {
+		if modules[fmt.Sprintf("%d/%s", userModule.UserID, strings.ToUpper(userModule.ModuleCode))] {
+			continue
+		}
+		err := tx.Where("user_id = ? AND module_code = ?", userModule.UserID, userModule.ModuleCode).Delete(&models.UserModule{}).Error
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, EnrolmentResult{
+			Status: IMPORT_REMOVED, MatricNumber: resolver.matricNumber(userModule.UserID), ModuleCode: userModule.ModuleCode,
+			Message: "not in the file, unenrolled as " + resolver.roleName(userModule.RoleID),
+		})
+	}
+
+	userCourses := []models.UserCourse{}
+	if err := tx.Order("user_id, course_id").Find(&userCourses).Error; err != nil {
+		return nil, err
+	}
+	for _, userCourse := range userCourses {
+		if courses[fmt.Sprintf("%d/%d", userCourse.UserID, userCourse.CourseID)] {
+			continue
+		}
+		err := tx.Where("user_id = ? AND course_id = ?", userCourse.UserID, userCourse.CourseID).Delete(&models.UserCourse{}).Error
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, EnrolmentResult{
+			Status: IMPORT_REMOVED, MatricNumber: resolver.matricNumber(userCourse.UserID),
+			Message: fmt.Sprintf("no module of the course %d in the file, removed from it", userCourse.CourseID),
+		})
+	}
+	return results, nil
+}
+
+// Enrols (or unenrols) the users of a CSV or XLSX file into their modules and courses
+func enrolCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	dryRun := false
+	remove := false
+	sync := false
+	sheet := ""
+	columns := ""
+
+	flags := flag.NewFlagSet("enrol", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.BoolVar(&dryRun, "dry-run", dryRun, "only show what would change")
+	flags.BoolVar(&remove, "remove", remove, "unenrol the rows of the file instead")
+	flags.BoolVar(&sync, "sync", sync, "also unenrol everyone from the modules and courses the file doesn't list them in")
+	flags.StringVar(&sheet, "sheet", sheet, "sheet of the XLSX file (default the first one)")
+	flags.StringVar(&columns, "columns", columns, "headers of the columns, if the usual ones aren't used (e.g. \"matric_number=Student ID\")")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer enrol [flags] <enrolments.csv or enrolments.xlsx>")
+		fmt.Printf("The first row has the headers of the columns: %s.\n", strings.Join(enrolmentFields, ", "))
+		fmt.Println("With --sync the enrolments of the database match the file exactly, run it with --dry-run first.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || remove && sync {
+		flags.Usage()
+		return 2
+	}
+
+	overrides, err := parseColumnOverrides(columns, enrolmentFields)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	spreadsheet, err := readSpreadsheet(flags.Arg(0), sheet)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	rows, err := mapSpreadsheetRows(spreadsheet, enrolmentFields, enrolmentAliases, overrides, enrolmentFields)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	resolver, err := newEnrolmentResolver(db)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// Everything is applied in a transaction (rolled back on a dry run)
+	tx := db.Begin()
+	if tx.Error != nil {
+		fmt.Println(tx.Error)
+		return 1
+	}
+	defer tx.Rollback()
+
+	results := []EnrolmentResult{}
+	wanted := []enrolment{}
+	counts := map[string]int{}
+	for _, row := range rows {
+		result := EnrolmentResult{Line: row.Line, MatricNumber: row.Values["matric_number"], ModuleCode: row.Values["module_code"]}
+		e, err := resolver.Resolve(row.Values)
+		if err == nil {
+			// A failed row is rolled back on its own (Postgres aborts the whole transaction otherwise)
+			result.ModuleCode = e.ModuleCode
+			err = tx.Exec("SAVEPOINT enrolment_row").Error
+		}
+		if err == nil {
+			if remove {
+				result.Status, result.Message, err = resolver.Unenrol(tx, e.UserID, e.ModuleCode)
+			} else {
+				result.Status, result.Message, err = resolver.Enrol(tx, e)
+			}
+			if err != nil {
+				tx.Exec("ROLLBACK TO SAVEPOINT enrolment_row")
+			} else if !remove {
+				wanted = append(wanted, e)
+			}
+		}
+		if err != nil {
+			result.Status, result.Message = IMPORT_FAILED, err.Error()
+		}
+		results = append(results, result)
+		counts[result.Status]++
+	}
+
+	// A row that failed would be unenrolled, so the sync needs every row to work
+	if sync && counts[IMPORT_FAILED] > 0 {
+		fmt.Printf("Not syncing, %d rows failed (fix them, or import without --sync)\n", counts[IMPORT_FAILED])
+	} else if sync {
+		removed, err := resolver.Prune(tx, wanted)
+		if err != nil {
+			fmt.Printf("can't remove the enrolments missing from the file: %v\n", err)
+			return 1
+		}
+		results = append(results, removed...)
+		counts[IMPORT_REMOVED] += len(removed)
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing was changed.")
+		fmt.Println()
+	} else if err := tx.Commit().Error; err != nil {
+		fmt.Printf("can't save the enrolments: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("%-6s %-8s %-14s %-10s %s\n", "Line", "Result", "Matric", "Module", "Details")
+	for _, result := range results {
+		line := "-"
+		if result.Line > 0 {
+			line = fmt.Sprint(result.Line)
+		}
+		fmt.Printf("%-6s %-8s %-14s %-10s %s\n", line, result.Status, result.MatricNumber, result.ModuleCode, result.Message)
+	}
+	fmt.Printf("\n%d created, %d updated, %d removed, %d skipped, %d failed\n",
+		counts[IMPORT_CREATED], counts[IMPORT_UPDATED], counts[IMPORT_REMOVED], counts[IMPORT_SKIPPED], counts[IMPORT_FAILED])
+
+	if counts[IMPORT_FAILED] > 0 {
+		return 1
+	}
+	return 0
+}
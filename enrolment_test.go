@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Two courses with a 2016/2017 class each (the second one a 2017/2018 one too), and their modules
+func openEnrolmentDatabase(t *testing.T) (*gorm.DB, *enrolmentResolver) {
+	db := openTestDatabase(t, &models.User{}, &models.Class{}, &models.LevelModule{}, &models.Role{},
+		&models.UserModule{}, &models.UserCourse{})
+	for _, record := range []interface{}{
+		&models.User{ID: 1, Username: "alice", Email: "alice@example.com", MatricNumber: "100"},
+		&models.User{ID: 2, Username: "bob", Email: "bob@example.com", MatricNumber: "200"},
+		&models.Class{ID: 1, CourseID: 1, Title: "2016/2017"},
+		&models.Class{ID: 2, CourseID: 2, Title: "2016/2017"},
+		&models.Class{ID: 3, CourseID: 2, Title: "2017/2018"},
+		&models.LevelModule{Code: "AC41001", Level: 4, ClassID: 1},
+		&models.LevelModule{Code: "AC41002", Level: 4, ClassID: 1},
+		&models.LevelModule{Code: "CS11001", Level: 1, ClassID: 3},
+		&models.Role{ID: 1, Name: "Student"},
+		&models.Role{ID: 2, Name: "Teacher"},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolver, err := newEnrolmentResolver(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, resolver
+}
+
+func TestEnrolmentResolve(t *testing.T) {
+	_, resolver := openEnrolmentDatabase(t)
+
+	tests := []struct {
+		row  []string // Matric number, module code, class title and role name
+		want enrolment
+		err  string
+	}{
+		{[]string{"100", "AC41001", "2016/2017", "Student"}, enrolment{UserID: 1, ModuleCode: "AC41001", ClassID: 1, CourseID: 1, RoleID: 1}, ""},
+		{[]string{"200", "ac41002", "2016/2017", "teacher"}, enrolment{UserID: 2, ModuleCode: "AC41002", ClassID: 1, CourseID: 1, RoleID: 2}, ""},
+		{[]string{"200", "CS11001", "2016/2017", "Student"}, enrolment{UserID: 2, ModuleCode: "CS11001", ClassID: 2, CourseID: 2, RoleID: 1}, ""},
+		{[]string{"100", "CS11001", "2017/2018", "Student"}, enrolment{UserID: 1, ModuleCode: "CS11001", ClassID: 3, CourseID: 2, RoleID: 1}, ""},
+		{[]string{"100", "AC41001", "2017/2018", "Student"}, enrolment{}, "the class 2017/2018 belongs to the course 2, not to the course 1"},
+		{[]string{"100", "AC41001", "2018/2019", "Student"}, enrolment{}, "there is no class 2018/2019"},
+		{[]string{"300", "AC41001", "2016/2017", "Student"}, enrolment{}, "there is no user with the matric number 300"},
+		{[]string{"100", "AC49999", "2016/2017", "Student"}, enrolment{}, "there is no module AC49999"},
+		{[]string{"100", "AC41001", "2016/2017", "Admin"}, enrolment{}, "there is no role Admin (use Student, Teacher)"},
+		{[]string{"100", "", "2016/2017", "Student"}, enrolment{}, "the module code is missing"},
+	}
+	for _, test := range tests {
+		values := map[string]string{}
+		for i, field := range enrolmentFields {
+			values[field] = test.row[i]
+		}
+
+		got, err := resolver.Resolve(values)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Resolve(%q) = %v, want the error %q", test.row, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", test.row, err)
+		} else if got != test.want {
+			t.Errorf("Resolve(%q) = %+v, want %+v", test.row, got, test.want)
+		}
+	}
+}
+
+// The users leave a course with their last module of it
+func TestEnrolmentUnenrol(t *testing.T) {
+	db, resolver := openEnrolmentDatabase(t)
+	for _, e := range []enrolment{
+		{UserID: 1, ModuleCode: "AC41001", ClassID: 1, CourseID: 1, RoleID: 1},
+		{UserID: 1, ModuleCode: "AC41002", ClassID: 1, CourseID: 1, RoleID: 1},
+	} {
+		if _, _, err := resolver.Enrol(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		code    string
+		status  string
+		courses int // Courses of the user after it
+	}{
+		{"AC41001", IMPORT_REMOVED, 1},
+		{"AC41001", IMPORT_SKIPPED, 1},
+		{"AC41002", IMPORT_REMOVED, 0},
+	}
+	for _, test := range tests {
+		status, message, err := resolver.Unenrol(db, 1, test.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var courses int
+		db.Model(&models.UserCourse{}).Where("user_id = ?", 1).Count(&courses)
+		if status != test.status || courses != test.courses {
+			t.Errorf("Unenrol(%s) = %s (%s) with %d courses left, want %s with %d", test.code, status, message, courses, test.status, test.courses)
+		}
+	}
+}
+
+// The sync removes the enrolments (and the courses) the file doesn't have
+func TestEnrolmentPrune(t *testing.T) {
+	db, resolver := openEnrolmentDatabase(t)
+	alice := enrolment{UserID: 1, ModuleCode: "AC41001", ClassID: 1, CourseID: 1, RoleID: 1}
+	for _, e := range []enrolment{
+		alice,
+		{UserID: 1, ModuleCode: "CS11001", ClassID: 3, CourseID: 2, RoleID: 1},
+		{UserID: 2, ModuleCode: "AC41002", ClassID: 1, CourseID: 1, RoleID: 2},
+	} {
+		if _, _, err := resolver.Enrol(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The file has alice's module in lowercase
+	wanted := alice
+	wanted.ModuleCode = "ac41001"
+	results, err := resolver.Prune(db, []enrolment{wanted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var removed []string
+	for _, result := range results {
+		removed = append(removed, fmt.Sprintf("%s %s %s", result.Status, result.MatricNumber, result.ModuleCode))
+	}
+	want := []string{"removed 100 CS11001", "removed 200 AC41002", "removed 100 ", "removed 200 "}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("Prune = %q, want %q", removed, want)
+	}
+
+	var modules, courses []string
+	userModules := []models.UserModule{}
+	db.Order("user_id, module_code").Find(&userModules)
+	for _, userModule := range userModules {
+		modules = append(modules, fmt.Sprintf("%d/%s", userModule.UserID, userModule.ModuleCode))
+	}
+	userCourses := []models.UserCourse{}
+	db.Order("user_id, course_id").Find(&userCourses)
+	for _, userCourse := range userCourses {
+		courses = append(courses, fmt.Sprintf("%d/%d", userCourse.UserID, userCourse.CourseID))
+	}
+	if !reflect.DeepEqual(modules, []string{"1/AC41001"}) || !reflect.DeepEqual(courses, []string{"1/1"}) {
+		t.Errorf("after the sync the modules are %q and the courses %q", modules, courses)
+	}
+}
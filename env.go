@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/YagoCarballo/kumquat-academy-api/tools"
+)
+
+// An environment variable overriding a setting of the installer.
+//
+// Every variable also has a _FILE variant (e.g. KUMQUAT_DB_PASSWORD_FILE) that reads
+// the value from a file, like the Docker and Kubernetes secrets.
+type EnvironmentVariable struct {
+	Name     string
+	Field    string // Wizard field it sets
+	Checkbox bool   // Parsed as a boolean (true/false, 1/0...)
+	Secret   bool   // Never shown nor saved in the wizard state
+}
+
+var environmentVariables = []EnvironmentVariable{
+	{Name: "KUMQUAT_TITLE", Field: "page-title"},
+	{Name: "KUMQUAT_DESCRIPTION", Field: "page-description"},
+	{Name: "KUMQUAT_SERVER_PORT", Field: "server-port"},
+	{Name: "KUMQUAT_SERVER_DEBUG", Field: "server-debug", Checkbox: true},
+	{Name: "KUMQUAT_SERVER_PRODUCTION", Field: "server-production", Checkbox: true},
+	{Name: "KUMQUAT_UPLOADS_PATH", Field: "uploads-path"},
+	{Name: "KUMQUAT_PRIVATE_KEY", Field: "private-key"},
+	{Name: "KUMQUAT_PUBLIC_KEY", Field: "public-key"},
+	{Name: "KUMQUAT_KEYS_GENERATE", Field: "keys-generate", Checkbox: true},
+	{Name: "KUMQUAT_DB_TYPE", Field: "db-type"},
+	{Name: "KUMQUAT_DB_HOST", Field: "db-host"},
+	{Name: "KUMQUAT_DB_PORT", Field: "db-port"},
+	{Name: "KUMQUAT_DB_NAME", Field: "db-name"},
+	{Name: "KUMQUAT_DB_USERNAME", Field: "db-username", Secret: true},
+	{Name: "KUMQUAT_DB_PASSWORD", Field: "db-password", Secret: true},
+	{Name: "KUMQUAT_DB_URL", Field: "db-url", Secret: true},
+	{Name: "KUMQUAT_DB_TLS", Field: "db-tls", Checkbox: true},
+	{Name: "KUMQUAT_DB_TLS_CA", Field: "db-tls-ca"},
+	{Name: "KUMQUAT_DB_TLS_CERT", Field: "db-tls-cert"},
+	{Name: "KUMQUAT_DB_TLS_KEY", Field: "db-tls-key", Secret: true},
+	{Name: "KUMQUAT_DB_TLS_SKIP_VERIFY", Field: "db-tls-skip-verify", Checkbox: true},
+	{Name: "KUMQUAT_DB_PARAMS", Field: "db-params"},
+	{Name: "KUMQUAT_DB_WAIT_TIMEOUT", Field: "db-wait-timeout"},
+	{Name: "KUMQUAT_DB_WAIT_INTERVAL", Field: "db-wait-interval"},
+	{Name: "KUMQUAT_DB_WAIT_MAX_INTERVAL", Field: "db-wait-max-interval"},
+	{Name: "KUMQUAT_DB_WAIT_BACKOFF", Field: "db-wait-backoff"},
+	{Name: "KUMQUAT_DB_LOCK_TIMEOUT", Field: "db-lock-timeout"},
+	{Name: "KUMQUAT_DB_BACKUP", Field: "db-backup", Checkbox: true},
+	{Name: "KUMQUAT_DB_BACKUP_DIR", Field: "db-backup-dir"},
+	{Name: "KUMQUAT_DB_CREATE", Field: "db-create", Checkbox: true},
+	{Name: "KUMQUAT_DB_DEMO", Field: "db-demo", Checkbox: true},
+	{Name: "KUMQUAT_SQLITE_PATH", Field: "sqlite-path"},
+	{Name: "KUMQUAT_EMAIL_SERVER", Field: "email-server"},
+	{Name: "KUMQUAT_EMAIL_PORT", Field: "email-port"},
+	{Name: "KUMQUAT_EMAIL_USER", Field: "email-user", Secret: true},
+	{Name: "KUMQUAT_EMAIL_PASSWORD", Field: "email-password", Secret: true},
+	{Name: "KUMQUAT_EMAIL_SENDER", Field: "email-sender"},
+	{Name: "KUMQUAT_API_PREFIX", Field: "api-prefix"},
+	{Name: "KUMQUAT_API_VERSION", Field: "api-version"},
+	{Name: "KUMQUAT_ADMIN_USERNAME", Field: "admin-username"},
+	{Name: "KUMQUAT_ADMIN_EMAIL", Field: "admin-email"},
+	{Name: "KUMQUAT_ADMIN_FIRST_NAME", Field: "admin-first-name"},
+	{Name: "KUMQUAT_ADMIN_LAST_NAME", Field: "admin-last-name"},
+	{Name: "KUMQUAT_ADMIN_DATE_OF_BIRTH", Field: "admin-date-of-birth"},
+	{Name: "KUMQUAT_ADMIN_MATRIC_NUMBER", Field: "admin-matric-number"},
+	{Name: "KUMQUAT_ADMIN_PASSWORD", Field: "admin-password", Secret: true},
+}
+
+// Reads a variable from the environment, or from the file its _FILE variant points to.
+//
+// Setting both is an error, since it's not clear which one should win.
+func lookupEnvironment(name string) (string, bool, error) {
+	value, found := os.LookupEnv(name)
+	path, fromFile := os.LookupEnv(name + "_FILE")
+
+	if found && fromFile {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set, use only one of them", name, name)
+	}
+
+	if fromFile {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("can't read %s_FILE: %v", name, err)
+		}
+		// Secret files usually end with a new line
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+
+	return value, found, nil
+}
+
+// Overrides the wizard values with the environment, returns the variable that set each field
+func applyEnvironment(values map[string]string) (map[string]EnvironmentVariable, error) {
+	applied := map[string]EnvironmentVariable{}
+	for _, variable := range environmentVariables {
+		value, found, err := lookupEnvironment(variable.Name)
+		if err != nil {
+			return applied, err
+		}
+		if !found {
+			continue
+		}
+
+		if variable.Checkbox {
+			checked, err := strconv.ParseBool(value)
+			if err != nil {
+				return applied, fmt.Errorf("invalid %s %q, expected true or false", variable.Name, value)
+			}
+			value = checkbox(checked)
+		}
+
+		// The administrator confirms the password in the wizard
+		if variable.Field == "admin-password" {
+			values["admin-password-confirm"] = value
+			applied["admin-password-confirm"] = variable
+		}
+
+		values[variable.Field] = value
+		applied[variable.Field] = variable
+	}
+
+	// KUMQUAT_DB_URL sets every database field (the ones with a variable of their own win)
+	if variable, found := applied["db-url"]; found {
+		fields, err := parseDatabaseURL(values["db-url"])
+		if err != nil {
+			return applied, fmt.Errorf("invalid %s: %v", variable.Name, err)
+		}
+		for field, value := range fields {
+			if _, found := applied[field]; !found {
+				values[field] = value
+				applied[field] = variable
+			}
+		}
+		delete(values, "db-url")
+	}
+	return applied, nil
+}
+
+// Loads a settings file with the environment applied on top (for the commands working on an installation)
+func loadInstallerSettings(path string) (*tools.Settings, error) {
+	existing, values, applied, err := loadInstallerValues(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the variables change the settings
+	changed := map[string]bool{}
+	for field := range applied {
+		changed[field] = true
+	}
+	settings, _, _ := parseSettings(valuesToForm(values))
+	return mergeSettings(existing, settings, changed), nil
+}
+
+// Loads a settings file with the environment applied on top, as wizard values
+// (they also hold what settings.toml doesn't, like the database TLS options).
+func loadInstallerForm(path string) (*tools.Settings, url.Values, error) {
+	existing, values, _, err := loadInstallerValues(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return existing, valuesToForm(values), nil
+}
+
+// Loads a settings file as wizard values with the environment applied on top,
+// returning the variable that set each field
+func loadInstallerValues(path string) (*tools.Settings, map[string]string, map[string]EnvironmentVariable, error) {
+	existing, err := loadSettingsFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	values := newWizardState().Values
+	if existing != nil {
+		settingsToForm(existing, values)
+	}
+
+	applied, err := applyEnvironment(values)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if existing == nil && len(applied) == 0 {
+		return nil, nil, nil, fmt.Errorf("%s doesn't exist, and no KUMQUAT_* variables are set", path)
+	}
+	return existing, values, applied, nil
+}
+
+// Loads a settings file as wizard values, without the environment
+// (for the commands working on more than one installation)
+func loadSettingsForm(path string) (url.Values, error) {
+	existing, err := loadSettingsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, fmt.Errorf("%s doesn't exist", path)
+	}
+
+	values := newWizardState().Values
+	settingsToForm(existing, values)
+	return valuesToForm(values), nil
+}
+
+// Converts the wizard values into a form
+func valuesToForm(values map[string]string) url.Values {
+	form := url.Values{}
+	for key, value := range values {
+		form.Set(key, value)
+	}
+	return form
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Creates the file without waiting, returns nil if another process created it.
+//
+// Without flock, a crashed installer leaves the file behind (remove it to unlock).
+func tryLockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, nil
+	}
+	return file, err
+}
+
+// Unlocks the file by removing it
+func unlockFile(path string, file *os.File) {
+	file.Close()
+	os.Remove(path)
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Locks the file without waiting, returns nil if another process holds it
+func tryLockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// Unlocks the file (it's kept, removing it would race with the next process locking it)
+func unlockFile(path string, file *os.File) {
+	file.Truncate(0)
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	file.Close()
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Version of the installer, set when building the releases
+// (go build -ldflags "-X main.installerVersion=1.2.0")
+var installerVersion = ""
+
+// Runs shown by the status command and the installed page
+const DEFAULT_HISTORY_LIMIT = 20
+
+// InstallerRun is a run of the installer (the wizard or one of the commands changing the database).
+//
+// The table belongs to the installer, the platform doesn't use it.
+type InstallerRun struct {
+	ID               uint32 `gorm:"primary_key"`
+	Started          time.Time
+	InstallerVersion string `gorm:"size:40"`
+	SchemaVersion    string `gorm:"size:40"`
+	Dialect          string `gorm:"size:20"`
+	Command          string `gorm:"size:20"` // wizard, migrate, upgrade, restore or migrate-data
+	CreateTables     bool
+	DemoData         bool
+	Backup           string `gorm:"size:255"` // Backup taken before the run (see backup.go)
+	OperatorIP       string `gorm:"size:45"`  // Empty for the commands
+	Result           string `gorm:"size:20"`  // running, finished, failed or canceled
+	Error            string `gorm:"size:1000"`
+	DurationMS       int64
+}
+
+func (InstallerRun) TableName() string {
+	return "kumquat_installer_runs"
+}
+
+// Returns the version of the installer (the module version if it wasn't set when building)
+func currentInstallerVersion() string {
+	if installerVersion != "" {
+		return installerVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// Returns the version of the schema the installer creates (a fingerprint of the registry,
+// so it changes with any table, column, index or key)
+func currentSchemaVersion(db *gorm.DB) string {
+	sum := sha256.Sum256([]byte(renderSchemaSQL(db)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Returns the address of the operator using the wizard
+func operatorIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Records the start of a run (creating the history table if it's missing).
+//
+// The history never stops a run, it's only a warning if it can't be written.
+func beginInstallerRun(db *gorm.DB, command string, createTables, demoData bool, operator string, job *InstallJob) *InstallerRun {
+	run := &InstallerRun{
+		Started:          job.Started,
+		InstallerVersion: currentInstallerVersion(),
+		SchemaVersion:    currentSchemaVersion(db),
+		Dialect:          db.Dialect().GetName(),
+		Command:          command,
+		CreateTables:     createTables,
+		DemoData:         demoData,
+		OperatorIP:       operator,
+		Result:           JOB_RUNNING,
+	}
+
+	if err := db.Set("gorm:table_options", tableOptions(db)).AutoMigrate(&InstallerRun{}).Error; err != nil {
+		job.Warn("Can't create the installer history: %v", err)
+		return run
+	}
+	if err := db.Create(run).Error; err != nil {
+		job.Warn("Can't record the run in the installer history: %v", err)
+	}
+	return run
+}
+
+// Records how the run ended
+func (run *InstallerRun) Finish(db *gorm.DB, err error, job *InstallJob) {
+	if run.ID == 0 {
+		return
+	}
+
+	run.Result = JOB_FINISHED
+	if err == errJobCanceled {
+		run.Result = JOB_CANCELED
+	} else if err != nil {
+		run.Result = JOB_FAILED
+		run.Error = err.Error()
+		if len(run.Error) > 1000 {
+			run.Error = run.Error[:1000]
+		}
+	}
+	run.DurationMS = time.Since(run.Started).Milliseconds()
+
+	if err := db.Save(run).Error; err != nil {
+		job.Warn("Can't record the result in the installer history: %v", err)
+	}
+}
+
+// Lists the latest runs (newest first, none if the installer never recorded one)
+func listInstallerRuns(db *gorm.DB, limit int) ([]InstallerRun, error) {
+	runs := []InstallerRun{}
+	if !db.Dialect().HasTable(InstallerRun{}.TableName()) {
+		return runs, nil
+	}
+	err := db.Order("id desc").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// Returns the last run that finished (nil if none did, the platform isn't installed then)
+func lastFinishedRun(runs []InstallerRun) *InstallerRun {
+	for i := range runs {
+		if runs[i].Result == JOB_FINISHED {
+			return &runs[i]
+		}
+	}
+	return nil
+}
+
+// Describes the options of a run (e.g. "tables, demo data")
+func (run InstallerRun) Options() string {
+	options := ""
+	add := func(option string) {
+		if options != "" {
+			options += ", "
+		}
+		options += option
+	}
+	if run.CreateTables {
+		add("tables")
+	}
+	if run.DemoData {
+		add("demo data")
+	}
+	if run.Backup != "" {
+		add("backup " + run.Backup)
+	}
+	if options == "" {
+		return "-"
+	}
+	return options
+}
+
+// Describes where the run was started from
+func (run InstallerRun) Operator() string {
+	if run.OperatorIP == "" {
+		return "command line"
+	}
+	return run.OperatorIP
+}
+
+// Returns the duration of the run, for the tables
+func (run InstallerRun) Duration() time.Duration {
+	return (time.Duration(run.DurationMS) * time.Millisecond).Round(time.Millisecond)
+}
+
+var (
+	// Runs shown by the first page (reading them connects to the database)
+	cachedRuns       []InstallerRun
+	cachedRunsLoaded bool
+
+	// Guards the cached runs
+	cachedRunsLock sync.Mutex
+)
+
+// Returns installedRuns, reading the database only on the first visit (and after an installation)
+func cachedInstalledRuns() []InstallerRun {
+	cachedRunsLock.Lock()
+	defer cachedRunsLock.Unlock()
+
+	if !cachedRunsLoaded {
+		cachedRuns = installedRuns()
+		cachedRunsLoaded = true
+	}
+	return cachedRuns
+}
+
+// Forgets the cached runs, so the next visit reads them again
+func resetInstalledRuns() {
+	cachedRunsLock.Lock()
+	cachedRunsLoaded = false
+	cachedRuns = nil
+	cachedRunsLock.Unlock()
+}
+
+// Lists the runs recorded in the database of settings.toml (none if it isn't installed, or can't be reached)
+func installedRuns() []InstallerRun {
+	existing, form, err := loadInstallerForm(SETTINGS_FILE)
+	if err != nil || existing == nil {
+		return nil
+	}
+	db, err := openDatabaseNow(form)
+	if err != nil {
+		return nil
+	}
+	defer db.Close()
+
+	runs, err := listInstallerRuns(db, DEFAULT_HISTORY_LIMIT)
+	if err != nil {
+		log.Printf("can't read the installer history: %v", err)
+	}
+	return runs
+}
+
+// Shows the history of an installation, instead of starting the wizard again
+func installedHandler(w http.ResponseWriter, r *http.Request, runs []InstallerRun) {
+	headerObj := Header{
+		Title:       "Kumquat Academy - Installer",
+		Description: "Already installed",
+		Author:      "Yago Carballo",
+	}
+
+	last := lastFinishedRun(runs)
+	passedObj := struct {
+		Header    *Header
+		Intro     string
+		Runs      []InstallerRun
+		FirstStep string
+	}{
+		Header:    &headerObj,
+		Intro:     fmt.Sprintf("The platform is already installed (last run %s on %s).", last.Command, last.Started.Local().Format("2006-01-02 15:04")),
+		Runs:      runs,
+		FirstStep: wizardSteps[0].ID,
+	}
+
+	templates.ExecuteTemplate(w, "header", headerObj)
+	templates.ExecuteTemplate(w, "installedPage", passedObj)
+}
+
+// Shows the installer history of the installation, and if its schema is up to date
+func statusCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	limit := DEFAULT_HISTORY_LIMIT
+	asJSON := false
+
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.IntVar(&limit, "limit", limit, "runs shown")
+	flags.BoolVar(&asJSON, "json", asJSON, "print the history as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	db, config, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	runs, err := listInstallerRuns(db, limit)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if asJSON {
+		content, _ := json.MarshalIndent(runs, "", "  ")
+		fmt.Println(string(content))
+		return 0
+	}
+
+	fmt.Printf("Database:        %s %s (%s)\n", config.Dialect, config.Name, config.Address())
+	fmt.Printf("Installer:       %s\n", currentInstallerVersion())
+	fmt.Printf("Schema version:  %s\n", currentSchemaVersion(db))
+	if pending := pendingSchemaChanges(db); len(pending) > 0 {
+		fmt.Printf("Schema:          %d pending changes (run `installer migrate`)\n", len(pending))
+	} else {
+		fmt.Println("Schema:          up to date")
+	}
+	fmt.Println()
+
+	if len(runs) == 0 {
+		fmt.Println("The installer hasn't recorded any run in this database.")
+		return 0
+	}
+
+	fmt.Printf("%-20s %-13s %-9s %-12s %-8s %-9s %-15s %-10s %s\n", "Started", "Command", "Result", "Schema", "Dialect", "Version", "Operator", "Duration", "Options")
+	for _, run := range runs {
+		fmt.Printf("%-20s %-13s %-9s %-12s %-8s %-9s %-15s %-10s %s\n",
+			run.Started.Local().Format("2006-01-02 15:04:05"), run.Command, run.Result, run.SchemaVersion,
+			run.Dialect, run.InstallerVersion, run.Operator(), run.Duration(), run.Options())
+		if run.Error != "" {
+			fmt.Printf("%20s %s\n", "", run.Error)
+		}
+	}
+	return 0
+}
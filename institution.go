@@ -0,0 +1,759 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+	"gopkg.in/yaml.v2"
+)
+
+// Actions of the plan of a spec
+const (
+	SPEC_CREATE = "create"
+	SPEC_UPDATE = "update"
+)
+
+// Format of the dates of a spec
+const SPEC_DATE_LAYOUT = "2006-01-02"
+
+// Subcommands of `installer institution`
+var institutionCommands = []Command{
+	{"plan", "Shows what applying a spec would create or update in the database", institutionPlanCommand},
+	{"apply", "Creates or updates the courses, classes, levels, modules and roles of a spec", institutionApplyCommand},
+}
+
+var (
+	specColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+	specIconPattern  = regexp.MustCompile(`^fa-[a-z0-9-]+$`)
+	specPermissions  = []string{"read", "write", "delete", "update"}
+	specStatuses     = []models.ModuleStatus{models.ModuleOngoing, models.ModuleFuture}
+)
+
+// An institution as code: its roles, modules and courses (YAML or JSON).
+//
+// The records are matched by their names (the titles, or the codes of the
+// level modules), the ids are the ones of the database.
+type InstitutionSpec struct {
+	Roles   []RoleSpec   `yaml:"roles" json:"roles"`
+	Modules []ModuleSpec `yaml:"modules" json:"modules"`
+	Courses []CourseSpec `yaml:"courses" json:"courses"`
+}
+
+type RoleSpec struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Permissions []string `yaml:"permissions" json:"permissions"` // read, write, delete and update
+}
+
+type ModuleSpec struct {
+	Title       string `yaml:"title" json:"title"`
+	Color       string `yaml:"color" json:"color"`       // e.g. #9C0098
+	Icon        string `yaml:"icon" json:"icon"`         // Font Awesome, e.g. fa-cloud
+	Duration    uint32 `yaml:"duration" json:"duration"` // In weeks
+	Description string `yaml:"description" json:"description"`
+}
+
+type CourseSpec struct {
+	Title       string      `yaml:"title" json:"title"`
+	Description string      `yaml:"description" json:"description"`
+	Classes     []ClassSpec `yaml:"classes" json:"classes"`
+}
+
+// A class (an academic year, e.g. 2016/2017) of a course
+type ClassSpec struct {
+	Title  string      `yaml:"title" json:"title"`
+	Start  string      `yaml:"start" json:"start"`
+	End    string      `yaml:"end" json:"end"`
+	Levels []LevelSpec `yaml:"levels" json:"levels"`
+}
+
+// A level of a class (the dates of the class, unless given)
+type LevelSpec struct {
+	Level   uint32            `yaml:"level" json:"level"`
+	Start   string            `yaml:"start" json:"start"`
+	End     string            `yaml:"end" json:"end"`
+	Modules []LevelModuleSpec `yaml:"modules" json:"modules"`
+}
+
+// A module taught in a level, by its code (e.g. AC31007)
+type LevelModuleSpec struct {
+	Code   string `yaml:"code" json:"code"`
+	Module string `yaml:"module" json:"module"` // Title of the module
+	Status string `yaml:"status" json:"status"` // ongoing or future (by the start, unless given)
+	Start  string `yaml:"start" json:"start"`   // The start of the level, unless given
+}
+
+// A change of the plan of a spec
+type InstitutionChange struct {
+	Action string   `json:"action"`
+	Table  string   `json:"table"`
+	Key    string   `json:"key"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+func (change InstitutionChange) Describe() string {
+	if change.Action == SPEC_CREATE {
+		return fmt.Sprintf("+ %s %s", change.Table, change.Key)
+	}
+	return fmt.Sprintf("~ %s %s: %s", change.Table, change.Key, strings.Join(change.Fields, ", "))
+}
+
+// Reads a spec (JSON if it ends with .json, YAML otherwise), unknown fields are errors
+func readInstitutionSpec(path string) (*InstitutionSpec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &InstitutionSpec{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(spec)
+	} else {
+		err = yaml.UnmarshalStrict(content, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// Parses a date of a spec (in GMT, like the demo data)
+func parseSpecDate(value string) (time.Time, error) {
+	date, err := time.ParseInLocation(SPEC_DATE_LAYOUT, value, time.FixedZone("GMT", 0))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't read the date %q (use YYYY-MM-DD)", value)
+	}
+	return date, nil
+}
+
+// Checks a spec, returning every problem it has
+func validateInstitutionSpec(spec *InstitutionSpec) []error {
+	errs := []error{}
+	fail := func(path, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	// Checks a date, and that it isn't missing (unless optional)
+	date := func(path, value string, optional bool) time.Time {
+		if value == "" {
+			if !optional {
+				fail(path, "is missing")
+			}
+			return time.Time{}
+		}
+		parsed, err := parseSpecDate(value)
+		if err != nil {
+			fail(path, "%v", err)
+		}
+		return parsed
+	}
+
+	roles := map[string]bool{}
+	for i, role := range spec.Roles {
+		path := fmt.Sprintf("roles[%d]", i)
+		if role.Name == "" {
+			fail(path+".name", "is missing")
+		} else if roles[strings.ToLower(role.Name)] {
+			fail(path+".name", "the role %s is there twice", role.Name)
+		}
+		roles[strings.ToLower(role.Name)] = true
+		for _, permission := range role.Permissions {
+			known := false
+			for _, name := range specPermissions {
+				known = known || name == permission
+			}
+			if !known {
+				fail(path+".permissions", "unknown permission %q (use %s)", permission, strings.Join(specPermissions, ", "))
+			}
+		}
+	}
+
+	modules := map[string]bool{}
+	for i, module := range spec.Modules {
+		path := fmt.Sprintf("modules[%d]", i)
+		if module.Title == "" {
+			fail(path+".title", "is missing")
+		} else if modules[module.Title] {
+			fail(path+".title", "the module %s is there twice", module.Title)
+		}
+		modules[module.Title] = true
+		if !specColorPattern.MatchString(module.Color) {
+			fail(path+".color", "%q isn't a colour like #9C0098", module.Color)
+		}
+		if !specIconPattern.MatchString(module.Icon) {
+			fail(path+".icon", "%q isn't a Font Awesome icon like fa-cloud", module.Icon)
+		}
+		if module.Duration == 0 {
+			fail(path+".duration", "is missing (in weeks)")
+		}
+	}
+
+	courses := map[string]bool{}
+	codes := map[string]string{}
+	for i, course := range spec.Courses {
+		path := fmt.Sprintf("courses[%d]", i)
+		if course.Title == "" {
+			fail(path+".title", "is missing")
+		} else if courses[course.Title] {
+			fail(path+".title", "the course %s is there twice", course.Title)
+		}
+		courses[course.Title] = true
+
+		classes := map[string]bool{}
+		for j, class := range course.Classes {
+			path := fmt.Sprintf("%s.classes[%d]", path, j)
+			if class.Title == "" {
+				fail(path+".title", "is missing")
+			} else if classes[class.Title] {
+				fail(path+".title", "the class %s is there twice", class.Title)
+			}
+			classes[class.Title] = true
+			start, end := date(path+".start", class.Start, false), date(path+".end", class.End, false)
+			if !start.IsZero() && !end.IsZero() && !end.After(start) {
+				fail(path+".end", "is before the start")
+			}
+
+			levels := map[uint32]bool{}
+			for k, level := range class.Levels {
+				path := fmt.Sprintf("%s.levels[%d]", path, k)
+				if level.Level == 0 {
+					fail(path+".level", "is missing")
+				} else if levels[level.Level] {
+					fail(path+".level", "the level %d is there twice", level.Level)
+				}
+				levels[level.Level] = true
+				date(path+".start", level.Start, true)
+				date(path+".end", level.End, true)
+
+				for l, levelModule := range level.Modules {
+					path := fmt.Sprintf("%s.modules[%d]", path, l)
+					if levelModule.Code == "" {
+						fail(path+".code", "is missing")
+					} else if other, found := codes[strings.ToUpper(levelModule.Code)]; found {
+						fail(path+".code", "the code %s is used by %s too", levelModule.Code, other)
+					}
+					codes[strings.ToUpper(levelModule.Code)] = path
+					if !modules[levelModule.Module] {
+						fail(path+".module", "there is no module %q in the modules", levelModule.Module)
+					}
+					if levelModule.Status != "" {
+						known := false
+						for _, status := range specStatuses {
+							known = known || string(status) == levelModule.Status
+						}
+						if !known {
+							fail(path+".status", "unknown status %q (use %s or %s)", levelModule.Status, models.ModuleOngoing, models.ModuleFuture)
+						}
+					}
+					date(path+".start", levelModule.Start, true)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// Compares the fields of a record with the spec, collecting the columns to update
+type specDiff struct {
+	fields  []string
+	updates map[string]interface{}
+}
+
+func (diff *specDiff) Compare(column string, from, to interface{}) {
+	if fmt.Sprint(from) == fmt.Sprint(to) {
+		return
+	}
+	if diff.updates == nil {
+		diff.updates = map[string]interface{}{}
+	}
+	diff.fields = append(diff.fields, fmt.Sprintf("%s %v -> %v", column, from, to))
+	diff.updates[column] = to
+}
+
+// Compares a reference by its id, showing the names (on a plan, the records to create have no id yet)
+func (diff *specDiff) CompareReference(column string, from, to uint32, fromName, toName string) {
+	if from == to {
+		return
+	}
+	if diff.updates == nil {
+		diff.updates = map[string]interface{}{}
+	}
+	diff.fields = append(diff.fields, fmt.Sprintf("%s %s -> %s", column, fromName, toName))
+	diff.updates[column] = to
+}
+
+// Compares dates by their day (the database may keep them in another timezone)
+func (diff *specDiff) CompareDate(column string, from, to time.Time) {
+	gmt := time.FixedZone("GMT", 0)
+	if from.In(gmt).Format(SPEC_DATE_LAYOUT) == to.Format(SPEC_DATE_LAYOUT) {
+		return
+	}
+	diff.Compare(column, from.In(gmt).Format(SPEC_DATE_LAYOUT), to.Format(SPEC_DATE_LAYOUT))
+	diff.updates[column] = to
+}
+
+// Makes the database match a spec (or only plans it).
+//
+// Planning and applying take the same path, on a plan nothing is written
+// (the records to create keep a zero id, so nothing is found under them).
+type institutionReconciler struct {
+	db        *gorm.DB
+	apply     bool
+	changes   []InstitutionChange
+	unchanged int
+	modules   map[string]uint32 // Ids by title
+}
+
+// Creates a record (on apply)
+func (r *institutionReconciler) create(key string, record interface{}) error {
+	table := r.db.NewScope(record).TableName()
+	r.changes = append(r.changes, InstitutionChange{Action: SPEC_CREATE, Table: table, Key: key})
+	if !r.apply {
+		return nil
+	}
+	if err := r.db.Create(record).Error; err != nil {
+		return fmt.Errorf("can't create %s %s: %v", table, key, err)
+	}
+	return nil
+}
+
+// Updates the changed columns of a record (on apply)
+func (r *institutionReconciler) update(key string, model interface{}, diff specDiff, where string, args ...interface{}) error {
+	if len(diff.updates) == 0 {
+		r.unchanged++
+		return nil
+	}
+	table := r.db.NewScope(model).TableName()
+	r.changes = append(r.changes, InstitutionChange{Action: SPEC_UPDATE, Table: table, Key: key, Fields: diff.fields})
+	if !r.apply {
+		return nil
+	}
+	if err := r.db.Model(model).Where(where, args...).Updates(diff.updates).Error; err != nil {
+		return fmt.Errorf("can't update %s %s: %v", table, key, err)
+	}
+	return nil
+}
+
+// Finds the record matching the query, returning if there is one
+func (r *institutionReconciler) find(out interface{}, where string, args ...interface{}) (bool, error) {
+	err := r.db.Where(where, args...).First(out).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can't read %s: %v", r.db.NewScope(out).TableName(), err)
+	}
+	return true, nil
+}
+
+func (r *institutionReconciler) Reconcile(spec *InstitutionSpec) error {
+	for _, role := range spec.Roles {
+		if err := r.role(role); err != nil {
+			return err
+		}
+	}
+
+	r.modules = map[string]uint32{}
+	for _, module := range spec.Modules {
+		if err := r.module(module); err != nil {
+			return err
+		}
+	}
+
+	for _, course := range spec.Courses {
+		if err := r.course(course); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *institutionReconciler) role(spec RoleSpec) error {
+	can := map[string]bool{}
+	for _, permission := range spec.Permissions {
+		can[permission] = true
+	}
+	role := models.Role{Name: spec.Name, Description: spec.Description,
+		CanRead: can["read"], CanWrite: can["write"], CanDelete: can["delete"], CanUpdate: can["update"]}
+
+	// The names are case insensitive, like the validation of the spec
+	existing := models.Role{}
+	found, err := r.find(&existing, "LOWER(name) = LOWER(?)", spec.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return r.create(spec.Name, &role)
+	}
+	diff := specDiff{}
+	diff.Compare("name", existing.Name, role.Name)
+	diff.Compare("description", existing.Description, role.Description)
+	diff.Compare("can_read", existing.CanRead, role.CanRead)
+	diff.Compare("can_write", existing.CanWrite, role.CanWrite)
+	diff.Compare("can_delete", existing.CanDelete, role.CanDelete)
+	diff.Compare("can_update", existing.CanUpdate, role.CanUpdate)
+	return r.update(spec.Name, &models.Role{}, diff, "id = ?", existing.ID)
+}
+
+func (r *institutionReconciler) module(spec ModuleSpec) error {
+	module := models.Module{Title: spec.Title, Color: spec.Color, Icon: spec.Icon, Duration: spec.Duration, Description: spec.Description}
+
+	existing := models.Module{}
+	found, err := r.find(&existing, "title = ?", spec.Title)
+	if err != nil {
+		return err
+	}
+	if !found {
+		err = r.create(spec.Title, &module)
+		r.modules[spec.Title] = module.ID
+		return err
+	}
+	r.modules[spec.Title] = existing.ID
+
+	diff := specDiff{}
+	diff.Compare("color", existing.Color, module.Color)
+	diff.Compare("icon", existing.Icon, module.Icon)
+	diff.Compare("duration", existing.Duration, module.Duration)
+	diff.Compare("description", existing.Description, module.Description)
+	return r.update(spec.Title, &models.Module{}, diff, "id = ?", existing.ID)
+}
+
+func (r *institutionReconciler) course(spec CourseSpec) error {
+	course := models.Course{}
+	found, err := r.find(&course, "title = ?", spec.Title)
+	if err != nil {
+		return err
+	}
+	if !found {
+		course = models.Course{Title: spec.Title, Description: spec.Description}
+		err = r.create(spec.Title, &course)
+	} else {
+		diff := specDiff{}
+		diff.Compare("description", course.Description, spec.Description)
+		err = r.update(spec.Title, &models.Course{}, diff, "id = ?", course.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, class := range spec.Classes {
+		if err := r.class(course, class); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *institutionReconciler) class(course models.Course, spec ClassSpec) error {
+	key := fmt.Sprintf("%s %s", course.Title, spec.Title)
+	start, _ := parseSpecDate(spec.Start)
+	end, _ := parseSpecDate(spec.End)
+
+	class := models.Class{}
+	found, err := r.find(&class, "course_id = ? AND title = ?", course.ID, spec.Title)
+	if err != nil {
+		return err
+	}
+	if !found {
+		class = models.Class{CourseID: course.ID, Title: spec.Title, Start: start, End: end}
+		err = r.create(key, &class)
+	} else {
+		diff := specDiff{}
+		diff.CompareDate("start", class.Start, start)
+		diff.CompareDate("end", class.End, end)
+		err = r.update(key, &models.Class{}, diff, "id = ? AND course_id = ?", class.ID, course.ID)
+		class.Start, class.End = start, end
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, level := range spec.Levels {
+		if err := r.level(key, class, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *institutionReconciler) level(classKey string, class models.Class, spec LevelSpec) error {
+	key := fmt.Sprintf("%s level %d", classKey, spec.Level)
+	start, end := class.Start, class.End
+	if spec.Start != "" {
+		start, _ = parseSpecDate(spec.Start)
+	}
+	if spec.End != "" {
+		end, _ = parseSpecDate(spec.End)
+	}
+
+	existing := models.CourseLevel{}
+	found, err := r.find(&existing, "level = ? AND class_id = ?", spec.Level, class.ID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		err = r.create(key, &models.CourseLevel{Level: spec.Level, CourseID: class.CourseID, ClassID: class.ID, Start: start, End: end})
+	} else {
+		diff := specDiff{}
+		diff.Compare("course_id", existing.CourseID, class.CourseID)
+		diff.CompareDate("start", existing.Start, start)
+		diff.CompareDate("end", existing.End, end)
+		err = r.update(key, &models.CourseLevel{}, diff, "level = ? AND class_id = ?", spec.Level, class.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, levelModule := range spec.Modules {
+		if err := r.levelModule(class, spec.Level, start, levelModule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *institutionReconciler) levelModule(class models.Class, level uint32, levelStart time.Time, spec LevelModuleSpec) error {
+	start := levelStart
+	if spec.Start != "" {
+		start, _ = parseSpecDate(spec.Start)
+	}
+	status := models.ModuleStatus(spec.Status)
+	if status == "" {
+		status = models.ModuleOngoing
+		if start.After(time.Now()) {
+			status = models.ModuleFuture
+		}
+	}
+	levelModule := models.LevelModule{Code: spec.Code, Level: level, ClassID: class.ID, ModuleID: r.modules[spec.Module], Status: status, Start: start}
+
+	// The codes are case insensitive, like the validation of the spec (the stored one is kept,
+	// the enrolments reference it)
+	existing := models.LevelModule{}
+	found, err := r.find(&existing, "LOWER(code) = LOWER(?)", spec.Code)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return r.create(spec.Code, &levelModule)
+	}
+	diff := specDiff{}
+	diff.Compare("level", existing.Level, levelModule.Level)
+	diff.Compare("class_id", existing.ClassID, levelModule.ClassID)
+	if existing.ModuleID != levelModule.ModuleID {
+		from, err := r.moduleTitle(existing.ModuleID)
+		if err != nil {
+			return err
+		}
+		diff.CompareReference("module_id", existing.ModuleID, levelModule.ModuleID, from, spec.Module)
+	}
+	diff.Compare("status", existing.Status, levelModule.Status)
+	diff.CompareDate("start", existing.Start, levelModule.Start)
+	return r.update(spec.Code, &models.LevelModule{}, diff, "LOWER(code) = LOWER(?)", spec.Code)
+}
+
+// Returns the title of a module by its id (for the plan)
+func (r *institutionReconciler) moduleTitle(id uint32) (string, error) {
+	for title, moduleID := range r.modules {
+		if moduleID == id && id != 0 {
+			return title, nil
+		}
+	}
+	module := models.Module{}
+	if found, err := r.find(&module, "id = ?", id); err != nil || !found {
+		return fmt.Sprintf("#%d", id), err
+	}
+	return module.Title, nil
+}
+
+// Reads and checks the spec of the plan and apply commands
+func loadInstitutionSpec(path string) (*InstitutionSpec, bool) {
+	spec, err := readInstitutionSpec(path)
+	if err != nil {
+		fmt.Println(err)
+		return nil, false
+	}
+	if errs := validateInstitutionSpec(spec); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Printf("%s: %v\n", path, err)
+		}
+		return nil, false
+	}
+	return spec, true
+}
+
+// Prints the changes of a plan (or of an apply)
+func printInstitutionChanges(r *institutionReconciler) {
+	created, updated := 0, 0
+	for _, change := range r.changes {
+		fmt.Println(change.Describe())
+		if change.Action == SPEC_CREATE {
+			created++
+		} else {
+			updated++
+		}
+	}
+	if len(r.changes) > 0 {
+		fmt.Println()
+	}
+	if r.apply {
+		fmt.Printf("%d created, %d updated, %d unchanged\n", created, updated, r.unchanged)
+	} else {
+		fmt.Printf("%d to create, %d to update, %d unchanged\n", created, updated, r.unchanged)
+	}
+}
+
+// Manages the institution (courses, classes, modules and roles) from a spec
+func institutionCommand(args []string) int {
+	if len(args) > 0 {
+		for _, command := range institutionCommands {
+			if command.Name == args[0] {
+				return command.Run(args[1:])
+			}
+		}
+		if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+			fmt.Printf("Unknown institution command %q\n\n", args[0])
+		}
+	}
+
+	fmt.Println("Usage: installer institution <command> [flags] <institution.yaml or institution.json>")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range institutionCommands {
+		fmt.Printf("  %-16s %s\n", command.Name, command.Description)
+	}
+	fmt.Println()
+	fmt.Println("See institution.example.yaml for the format of the spec.")
+	return 2
+}
+
+// Shows the changes applying a spec would make
+func institutionPlanCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	asJSON := false
+
+	flags := flag.NewFlagSet("institution plan", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.BoolVar(&asJSON, "json", asJSON, "print the changes as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: installer institution plan [flags] <institution.yaml or institution.json>")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	spec, ok := loadInstitutionSpec(flags.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	planner := &institutionReconciler{db: db}
+	if err := planner.Reconcile(spec); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if asJSON {
+		changes := planner.changes
+		if changes == nil {
+			changes = []InstitutionChange{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(changes)
+		return 0
+	}
+	printInstitutionChanges(planner)
+	return 0
+}
+
+// Makes the database match a spec (in a transaction, recorded in the runs of the installer)
+func institutionApplyCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	lockTimeout := time.Duration(0)
+
+	flags := flag.NewFlagSet("institution apply", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another migrator to finish (default KUMQUAT_DB_LOCK_TIMEOUT, or 5m)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: installer institution apply [flags] <institution.yaml or institution.json>")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	spec, ok := loadInstitutionSpec(flags.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	job := newInstallJob()
+	job.output = printJobEvents
+	db, _, err := openDatabase(form, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	lock, err := lockMigrations(db, form, lockTimeout, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer lock.Release()
+
+	run := beginInstallerRun(db, "institution apply", false, false, "", job)
+	tx := db.Begin()
+	if tx.Error != nil {
+		run.Finish(db, tx.Error, job)
+		fmt.Println(tx.Error)
+		return 1
+	}
+
+	applier := &institutionReconciler{db: tx, apply: true}
+	if err := applier.Reconcile(spec); err != nil {
+		tx.Rollback()
+		run.Finish(db, err, job)
+		fmt.Printf("%v (nothing was changed)\n", err)
+		return 1
+	}
+	if err := tx.Commit().Error; err != nil {
+		run.Finish(db, err, job)
+		fmt.Printf("can't save the changes: %v\n", err)
+		return 1
+	}
+	run.Finish(db, nil, job)
+
+	printInstitutionChanges(applier)
+	return 0
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+// A spec without problems, like institution.example.yaml
+func testInstitutionSpec() *InstitutionSpec {
+	return &InstitutionSpec{
+		Roles: []RoleSpec{{Name: "Teacher", Permissions: []string{"read", "write"}}},
+		Modules: []ModuleSpec{
+			{Title: "Big Data", Color: "#9C0098", Icon: "fa-cloud", Duration: 12},
+			{Title: "Computer Graphics", Color: "#1A7AB8", Icon: "fa-cube", Duration: 12},
+		},
+		Courses: []CourseSpec{{
+			Title: "BSc (Hons) Applied Computing",
+			Classes: []ClassSpec{{
+				Title: "2016/2017", Start: "2016-09-12", End: "2017-06-30",
+				Levels: []LevelSpec{{
+					Level: 4,
+					Modules: []LevelModuleSpec{
+						{Code: "AC41001", Module: "Big Data"},
+						{Code: "AC41002", Module: "Computer Graphics", Status: "future", Start: "2017-01-16"},
+					},
+				}},
+			}},
+		}},
+	}
+}
+
+func TestValidateInstitutionSpec(t *testing.T) {
+	tests := []struct {
+		change func(*InstitutionSpec)
+		want   []string // Paths of the problems
+	}{
+		{func(*InstitutionSpec) {}, nil},
+		{func(spec *InstitutionSpec) {
+			spec.Roles = append(spec.Roles, RoleSpec{Name: "TEACHER", Permissions: []string{"admin"}})
+		}, []string{"roles[1].name", "roles[1].permissions"}},
+		{func(spec *InstitutionSpec) {
+			spec.Modules[1] = ModuleSpec{Title: "Big Data", Color: "purple", Icon: "cloud"}
+		}, []string{"modules[1].title", "modules[1].color", "modules[1].icon", "modules[1].duration",
+			"courses[0].classes[0].levels[0].modules[1].module"}},
+		{func(spec *InstitutionSpec) {
+			class := &spec.Courses[0].Classes[0]
+			class.End = "2016-01-01"
+			class.Levels[0].Start = "12/09/2016"
+		}, []string{"courses[0].classes[0].end", "courses[0].classes[0].levels[0].start"}},
+		{func(spec *InstitutionSpec) {
+			modules := spec.Courses[0].Classes[0].Levels[0].Modules
+			modules[1].Code = "ac41001"
+			modules[1].Status = "done"
+		}, []string{"courses[0].classes[0].levels[0].modules[1].code", "courses[0].classes[0].levels[0].modules[1].status"}},
+		{func(spec *InstitutionSpec) {
+			spec.Courses = append(spec.Courses, CourseSpec{Title: spec.Courses[0].Title, Classes: []ClassSpec{{Levels: []LevelSpec{{}}}}})
+		}, []string{"courses[1].title", "courses[1].classes[0].title", "courses[1].classes[0].start",
+			"courses[1].classes[0].end", "courses[1].classes[0].levels[0].level"}},
+	}
+	for i, test := range tests {
+		spec := testInstitutionSpec()
+		test.change(spec)
+
+		var paths []string
+		for _, err := range validateInstitutionSpec(spec) {
+			paths = append(paths, strings.SplitN(err.Error(), ":", 2)[0])
+		}
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("test %d: validateInstitutionSpec = %q, want %q", i, paths, test.want)
+		}
+	}
+}
+
+func TestSpecDiff(t *testing.T) {
+	diff := specDiff{}
+	diff.Compare("duration", uint32(12), uint32(12))
+	diff.CompareDate("start", time.Date(2016, 9, 12, 0, 0, 0, 0, time.FixedZone("GMT", 0)).In(time.FixedZone("BST", 3600)),
+		time.Date(2016, 9, 12, 0, 0, 0, 0, time.FixedZone("GMT", 0)))
+	diff.CompareReference("module_id", 3, 3, "Big Data", "Big Data")
+	if len(diff.fields) != 0 || len(diff.updates) != 0 {
+		t.Errorf("the same values differ: %q", diff.fields)
+	}
+
+	end := time.Date(2017, 6, 30, 0, 0, 0, 0, time.FixedZone("GMT", 0))
+	diff.Compare("description", "", "Computing")
+	diff.CompareDate("end", time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC), end)
+	diff.CompareReference("module_id", 3, 0, "Big Data", "Cloud Computing")
+	want := []string{"description  -> Computing", "end 2017-06-01 -> 2017-06-30", "module_id Big Data -> Cloud Computing"}
+	if !reflect.DeepEqual(diff.fields, want) {
+		t.Errorf("specDiff fields = %q, want %q", diff.fields, want)
+	}
+	if updates := (map[string]interface{}{"description": "Computing", "end": end, "module_id": uint32(0)}); !reflect.DeepEqual(diff.updates, updates) {
+		t.Errorf("specDiff updates = %v, want %v", diff.updates, updates)
+	}
+}
+
+// The plan matches the roles like the validation, and names the modules of the level modules
+func TestInstitutionPlan(t *testing.T) {
+	db := openTestDatabase(t, &models.Role{}, &models.Module{}, &models.LevelModule{})
+	gmt := time.FixedZone("GMT", 0)
+	start := time.Date(2016, 9, 12, 0, 0, 0, 0, gmt)
+	for _, record := range []interface{}{
+		&models.Role{Name: "Teacher", CanRead: true},
+		&models.Module{ID: 1, Title: "Big Data", Color: "#9C0098", Icon: "fa-cloud", Duration: 12},
+		&models.LevelModule{Code: "AC41001", Level: 4, ClassID: 1, ModuleID: 1, Status: models.ModuleOngoing, Start: start},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	planner := &institutionReconciler{db: db, modules: map[string]uint32{}}
+	if err := planner.role(RoleSpec{Name: "teacher", Permissions: []string{"read"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.module(ModuleSpec{Title: "Cloud Computing", Color: "#1A7AB8", Icon: "fa-cloud", Duration: 12}); err != nil {
+		t.Fatal(err)
+	}
+	if err := planner.levelModule(models.Class{ID: 1}, 4, start, LevelModuleSpec{Code: "AC41001", Module: "Cloud Computing", Status: "ongoing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []InstitutionChange{
+		{Action: SPEC_UPDATE, Table: "roles", Key: "teacher", Fields: []string{"name Teacher -> teacher"}},
+		{Action: SPEC_CREATE, Table: "modules", Key: "Cloud Computing"},
+		{Action: SPEC_UPDATE, Table: "level_modules", Key: "AC41001", Fields: []string{"module_id Big Data -> Cloud Computing"}},
+	}
+	if !reflect.DeepEqual(planner.changes, want) {
+		t.Errorf("the plan is %+v, want %+v", planner.changes, want)
+	}
+
+	count := 0
+	db.Model(&models.Module{}).Count(&count)
+	if count != 1 {
+		t.Errorf("the plan created %d modules", count-1)
+	}
+}
+
+// The level modules are matched by their code in any case, and keep the stored one
+func TestInstitutionLevelModuleCode(t *testing.T) {
+	db := openTestDatabase(t, &models.LevelModule{})
+	start := time.Date(2016, 9, 12, 0, 0, 0, 0, time.UTC)
+	existing := models.LevelModule{Code: "AC41001", Level: 4, ClassID: 1, ModuleID: 1, Status: models.ModuleOngoing, Start: start}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	reconciler := &institutionReconciler{db: db, apply: true, modules: map[string]uint32{"Big Data": 1}}
+	if err := reconciler.levelModule(models.Class{ID: 1}, 4, start, LevelModuleSpec{Code: "ac41001", Module: "Big Data", Status: "future"}); err != nil {
+		t.Fatal(err)
+	}
+
+	levelModules := []models.LevelModule{}
+	db.Find(&levelModules)
+	if len(levelModules) != 1 || levelModules[0].Code != "AC41001" || levelModules[0].Status != models.ModuleFuture {
+		t.Errorf("the level modules are %+v, want AC41001 in the future", levelModules)
+	}
+}
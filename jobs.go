@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status of an install job
+const (
+	JOB_RUNNING  = "running"
+	JOB_FINISHED = "finished"
+	JOB_FAILED   = "failed"
+	JOB_CANCELED = "canceled"
+)
+
+// Types of the install events
+const (
+	EVENT_PROGRESS = "progress"
+	EVENT_WARNING  = "warning"
+	EVENT_ERROR    = "error"
+	EVENT_DONE     = "done"
+)
+
+// Returned by the job steps once the job is canceled
+var errJobCanceled = errors.New("the installation was canceled")
+
+// InstallEvent is a step reported by a running installation.
+type InstallEvent struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+}
+
+// InstallJob is an installation running in the background.
+//
+// Every event is kept, so a browser that reconnects gets the whole history.
+type InstallJob struct {
+	ID      string
+	Started time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock    sync.Mutex
+	status  string
+	events  []InstallEvent
+	changed chan struct{} // Closed (and replaced) on every new event
+
+	// Writes the events instead of the log (e.g. as JSON lines)
+	output func(event InstallEvent)
+
+	// Address of whoever started the job in the wizard (empty for the commands)
+	Operator string
+
+	// What the installation did, set once it finishes
+	Summary *InstallSummary
+}
+
+var (
+	// Jobs by id (only one runs at a time)
+	installJobs     = map[string]*InstallJob{}
+	installJobsLock sync.Mutex
+
+	// Closed when the server shuts down, so the event streams let go
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+// Creates a new job with a random id
+func newInstallJob() *InstallJob {
+	random := make([]byte, 8)
+	rand.Read(random)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &InstallJob{
+		ID:      hex.EncodeToString(random),
+		Started: time.Now(),
+		ctx:     ctx,
+		cancel:  cancel,
+		status:  JOB_RUNNING,
+		changed: make(chan struct{}),
+	}
+}
+
+// Returns the job with the given id (or nil)
+func findInstallJob(id string) *InstallJob {
+	installJobsLock.Lock()
+	defer installJobsLock.Unlock()
+	return installJobs[id]
+}
+
+// Adds an event and wakes up the streams waiting for it
+func (job *InstallJob) emit(eventType, message string) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.emitLocked(eventType, message)
+}
+
+// Adds an event (the caller holds the lock)
+func (job *InstallJob) emitLocked(eventType, message string) {
+	event := InstallEvent{
+		ID:      len(job.events) + 1,
+		Time:    time.Now(),
+		Type:    eventType,
+		Message: message,
+	}
+	job.events = append(job.events, event)
+
+	if job.output != nil {
+		job.output(event)
+	} else if eventType == EVENT_WARNING {
+		log.Println("Warning: " + message)
+	} else {
+		log.Println(message)
+	}
+
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// Reports a step of the installation
+func (job *InstallJob) Log(format string, args ...interface{}) {
+	job.emit(EVENT_PROGRESS, fmt.Sprintf(format, args...))
+}
+
+// Reports something that went wrong, without stopping the installation
+func (job *InstallJob) Warn(format string, args ...interface{}) {
+	job.emit(EVENT_WARNING, fmt.Sprintf(format, args...))
+}
+
+// Returns errJobCanceled once the job is canceled, the steps check it between changes
+func (job *InstallJob) Err() error {
+	if job.ctx.Err() != nil {
+		return errJobCanceled
+	}
+	return nil
+}
+
+// Asks the job to stop (at the next step)
+func (job *InstallJob) Cancel() {
+	job.cancel()
+}
+
+func (job *InstallJob) Status() string {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	return job.status
+}
+
+// Returns the events after the given one, and a channel closed on the next event
+func (job *InstallJob) EventsAfter(lastID int) ([]InstallEvent, <-chan struct{}) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if lastID < 0 || lastID > len(job.events) {
+		lastID = 0
+	}
+	events := make([]InstallEvent, len(job.events)-lastID)
+	copy(events, job.events[lastID:])
+	return events, job.changed
+}
+
+// Marks the job as completed (with its final event)
+func (job *InstallJob) finish(err error) {
+	status, eventType, message := JOB_FINISHED, EVENT_DONE, "Installation Finished"
+	if err == errJobCanceled {
+		status, eventType, message = JOB_CANCELED, EVENT_ERROR, err.Error()
+	} else if err != nil {
+		status, eventType, message = JOB_FAILED, EVENT_ERROR, err.Error()
+	}
+
+	// The status and the final event change together, so a stream never misses it
+	job.lock.Lock()
+	job.status = status
+	job.emitLocked(eventType, message)
+	job.lock.Unlock()
+
+	job.cancel()
+}
+
+// Creates a job for the wizard and runs the installation in the background.
+//
+// Returns the job that is already running instead, if there is one.
+func startInstallJob(state *WizardState, operator string) *InstallJob {
+	installJobsLock.Lock()
+	for _, job := range installJobs {
+		if job.Status() == JOB_RUNNING {
+			installJobsLock.Unlock()
+			return job
+		}
+	}
+	job := newInstallJob()
+	job.Operator = operator
+	installJobs[job.ID] = job
+	installJobsLock.Unlock()
+
+	// Remembers the job before it starts, so closing the tab doesn't lose it
+	state.JobID = job.ID
+	if err := state.Save(); err != nil {
+		log.Println(err)
+	}
+
+	// Lets a shutdown wait for this installation
+	installsInProgress.Add(1)
+	go func(form url.Values, changed, secrets map[string]bool) {
+		defer installsInProgress.Done()
+
+		err := runInstall(job, form, changed, secrets)
+		job.finish(err)
+
+		// The installation recorded a run (even if it failed)
+		resetInstalledRuns()
+
+		if err == nil {
+			// Notifies the server (without blocking if nobody is waiting)
+			select {
+			case installFinished <- struct{}{}:
+			default:
+			}
+		}
+	}(state.Form(), state.ChangedFields(), state.EnvironmentSecrets())
+
+	return job
+}
+
+// Starts the installation (once every step of the wizard is completed)
+func doInstallHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	state := loadWizardState()
+	if !state.ReadyToInstall() {
+		http.Redirect(w, req, "/step/"+state.CurrentStep().ID, http.StatusSeeOther)
+		return
+	}
+
+	// Only one installation runs at a time, a second click follows the first one
+	job := startInstallJob(state, operatorIP(req))
+	http.Redirect(w, req, "/install/"+job.ID, http.StatusSeeOther)
+}
+
+// Routes /install/<id>, /install/<id>/events, /install/<id>/cancel, /install/<id>/finished and /install/<id>/report
+func installJobHandler(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/install/"), "/"), "/")
+	job := findInstallJob(parts[0])
+	if job == nil {
+		// The job is gone (e.g. the installer was restarted)
+		http.Redirect(w, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "":
+		installProgressHandler(w, req, job)
+	case "events":
+		installEventsHandler(w, req, job)
+	case "cancel":
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		job.Cancel()
+		http.Redirect(w, req, "/install/"+job.ID, http.StatusSeeOther)
+	case "finished":
+		installFinishedHandler(w, req, job)
+	case "report":
+		installReportHandler(w, req, job)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Renders the page following the progress of a job
+func installProgressHandler(w http.ResponseWriter, req *http.Request, job *InstallJob) {
+	headerObj := Header{
+		Title:       "Kumquat Academy - Installer",
+		Description: "Installing",
+		Author:      "Yago Carballo",
+	}
+
+	passedObj := struct {
+		Header *Header
+		Intro  string
+		Job    *InstallJob
+		Status string
+	}{
+		Header: &headerObj,
+		Intro:  "Installing the platform, this can take a few minutes.",
+		Job:    job,
+		Status: job.Status(),
+	}
+
+	templates.ExecuteTemplate(w, "header", headerObj)
+	templates.ExecuteTemplate(w, "installProgressPage", passedObj)
+}
+
+// Streams the job events as Server-Sent Events, starting after the Last-Event-ID (if any)
+func installEventsHandler(w http.ResponseWriter, req *http.Request, job *InstallJob) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID, _ := strconv.Atoi(req.Header.Get("Last-Event-ID"))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for {
+		events, changed := job.EventsAfter(lastID)
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			lastID = event.ID
+		}
+		flusher.Flush()
+
+		// The stream ends with the job
+		if job.Status() != JOB_RUNNING {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		}
+	}
+}
+
+// Lets the event streams go when the server shuts down
+func stopEventStreams() {
+	shuttingDownOnce.Do(func() {
+		close(shuttingDown)
+	})
+}
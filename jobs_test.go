@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// A browser that reconnects gets the events it missed (all of them, if it asks for ids the job doesn't have)
+func TestInstallJobEventsAfter(t *testing.T) {
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+	for _, message := range []string{"Connected", "Created the tables", "Created the admin"} {
+		job.Log("%s", message)
+	}
+
+	tests := []struct {
+		lastID int
+		want   []int // Ids of the events returned
+	}{
+		{0, []int{1, 2, 3}},
+		{1, []int{2, 3}},
+		{3, []int{}},
+		{4, []int{1, 2, 3}},
+		{-1, []int{1, 2, 3}},
+	}
+	for _, test := range tests {
+		events, _ := job.EventsAfter(test.lastID)
+		ids := []int{}
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("EventsAfter(%d) = %v, want %v", test.lastID, ids, test.want)
+		}
+	}
+
+	// The events returned are a copy, and the channel is closed by the next event
+	events, changed := job.EventsAfter(0)
+	events[0].Message = "changed"
+	select {
+	case <-changed:
+		t.Errorf("the channel is closed before the next event")
+	default:
+	}
+	job.Warn("The mail server isn't set")
+	select {
+	case <-changed:
+	default:
+		t.Errorf("the channel isn't closed by the next event")
+	}
+	if events, _ := job.EventsAfter(0); events[0].Message != "Connected" || len(events) != 4 {
+		t.Errorf("the events are %+v after changing a copy", events)
+	}
+}
+
+func TestInstallJobFinish(t *testing.T) {
+	tests := []struct {
+		err       error
+		status    string
+		eventType string
+		message   string
+	}{
+		{nil, JOB_FINISHED, EVENT_DONE, "Installation Finished"},
+		{errJobCanceled, JOB_CANCELED, EVENT_ERROR, errJobCanceled.Error()},
+		{errors.New("can't create the tables"), JOB_FAILED, EVENT_ERROR, "can't create the tables"},
+	}
+	for _, test := range tests {
+		job := newInstallJob()
+		job.output = func(InstallEvent) {}
+		job.Log("Connected")
+		_, changed := job.EventsAfter(1)
+
+		job.finish(test.err)
+		events, _ := job.EventsAfter(1)
+		if job.Status() != test.status || len(events) != 1 || events[0].Type != test.eventType || events[0].Message != test.message {
+			t.Errorf("finish(%v) = %s with %+v, want %s with a %s event %q", test.err, job.Status(), events, test.status, test.eventType, test.message)
+		}
+		select {
+		case <-changed:
+		default:
+			t.Errorf("finish(%v) didn't wake up the streams", test.err)
+		}
+		if job.Err() != errJobCanceled {
+			t.Errorf("finish(%v) left the job running", test.err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Size of the generated RSA keys
+const KEY_BITS = 2048
+
+// Generates the RSA key pair used by the API to sign the sessions.
+//
+// Existing keys are kept, so re-running the installer doesn't log everyone out.
+func generateKeys(privateKeyPath, publicKeyPath string) error {
+	_, privateErr := os.Stat(privateKeyPath)
+	_, publicErr := os.Stat(publicKeyPath)
+	if privateErr == nil && publicErr == nil {
+		log.Printf("Keeping the existing keys { private: %s, public: %s }", privateKeyPath, publicKeyPath)
+		return nil
+	}
+
+	// A lone key is never overwritten, the other half has to be restored (or the key removed)
+	if privateErr == nil {
+		return fmt.Errorf("can't generate the keys: the private key %s exists without the public key %s", privateKeyPath, publicKeyPath)
+	}
+	if publicErr == nil {
+		return fmt.Errorf("can't generate the keys: the public key %s exists without the private key %s", publicKeyPath, privateKeyPath)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, KEY_BITS)
+	if err != nil {
+		return err
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	privatePem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	publicPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	for _, path := range []string{privateKeyPath, publicKeyPath} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+	}
+
+	// The private key is only readable by its owner
+	if err := ioutil.WriteFile(privateKeyPath, privatePem, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(publicKeyPath, publicPem, 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Generated the keys { private: %s, public: %s }", privateKeyPath, publicKeyPath)
+	return nil
+}
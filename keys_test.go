@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The existing keys are kept, a lone one is never overwritten
+func TestGenerateKeys(t *testing.T) {
+	tests := []struct {
+		existing []string // Keys written before
+		fails    bool
+	}{
+		{nil, false},
+		{[]string{"private.pem", "public.pub"}, false},
+		{[]string{"private.pem"}, true},
+		{[]string{"public.pub"}, true},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, name := range test.existing {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := generateKeys(filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pub"))
+		if (err != nil) != test.fails {
+			t.Errorf("generateKeys with %q: %v", test.existing, err)
+		}
+		for _, name := range test.existing {
+			if content, _ := ioutil.ReadFile(filepath.Join(dir, name)); !bytes.Equal(content, []byte(name)) {
+				t.Errorf("generateKeys with %q overwrote %s", test.existing, name)
+			}
+		}
+	}
+}
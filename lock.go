@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Name of the lock every migrator takes
+const MIGRATION_LOCK = "kumquat-academy-migrate"
+
+// Default time to wait for another migrator
+const DEFAULT_LOCK_TIMEOUT = 5 * time.Minute
+
+// How often a busy lock is tried again
+const LOCK_RETRY_INTERVAL = time.Second
+
+// MigrationLock keeps other installers (e.g. other replicas) from migrating at the same time.
+//
+// MySQL and Postgres use advisory locks (released if the installer dies with its
+// connection), SQLite a lock file next to the database.
+type MigrationLock struct {
+	release func()
+}
+
+// Waits for the migration lock (up to the timeout), reporting who holds it.
+//
+// The lock file is only used by SQLite.
+func acquireMigrationLock(db *gorm.DB, lockFile string, timeout time.Duration, job *InstallJob) (*MigrationLock, error) {
+	switch dialect := db.Dialect().GetName(); dialect {
+	case "mysql":
+		return acquireDatabaseLock(db, timeout, job,
+			"SELECT GET_LOCK(?, 0)",
+			"SELECT RELEASE_LOCK(?)",
+			MIGRATION_LOCK,
+			mysqlLockHolder,
+		)
+	case "postgres":
+		return acquireDatabaseLock(db, timeout, job,
+			"SELECT pg_try_advisory_lock($1)",
+			"SELECT pg_advisory_unlock($1)",
+			postgresLockKey(),
+			postgresLockHolder,
+		)
+	case "sqlite3":
+		if lockFile == "" {
+			return nil, fmt.Errorf("the SQLite database has no path to lock")
+		}
+		return acquireFileLock(lockFile, timeout, job)
+	default:
+		return nil, fmt.Errorf("the %s database has no migration lock", dialect)
+	}
+}
+
+// Takes the migration lock of the database described by the wizard values
+// (KUMQUAT_DB_LOCK_TIMEOUT sets how long it waits)
+func lockMigrations(db *gorm.DB, form url.Values, timeout time.Duration, job *InstallJob) (*MigrationLock, error) {
+	if timeout == 0 {
+		timeout = DEFAULT_LOCK_TIMEOUT
+		if value := form.Get("db-lock-timeout"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid db-lock-timeout %q, use a duration like 5m", value)
+			}
+			timeout = parsed
+		}
+	}
+
+	lockFile := ""
+	if sqlitePath := form.Get("sqlite-path"); sqlitePath != "" {
+		lockFile = sqlitePath + ".lock"
+	}
+	return acquireMigrationLock(db, lockFile, timeout, job)
+}
+
+// Releases the lock
+func (lock *MigrationLock) Release() {
+	lock.release()
+}
+
+// Tries to take the lock until it works, or the timeout runs out
+func waitForLock(timeout time.Duration, job *InstallJob, try func() (bool, error), holder func() string) error {
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		acquired, err := try()
+		if err != nil {
+			return fmt.Errorf("can't take the migration lock: %v", err)
+		}
+		if acquired {
+			job.Log("Took the migration lock %s", MIGRATION_LOCK)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the migration lock is held by %s, and it wasn't released after %s", holder(), timeout)
+		}
+		if attempt == 1 {
+			job.Log("Another installer is migrating (%s), waiting up to %s for it", holder(), timeout)
+		}
+
+		select {
+		case <-time.After(LOCK_RETRY_INTERVAL):
+		case <-job.ctx.Done():
+			return errJobCanceled
+		}
+	}
+}
+
+// Takes an advisory lock, on a connection of its own (the lock belongs to it)
+func acquireDatabaseLock(db *gorm.DB, timeout time.Duration, job *InstallJob, lockQuery, unlockQuery string, key interface{}, holder func(*sql.Conn, interface{}) string) (*MigrationLock, error) {
+	conn, err := db.DB().Conn(job.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	try := func() (bool, error) {
+		var acquired sql.NullBool
+		err := conn.QueryRowContext(job.ctx, lockQuery, key).Scan(&acquired)
+		return acquired.Bool, err
+	}
+	describeHolder := func() string {
+		return holder(conn, key)
+	}
+
+	if err := waitForLock(timeout, job, try, describeHolder); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &MigrationLock{release: func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Closing the connection releases it anyway
+		conn.ExecContext(ctx, unlockQuery, key)
+		conn.Close()
+	}}, nil
+}
+
+// Describes the MySQL connection holding the lock
+func mysqlLockHolder(conn *sql.Conn, key interface{}) string {
+	var id sql.NullInt64
+	if err := conn.QueryRowContext(context.Background(), "SELECT IS_USED_LOCK(?)", key).Scan(&id); err != nil || !id.Valid {
+		return "an unknown connection"
+	}
+
+	var user, host string
+	var seconds int64
+	err := conn.QueryRowContext(context.Background(),
+		"SELECT USER, HOST, TIME FROM information_schema.PROCESSLIST WHERE ID = ?", id.Int64,
+	).Scan(&user, &host, &seconds)
+	if err != nil {
+		return fmt.Sprintf("the connection %d", id.Int64)
+	}
+	return fmt.Sprintf("the connection %d (%s@%s, for %ds)", id.Int64, user, host, seconds)
+}
+
+// Returns the key of the Postgres advisory lock (a hash of its name)
+func postgresLockKey() int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(MIGRATION_LOCK))
+	return int64(hash.Sum64())
+}
+
+// Describes the Postgres backend holding the lock
+func postgresLockHolder(conn *sql.Conn, key interface{}) string {
+	lockKey := uint64(key.(int64))
+
+	var pid int64
+	var user, address, application sql.NullString
+	var since sql.NullTime
+	err := conn.QueryRowContext(context.Background(), `
+		SELECT a.pid, a.usename, host(a.client_addr), a.application_name, a.backend_start
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.granted AND l.classid = $1 AND l.objid = $2 AND l.objsubid = 1`,
+		int64(lockKey>>32), int64(lockKey&0xffffffff),
+	).Scan(&pid, &user, &address, &application, &since)
+	if err != nil {
+		return "an unknown backend"
+	}
+	return fmt.Sprintf("the backend %d (%s@%s %s, since %s)", pid, user.String, address.String, application.String, since.Time.Format(time.RFC3339))
+}
+
+// Describes this installer, written to the lock file
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("pid %d on %s, since %s", os.Getpid(), host, time.Now().Format(time.RFC3339))
+}
+
+// Takes the lock file (see filelock_unix.go and filelock_other.go)
+func acquireFileLock(path string, timeout time.Duration, job *InstallJob) (*MigrationLock, error) {
+	var file *os.File
+	try := func() (bool, error) {
+		var err error
+		file, err = tryLockFile(path)
+		return file != nil, err
+	}
+	holder := func() string {
+		content, err := os.ReadFile(path)
+		if err != nil || len(content) == 0 {
+			return "an unknown process"
+		}
+		return string(content)
+	}
+
+	if err := waitForLock(timeout, job, try, holder); err != nil {
+		return nil, err
+	}
+
+	file.Truncate(0)
+	file.WriteAt([]byte(lockOwner()), 0)
+	return &MigrationLock{release: func() {
+		unlockFile(path, file)
+	}}, nil
+}
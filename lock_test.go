@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForLock(t *testing.T) {
+	failed := errors.New("connection lost")
+	tests := []struct {
+		tries    []bool // Results of the attempts, the last one repeats
+		err      error
+		timeout  time.Duration
+		attempts int
+		want     string // Start of the error
+	}{
+		{[]bool{true}, nil, time.Minute, 1, ""},
+		{[]bool{false, true}, nil, time.Minute, 2, ""},
+		{[]bool{false}, nil, 0, 1, "the migration lock is held by pid 1 on db"},
+		{[]bool{false}, failed, time.Minute, 1, "can't take the migration lock: connection lost"},
+	}
+	for _, test := range tests {
+		job := newInstallJob()
+		job.output = func(InstallEvent) {}
+		attempts := 0
+		try := func() (bool, error) {
+			acquired := test.tries[len(test.tries)-1]
+			if attempts < len(test.tries) {
+				acquired = test.tries[attempts]
+			}
+			attempts++
+			return acquired, test.err
+		}
+
+		err := waitForLock(test.timeout, job, try, func() string { return "pid 1 on db" })
+		if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.HasPrefix(err.Error(), test.want)) {
+			t.Errorf("waitForLock(%v) = %v, want %q", test.tries, err, test.want)
+		}
+		if attempts != test.attempts {
+			t.Errorf("waitForLock(%v) tried %d times, want %d", test.tries, attempts, test.attempts)
+		}
+	}
+
+	// A canceled job stops waiting
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+	job.cancel()
+	err := waitForLock(time.Minute, job, func() (bool, error) { return false, nil }, func() string { return "pid 1 on db" })
+	if !errors.Is(err, errJobCanceled) {
+		t.Errorf("the wait of a canceled job = %v, want %v", err, errJobCanceled)
+	}
+}
+
+// The lock file of SQLite is taken once, and says who holds it
+func TestLockMigrationsSQLite(t *testing.T) {
+	db := openTestDatabaseFile(t)
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+	path := filepath.Join(t.TempDir(), "kumquat.db")
+
+	tests := []struct {
+		form url.Values
+		want string // Start of the error
+	}{
+		{url.Values{"sqlite-path": {path}, "db-lock-timeout": {"five minutes"}}, `invalid db-lock-timeout "five minutes"`},
+		{url.Values{"db-lock-timeout": {"1s"}}, "the SQLite database has no path to lock"},
+		{url.Values{"sqlite-path": {path}, "db-lock-timeout": {"0s"}}, "the migration lock is held by pid "},
+	}
+
+	lock, err := lockMigrations(db, url.Values{"sqlite-path": {path}}, 0, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if _, err := lockMigrations(db, test.form, 0, job); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("lockMigrations(%v) = %v, want %q", test.form, err, test.want)
+		}
+	}
+
+	// Free again once released
+	lock.Release()
+	lock, err = lockMigrations(db, url.Values{"sqlite-path": {path}}, time.Second, job)
+	if err != nil {
+		t.Fatalf("the released lock can't be taken: %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Exit codes of the migrate command
+const (
+	EXIT_NOTHING_TO_DO = 0
+	EXIT_FAILED        = 1
+	EXIT_USAGE         = 2
+	EXIT_APPLIED       = 3
+)
+
+// Results of the migrate command
+const (
+	MIGRATE_NOTHING_TO_DO = "nothing-to-do"
+	MIGRATE_APPLIED       = "applied"
+	MIGRATE_FAILED        = "failed"
+)
+
+// MigrateResult is written to the result file once the migrate command finishes.
+type MigrateResult struct {
+	Result     string    `json:"result"`
+	ExitCode   int       `json:"exit_code"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	DurationMS int64     `json:"duration_ms"`
+	Changes    []string  `json:"changes"`
+	Backup     string    `json:"backup,omitempty"`
+	SeededRows int64     `json:"seeded_rows"`
+	Warnings   []string  `json:"warnings"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// A log line of the migrate command (with --log-format json)
+type migrateLogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// Counts the rows of every table (to tell if the seeding inserted anything)
+func countSchemaRows(db *gorm.DB) int64 {
+	var total int64
+	for _, table := range schemaTables {
+		var count int64
+		if db.Dialect().HasTable(table.Name(db)) && db.Model(table.Model).Count(&count).Error == nil {
+			total += count
+		}
+	}
+	return total
+}
+
+// Migrates the schema (and seeds the demo data) of the installation, without the wizard
+func migrate(job *InstallJob, settingsPath string, seed bool, lockTimeout time.Duration, result *MigrateResult) (err error) {
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		return err
+	}
+
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	// Only one replica migrates, the rest wait and then find nothing to do
+	lock, err := lockMigrations(db, form, lockTimeout, job)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// The 2015 layout needs the upgrade, migrating it would leave sessions.ip behind
+	if isLegacySchema(db) {
+		return legacySchemaError()
+	}
+
+	result.Changes = pendingSchemaChanges(db)
+
+	run := beginInstallerRun(db, "migrate", true, seed, "", job)
+	defer func() { run.Finish(db, err, job) }()
+
+	// Backs up the tables before changing them (nothing is backed up when there is nothing to do)
+	if (len(result.Changes) > 0 || seed) && form.Get("db-backup") == "on" {
+		if result.Backup, err = backupDatabase(db, config.Name, backupDir(form), job); err != nil {
+			return err
+		}
+		run.Backup = result.Backup
+	}
+
+	if len(result.Changes) == 0 {
+		job.Log("The schema is up to date")
+	} else {
+		for _, change := range result.Changes {
+			job.Log("Pending: %s", change)
+		}
+		if err := migrateSchema(db, job); err != nil {
+			return err
+		}
+	}
+
+	if seed {
+		before := countSchemaRows(db)
+		if _, err := seedDemoData(db, job); err != nil {
+			return err
+		}
+		result.SeededRows = countSchemaRows(db) - before
+	}
+
+	return job.Err()
+}
+
+// Runs the migrations and exits, for init containers, Helm hooks and CI jobs.
+//
+// Exits with 0 when there was nothing to do, 3 once the changes are applied and 1 if it failed.
+func migrateCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	seed := false
+	resultPath := ""
+	logFormat := "json"
+	lockTimeout := time.Duration(0)
+	appliedCode := EXIT_APPLIED
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.BoolVar(&seed, "seed", seed, "also insert the demo data")
+	flags.StringVar(&resultPath, "result-file", resultPath, "file the JSON result is written to")
+	flags.StringVar(&logFormat, "log-format", logFormat, "format of the logs (json or text)")
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another migrator to finish (default KUMQUAT_DB_LOCK_TIMEOUT, or 5m)")
+	flags.IntVar(&appliedCode, "applied-exit-code", appliedCode, "exit code once changes are applied (0 for init containers)")
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if logFormat != "json" && logFormat != "text" {
+		fmt.Fprintf(os.Stderr, "invalid --log-format %q, use json or text\n", logFormat)
+		return EXIT_USAGE
+	}
+
+	result := &MigrateResult{Started: time.Now(), Changes: []string{}, Warnings: []string{}}
+
+	job := newInstallJob()
+	encoder := json.NewEncoder(os.Stdout)
+	job.output = func(event InstallEvent) {
+		level := "info"
+		switch event.Type {
+		case EVENT_WARNING:
+			level = "warning"
+			result.Warnings = append(result.Warnings, event.Message)
+		case EVENT_ERROR:
+			level = "error"
+		}
+
+		if logFormat == "json" {
+			encoder.Encode(migrateLogLine{Time: event.Time, Level: level, Message: event.Message})
+		} else {
+			fmt.Printf("%s [%s] %s\n", event.Time.Format(time.RFC3339), level, event.Message)
+		}
+	}
+
+	// The demo data copies the bundled avatars
+	err := loadAssets(os.Getenv("KUMQUAT_INSTALLER_ASSETS"))
+	if err == nil {
+		err = migrate(job, settingsPath, seed, lockTimeout, result)
+	}
+	if err != nil {
+		result.Result, result.ExitCode, result.Error = MIGRATE_FAILED, EXIT_FAILED, err.Error()
+	} else if len(result.Changes) == 0 && result.SeededRows == 0 {
+		result.Result, result.ExitCode = MIGRATE_NOTHING_TO_DO, EXIT_NOTHING_TO_DO
+	} else {
+		result.Result, result.ExitCode = MIGRATE_APPLIED, appliedCode
+	}
+	if err != nil {
+		job.emit(EVENT_ERROR, err.Error())
+	} else {
+		job.Log("Migration finished: %s", result.Result)
+	}
+
+	result.Finished = time.Now()
+	result.DurationMS = result.Finished.Sub(result.Started).Milliseconds()
+
+	if resultPath != "" {
+		content, _ := json.MarshalIndent(result, "", "  ")
+		if err := ioutil.WriteFile(resultPath, append(content, '\n'), 0644); err != nil {
+			job.emit(EVENT_ERROR, fmt.Sprintf("can't write the result to %s: %v", resultPath, err))
+			return EXIT_FAILED
+		}
+	}
+
+	return result.ExitCode
+}
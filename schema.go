@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+// A foreign key created by the installer.
+//
+// The single column keys are named by gorm (e.g. sessions_user_id_users_id_foreign),
+// the composite ones have an explicit Name.
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// A unique index created by the installer
+type UniqueIndex struct {
+	Name    string
+	Columns []string
+}
+
+// A table created by the installer, with its indexes and foreign keys
+type SchemaTable struct {
+	Model         interface{}
+	UniqueIndexes []UniqueIndex
+	ForeignKeys   []ForeignKey
+}
+
+// Builds a single column foreign key (referencing a single column)
+func foreignKey(column, refTable, refColumn string) ForeignKey {
+	return ForeignKey{Columns: []string{column}, RefTable: refTable, RefColumns: []string{refColumn}}
+}
+
+// Returns the reference in the format gorm expects (e.g. "users(id)")
+func (key ForeignKey) Dest() string {
+	return fmt.Sprintf("%s(%s)", key.RefTable, strings.Join(key.RefColumns, ", "))
+}
+
+// Returns the name of the key in the database (the one gorm gives it, for the single column keys)
+func (key ForeignKey) KeyName(db *gorm.DB, table string) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return db.Dialect().BuildKeyName(table, key.Columns[0], key.Dest(), "foreign")
+}
+
+// Describes the key for the progress messages (e.g. "sessions(user_id) -> users(id)")
+func (key ForeignKey) Describe(table string) string {
+	return fmt.Sprintf("%s(%s) -> %s", table, strings.Join(key.Columns, ", "), key.Dest())
+}
+
+// The tables of the platform, in the order they have to be created
+// (every table comes after the ones it references).
+var schemaTables = []SchemaTable{
+	{Model: &models.User{}},
+	{
+		Model:       &models.Session{},
+		ForeignKeys: []ForeignKey{foreignKey("user_id", "users", "id")},
+	},
+	{Model: &models.Course{}},
+	{
+		Model:         &models.Class{},
+		UniqueIndexes: []UniqueIndex{{Name: "idx_class_course_title", Columns: []string{"course_id", "title"}}},
+		ForeignKeys:   []ForeignKey{foreignKey("course_id", "courses", "id")},
+	},
+	{
+		Model: &models.CourseLevel{},
+		ForeignKeys: []ForeignKey{
+			{Name: "fk_courseLevels_classes", Columns: []string{"class_id", "course_id"}, RefTable: "classes", RefColumns: []string{"id", "course_id"}},
+		},
+	},
+	{Model: &models.Module{}},
+	{Model: &models.Role{}},
+	{
+		Model: &models.LevelModule{},
+		ForeignKeys: []ForeignKey{
+			{Name: "fk_levelModules_courseLevels_course_class", Columns: []string{"level", "class_id"}, RefTable: "course_levels", RefColumns: []string{"level", "class_id"}},
+			foreignKey("module_id", "modules", "id"),
+		},
+	},
+	{
+		Model: &models.UserModule{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("module_code", "level_modules", "code"),
+			foreignKey("role_id", "roles", "id"),
+			foreignKey("class_id", "classes", "id"),
+		},
+	},
+	{
+		Model: &models.UserCourse{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("course_id", "courses", "id"),
+			foreignKey("role_id", "roles", "id"),
+		},
+	},
+	{Model: &models.Attachment{}},
+	{
+		Model:       &models.Assignment{},
+		ForeignKeys: []ForeignKey{foreignKey("module_code", "level_modules", "code")},
+	},
+	{
+		Model: &models.Exam{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("module_code", "level_modules", "code"),
+			foreignKey("attachment_id", "attachments", "id"),
+		},
+	},
+	{
+		Model:       &models.Page{},
+		ForeignKeys: []ForeignKey{foreignKey("module_id", "modules", "id")},
+	},
+	{
+		Model:       &models.LectureSlot{},
+		ForeignKeys: []ForeignKey{foreignKey("module_id", "modules", "id")},
+	},
+	{
+		Model:       &models.Lecture{},
+		ForeignKeys: []ForeignKey{foreignKey("module_id", "modules", "id")},
+	},
+	{
+		Model: &models.Materials{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("module_id", "modules", "id"),
+			foreignKey("lecture_id", "lectures", "id"),
+			foreignKey("attachment_id", "attachments", "id"),
+		},
+	},
+	{
+		Model: &models.Submission{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("assignment_id", "assignments", "id"),
+			foreignKey("attachment_id", "attachments", "id"),
+		},
+	},
+	{
+		Model: &models.StudentExam{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("exam_id", "exams", "id"),
+		},
+	},
+	{
+		Model: &models.Announcement{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("module_id", "modules", "id"),
+			foreignKey("assignment_id", "assignments", "id"),
+			foreignKey("course_id", "courses", "id"),
+		},
+	},
+	{
+		Model:       &models.Team{},
+		ForeignKeys: []ForeignKey{foreignKey("assignment_id", "assignments", "id")},
+	},
+	{
+		Model: &models.TeamMember{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("team_id", "teams", "id"),
+			foreignKey("user_id", "users", "id"),
+		},
+	},
+	{
+		Model:       &models.Task{},
+		ForeignKeys: []ForeignKey{foreignKey("assignment_id", "assignments", "id")},
+	},
+	{
+		Model: &models.CompletedTask{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("user_id", "users", "id"),
+			foreignKey("task_id", "tasks", "id"),
+		},
+	},
+	{
+		Model: &models.TeamCompletedTask{},
+		ForeignKeys: []ForeignKey{
+			foreignKey("team_id", "teams", "id"),
+			foreignKey("task_id", "tasks", "id"),
+		},
+	},
+	{
+		Model:       &models.ResetPassword{},
+		ForeignKeys: []ForeignKey{foreignKey("user_id", "users", "id")},
+	},
+}
+
+// Returns the name of the table the model is stored in
+func (table SchemaTable) Name(db *gorm.DB) string {
+	return db.NewScope(table.Model).TableName()
+}
+
+// Lists what migrateSchema would change (empty when the schema is up to date)
+func pendingSchemaChanges(db *gorm.DB) []string {
+	dialect := db.Dialect()
+	changes := []string{}
+	for _, table := range schemaTables {
+		tableName := table.Name(db)
+		if !dialect.HasTable(tableName) {
+			changes = append(changes, "create table "+tableName)
+			continue
+		}
+
+		for _, field := range db.NewScope(table.Model).GetModelStruct().StructFields {
+			if field.IsNormal && !field.IsIgnored && !dialect.HasColumn(tableName, field.DBName) {
+				changes = append(changes, fmt.Sprintf("add column %s.%s", tableName, field.DBName))
+			}
+		}
+
+		for _, index := range table.UniqueIndexes {
+			if existing, err := inspectIndex(db, tableName, index.Name); err == nil && existing == nil {
+				changes = append(changes, fmt.Sprintf("add unique index %s on %s", index.Name, tableName))
+			}
+		}
+
+		// SQLite can't add keys to existing tables, so they aren't pending there
+		for _, key := range table.ForeignKeys {
+			if dialect.GetName() == "sqlite3" {
+				break
+			}
+			if existing, err := inspectForeignKey(db, tableName, key, key.KeyName(db, tableName)); err == nil && existing == nil {
+				changes = append(changes, "add foreign key "+key.Describe(tableName))
+			}
+		}
+	}
+	return changes
+}
+
+// Creates or Migrates every table (with its indexes and foreign keys),
+// reporting each change to the job.
+//
+// Indexes and keys that exist already are skipped, so it can run again. A table that
+// can't be created stops the migration, an index or a key that can't be added (or
+// that exists with another definition) is only a warning.
+func migrateSchema(db *gorm.DB, job *InstallJob) error {
+	for _, table := range schemaTables {
+		if err := job.Err(); err != nil {
+			return err
+		}
+
+		tableName := table.Name(db)
+
+		// Creates or Migrates the table if it does't exist or changed
+		existed := db.Dialect().HasTable(tableName)
+
+		// SQLite only creates foreign keys with the table, so it's created with them first
+		if !existed && db.Dialect().GetName() == "sqlite3" && len(table.ForeignKeys) > 0 {
+			statement, _ := renderCreateTable(db, table)
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("can't create the table %s: %v", tableName, err)
+			}
+		}
+		if err := db.Set("gorm:table_options", tableOptions(db)).AutoMigrate(table.Model).Error; err != nil {
+			return fmt.Errorf("can't create the table %s: %v", tableName, err)
+		}
+		if existed {
+			job.Log("Migrated table %s", tableName)
+		} else {
+			job.Log("Created table %s", tableName)
+		}
+
+		for _, index := range table.UniqueIndexes {
+			addUniqueIndex(db, table, tableName, index, job)
+		}
+
+		for _, key := range table.ForeignKeys {
+			addForeignKey(db, table, tableName, key, job)
+		}
+	}
+
+	return nil
+}
+
+// Adds a unique index, unless it exists already
+func addUniqueIndex(db *gorm.DB, table SchemaTable, tableName string, index UniqueIndex, job *InstallJob) {
+	existing, err := inspectIndex(db, tableName, index.Name)
+	if err != nil {
+		job.Warn("Can't inspect the unique index %s: %v", index.Name, err)
+		return
+	}
+	if existing != nil {
+		if !existing.Matches(index) {
+			job.Warn("The index %s on %s(%s) exists with another definition (%s, unique: %t), fix it by hand",
+				index.Name, tableName, strings.Join(index.Columns, ", "), strings.Join(existing.Columns, ", "), existing.Unique)
+		}
+		return
+	}
+
+	if err := db.Model(table.Model).AddUniqueIndex(index.Name, index.Columns...).Error; err != nil {
+		job.Warn("Can't add the unique index %s: %v", index.Name, err)
+		return
+	}
+	job.Log("Added unique index %s on %s(%s)", index.Name, tableName, strings.Join(index.Columns, ", "))
+}
+
+// Adds a foreign key, unless it exists already
+func addForeignKey(db *gorm.DB, table SchemaTable, tableName string, key ForeignKey, job *InstallJob) {
+	keyName := key.KeyName(db, tableName)
+	existing, err := inspectForeignKey(db, tableName, key, keyName)
+	if err != nil {
+		job.Warn("Can't inspect the foreign key %s: %v", keyName, err)
+		return
+	}
+	if existing != nil {
+		if !existing.Matches(key) {
+			job.Warn("The foreign key %s exists as %s, expected %s, fix it by hand",
+				keyName, existing.Describe(tableName), key.Describe(tableName))
+		}
+		return
+	}
+
+	// SQLite only creates foreign keys with the table (see migrateSchema), so only the tables created before lack them
+	if db.Dialect().GetName() == "sqlite3" {
+		job.Warn("Can't add the foreign key %s: SQLite can't add keys to existing tables", key.Describe(tableName))
+		return
+	}
+
+	if key.Name == "" {
+		err = db.Model(table.Model).AddForeignKey(key.Columns[0], key.Dest(), "RESTRICT", "RESTRICT").Error
+	} else {
+		err = db.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s;",
+			tableName, key.Name, strings.Join(key.Columns, ", "), key.Dest(),
+		)).Error
+	}
+	if err != nil {
+		job.Warn("Can't add the foreign key %s: %v", key.Describe(tableName), err)
+		return
+	}
+	job.Log("Added foreign key %s", key.Describe(tableName))
+}
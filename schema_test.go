@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Opens a SQLite database in a file of the test, with the tables of the given models
+func openTestDatabaseFile(t *testing.T, tables ...interface{}) *gorm.DB {
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "kumquat.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	if err := db.AutoMigrate(tables...).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Runs migrateSchema, returning its warnings
+func migrateTestSchema(t *testing.T, db *gorm.DB) []string {
+	warnings := []string{}
+	job := newInstallJob()
+	job.output = func(event InstallEvent) {
+		if event.Type == EVENT_WARNING {
+			warnings = append(warnings, event.Message)
+		}
+	}
+	if err := migrateSchema(db, job); err != nil {
+		t.Fatal(err)
+	}
+	return warnings
+}
+
+// SQLite creates the foreign keys with the tables, only the tables created before lack them
+func TestMigrateSchemaSQLiteForeignKeys(t *testing.T) {
+	db := openTestDatabaseFile(t)
+	if warnings := migrateTestSchema(t, db); len(warnings) > 0 {
+		t.Errorf("a new database warns: %q", warnings)
+	}
+	if pending := pendingSchemaChanges(db); len(pending) > 0 {
+		t.Errorf("a new database has pending changes: %q", pending)
+	}
+	if differences, err := diffSchema(db); err != nil || len(differences) > 0 {
+		t.Errorf("a new database differs from the schema: %+v (%v)", differences, err)
+	}
+
+	db = openTestDatabaseFile(t, &models.User{}, &models.Session{})
+	warnings := migrateTestSchema(t, db)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "sessions(user_id) -> users(id)") {
+		t.Errorf("the sessions table created before warns %q", warnings)
+	}
+
+	// verify-schema agrees with pendingSchemaChanges, the missing key is only reported
+	differences, err := diffSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	differences, missingKeys := splitSQLiteForeignKeys("sqlite3", differences)
+	if len(differences) > 0 || len(missingKeys) != 1 || missingKeys[0].Table != "sessions" {
+		t.Errorf("the database differs in %+v, missing the keys %+v", differences, missingKeys)
+	}
+	if pending := pendingSchemaChanges(db); len(pending) > 0 {
+		t.Errorf("the database has pending changes: %q", pending)
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Kinds of schema differences
+const (
+	SCHEMA_MISSING = "missing" // The installer creates it, the database doesn't have it
+	SCHEMA_EXTRA   = "extra"   // The database has it, the installer doesn't create it
+	SCHEMA_CHANGED = "changed" // Both have it, with another definition
+)
+
+// TableSchema is a table as the installer creates it (or as the database has it).
+type TableSchema struct {
+	Name        string
+	Columns     []CatalogColumn
+	Indexes     []CatalogIndex // Unique columns have an index without name
+	ForeignKeys []ForeignKey
+}
+
+// SchemaDifference is something the database has different from the installer.
+type SchemaDifference struct {
+	Table    string
+	Object   string // table, column, index or foreign key
+	Name     string
+	Change   string
+	Expected string
+	Found    string
+}
+
+// Words that end the type in a column definition (e.g. "int unsigned AUTO_INCREMENT")
+var columnTypeEnd = map[string]bool{
+	"auto_increment": true, "autoincrement": true, "not": true, "null": true,
+	"unique": true, "default": true, "primary": true, "comment": true, "references": true,
+}
+
+var (
+	integerWidthPattern = regexp.MustCompile(`\b(smallint|mediumint|int|bigint)\(\d+\)`)
+	tinyintWidthPattern = regexp.MustCompile(`\btinyint\((\d+)\)`)
+)
+
+// Normalizes a column type, so the one gorm declares and the one the database reports compare equal
+func normalizeColumnType(dialect, definition string) string {
+	words := []string{}
+	for _, word := range strings.Fields(strings.ToLower(definition)) {
+		if columnTypeEnd[word] {
+			break
+		}
+		words = append(words, word)
+	}
+	columnType := strings.Join(words, " ")
+
+	switch dialect {
+	case "mysql":
+		// MySQL 5 shows display widths (int(10) unsigned), MySQL 8 doesn't
+		columnType = integerWidthPattern.ReplaceAllString(columnType, "$1")
+		columnType = tinyintWidthPattern.ReplaceAllStringFunc(columnType, func(match string) string {
+			if match == "tinyint(1)" {
+				return match
+			}
+			return "tinyint"
+		})
+		switch columnType {
+		case "boolean", "bool":
+			columnType = "tinyint(1)"
+		case "integer":
+			columnType = "int"
+		}
+	case "postgres":
+		columnType = strings.Replace(columnType, "character varying", "varchar", 1)
+		switch columnType {
+		case "serial":
+			columnType = "integer"
+		case "bigserial":
+			columnType = "bigint"
+		}
+	}
+	return columnType
+}
+
+// Describes a column (e.g. "varchar(255) NOT NULL")
+func (column CatalogColumn) Describe() string {
+	if column.Nullable {
+		return column.Type + " NULL"
+	}
+	return column.Type + " NOT NULL"
+}
+
+// Describes an index (e.g. "unique (user_id, device_id)")
+func (index CatalogIndex) Describe() string {
+	kind := "index"
+	if index.Unique {
+		kind = "unique"
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(index.Columns, ", "))
+}
+
+// Returns the table the installer creates for the model, as gorm would create it
+func expectedTableSchema(db *gorm.DB, table SchemaTable) TableSchema {
+	scope := db.NewScope(table.Model)
+	dialect := scope.Dialect()
+	schema := TableSchema{Name: scope.TableName()}
+
+	// Indexes declared in the model tags (named like gorm does)
+	tagIndexes := map[string]*CatalogIndex{}
+	tagIndexNames := []string{}
+	addTagIndex := func(name string, unique bool, column string) {
+		if tagIndexes[name] == nil {
+			tagIndexes[name] = &CatalogIndex{Name: name, Unique: unique}
+			tagIndexNames = append(tagIndexNames, name)
+		}
+		tagIndexes[name].Columns = append(tagIndexes[name].Columns, column)
+	}
+
+	// Like gorm, a primary key in a column type is the only one (e.g. "integer primary key autoincrement" on SQLite)
+	primaryKeyInColumn := false
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsNormal && !field.IsIgnored && strings.Contains(strings.ToLower(dialect.DataTypeOf(field)), "primary key") {
+			primaryKeyInColumn = true
+		}
+	}
+
+	for _, field := range scope.GetModelStruct().StructFields {
+		if !field.IsNormal || field.IsIgnored {
+			continue
+		}
+
+		definition := dialect.DataTypeOf(field)
+		primaryKey := field.IsPrimaryKey && (!primaryKeyInColumn || strings.Contains(strings.ToLower(definition), "primary key"))
+		schema.Columns = append(schema.Columns, CatalogColumn{
+			Name:     field.DBName,
+			Type:     normalizeColumnType(dialect.GetName(), definition),
+			Nullable: !primaryKey && !strings.Contains(strings.ToUpper(definition), "NOT NULL"),
+		})
+
+		if strings.Contains(strings.ToUpper(definition), "UNIQUE") {
+			schema.Indexes = append(schema.Indexes, CatalogIndex{Columns: []string{field.DBName}, Unique: true})
+		}
+		for _, tag := range []string{"INDEX", "UNIQUE_INDEX"} {
+			value, found := field.TagSettingsGet(tag)
+			if !found {
+				continue
+			}
+			for _, name := range strings.Split(value, ",") {
+				if name == "" || name == tag {
+					prefix := "idx"
+					if tag == "UNIQUE_INDEX" {
+						prefix = "uix"
+					}
+					name = dialect.BuildKeyName(prefix, schema.Name, field.DBName)
+				}
+				addTagIndex(name, tag == "UNIQUE_INDEX", field.DBName)
+			}
+		}
+	}
+
+	for _, name := range tagIndexNames {
+		schema.Indexes = append(schema.Indexes, *tagIndexes[name])
+	}
+	for _, index := range table.UniqueIndexes {
+		schema.Indexes = append(schema.Indexes, CatalogIndex{Name: index.Name, Columns: index.Columns, Unique: true})
+	}
+	for _, key := range table.ForeignKeys {
+		key.Name = key.KeyName(db, schema.Name)
+		schema.ForeignKeys = append(schema.ForeignKeys, key)
+	}
+	return schema
+}
+
+// Reads a table from the database
+func liveTableSchema(db *gorm.DB, name string) (TableSchema, error) {
+	schema := TableSchema{Name: name}
+	var err error
+	if schema.Columns, err = listColumns(db, name); err != nil {
+		return schema, err
+	}
+	for i := range schema.Columns {
+		schema.Columns[i].Type = normalizeColumnType(db.Dialect().GetName(), schema.Columns[i].Type)
+	}
+	if schema.Indexes, err = listIndexes(db, name); err != nil {
+		return schema, err
+	}
+	if schema.ForeignKeys, err = listForeignKeys(db, name); err != nil {
+		return schema, err
+	}
+	return schema, nil
+}
+
+// Compares the database with the schema the installer creates
+func diffSchema(db *gorm.DB) ([]SchemaDifference, error) {
+	differences := []SchemaDifference{}
+	for _, table := range schemaTables {
+		expected := expectedTableSchema(db, table)
+		if !db.Dialect().HasTable(expected.Name) {
+			differences = append(differences, SchemaDifference{Table: expected.Name, Object: "table", Name: expected.Name, Change: SCHEMA_MISSING})
+			continue
+		}
+
+		live, err := liveTableSchema(db, expected.Name)
+		if err != nil {
+			return differences, fmt.Errorf("can't inspect the table %s: %v", expected.Name, err)
+		}
+		differences = append(differences, diffTable(expected, live)...)
+	}
+	return differences, nil
+}
+
+// Separates the foreign keys SQLite is missing from the rest of the differences.
+//
+// SQLite only creates foreign keys with the table, so migrate can't add them
+// (pendingSchemaChanges skips them too): they are reported apart, without failing.
+func splitSQLiteForeignKeys(dialect string, differences []SchemaDifference) ([]SchemaDifference, []SchemaDifference) {
+	if dialect != "sqlite3" {
+		return differences, nil
+	}
+	others, missingKeys := []SchemaDifference{}, []SchemaDifference{}
+	for _, difference := range differences {
+		if difference.Object == "foreign key" && difference.Change == SCHEMA_MISSING {
+			missingKeys = append(missingKeys, difference)
+		} else {
+			others = append(others, difference)
+		}
+	}
+	return others, missingKeys
+}
+
+// Compares the columns, indexes and foreign keys of a table
+func diffTable(expected, live TableSchema) []SchemaDifference {
+	differences := []SchemaDifference{}
+	add := func(object, name, change, expectedValue, found string) {
+		differences = append(differences, SchemaDifference{
+			Table: expected.Name, Object: object, Name: name, Change: change, Expected: expectedValue, Found: found,
+		})
+	}
+
+	// Columns
+	liveColumns := map[string]CatalogColumn{}
+	for _, column := range live.Columns {
+		liveColumns[strings.ToLower(column.Name)] = column
+	}
+	for _, column := range expected.Columns {
+		found, exists := liveColumns[strings.ToLower(column.Name)]
+		delete(liveColumns, strings.ToLower(column.Name))
+		if !exists {
+			add("column", column.Name, SCHEMA_MISSING, column.Describe(), "")
+		} else if found.Type != column.Type || found.Nullable != column.Nullable {
+			add("column", column.Name, SCHEMA_CHANGED, column.Describe(), found.Describe())
+		}
+	}
+	for _, column := range live.Columns {
+		if _, extra := liveColumns[strings.ToLower(column.Name)]; extra {
+			add("column", column.Name, SCHEMA_EXTRA, "", column.Describe())
+		}
+	}
+
+	// Indexes (by name, or by columns for the unique columns). The names are case insensitive, like in inspectIndex
+	matched := map[string]bool{}
+	for _, index := range expected.Indexes {
+		var found *CatalogIndex
+		for i := range live.Indexes {
+			if index.Name != "" && strings.EqualFold(live.Indexes[i].Name, index.Name) ||
+				index.Name == "" && live.Indexes[i].Unique && sameColumns(live.Indexes[i].Columns, index.Columns) {
+				found = &live.Indexes[i]
+				break
+			}
+		}
+
+		name := index.Name
+		if name == "" {
+			name = strings.Join(index.Columns, ", ")
+		}
+		if found == nil {
+			add("index", name, SCHEMA_MISSING, index.Describe(), "")
+			continue
+		}
+		matched[found.Name] = true
+		if found.Unique != index.Unique || !sameColumns(found.Columns, index.Columns) {
+			add("index", name, SCHEMA_CHANGED, index.Describe(), found.Describe())
+		}
+	}
+	// Only the unique ones, the databases add plain indexes of their own (e.g. for the foreign keys)
+	for _, index := range live.Indexes {
+		if index.Unique && !matched[index.Name] {
+			add("index", index.Name, SCHEMA_EXTRA, "", index.Describe())
+		}
+	}
+
+	// Foreign keys (by name, or by columns on SQLite)
+	matched = map[string]bool{}
+	for _, key := range expected.ForeignKeys {
+		found := findForeignKey(live.ForeignKeys, key, key.Name)
+		if found == nil {
+			add("foreign key", key.Name, SCHEMA_MISSING, key.Describe(expected.Name), "")
+			continue
+		}
+		matched[found.Name+strings.Join(found.Columns, ",")] = true
+		if !found.Matches(key) {
+			add("foreign key", key.Name, SCHEMA_CHANGED, key.Describe(expected.Name), found.Describe(expected.Name))
+		}
+	}
+	for _, key := range live.ForeignKeys {
+		if !matched[key.Name+strings.Join(key.Columns, ",")] {
+			add("foreign key", key.Name, SCHEMA_EXTRA, "", key.Describe(expected.Name))
+		}
+	}
+
+	return differences
+}
+
+// Formats the differences as a diff, grouped by table:
+//
+//	sessions
+//	  - column device_id: varchar(255) NULL
+//	  ~ column ip: expected varchar(255) NULL, found varchar(11) NOT NULL
+//	  + index unique_session: unique (user_id, ip)
+func formatSchemaDiff(differences []SchemaDifference) string {
+	var out strings.Builder
+	table := ""
+	for _, difference := range differences {
+		if difference.Table != table {
+			table = difference.Table
+			fmt.Fprintln(&out, table)
+		}
+
+		switch difference.Change {
+		case SCHEMA_MISSING:
+			if difference.Object == "table" {
+				fmt.Fprintf(&out, "  - table %s (doesn't exist)\n", difference.Name)
+			} else {
+				fmt.Fprintf(&out, "  - %s %s: %s\n", difference.Object, difference.Name, difference.Expected)
+			}
+		case SCHEMA_EXTRA:
+			fmt.Fprintf(&out, "  + %s %s: %s\n", difference.Object, difference.Name, difference.Found)
+		case SCHEMA_CHANGED:
+			fmt.Fprintf(&out, "  ~ %s %s: expected %s, found %s\n", difference.Object, difference.Name, difference.Expected, difference.Found)
+		}
+	}
+	return out.String()
+}
+
+var (
+	// Last schema check of the review step, with the database fields it was made with
+	reviewSchemaFields      string
+	reviewSchemaCheck       EnvironmentCheck
+	reviewSchemaDifferences []SchemaDifference
+
+	// Guards the last schema check
+	reviewSchemaLock sync.Mutex
+)
+
+// Returns checkDatabaseSchema, connecting only when the database fields changed (or after resetDatabaseSchemaCheck)
+func cachedDatabaseSchemaCheck(form url.Values) (EnvironmentCheck, []SchemaDifference) {
+	step, _ := findWizardStep("database")
+	values := []string{}
+	for _, field := range step.Fields {
+		values = append(values, form.Get(field))
+	}
+	fields := strings.Join(values, "\x00")
+
+	reviewSchemaLock.Lock()
+	defer reviewSchemaLock.Unlock()
+	if fields != reviewSchemaFields {
+		reviewSchemaCheck, reviewSchemaDifferences = checkDatabaseSchema(form)
+		reviewSchemaFields = fields
+	}
+	return reviewSchemaCheck, reviewSchemaDifferences
+}
+
+// Forgets the last schema check, so the review step checks the database again
+func resetDatabaseSchemaCheck() {
+	reviewSchemaLock.Lock()
+	reviewSchemaFields = ""
+	reviewSchemaLock.Unlock()
+}
+
+// Checks the schema of the database the wizard is going to install to (with the differences found)
+func checkDatabaseSchema(form url.Values) (EnvironmentCheck, []SchemaDifference) {
+	check := EnvironmentCheck{Name: "Database schema"}
+
+	db, err := openDatabaseNow(form)
+	if err != nil {
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("The database can't be checked: %v", err)
+		check.Hint = "Check the database settings, the installation will fail if it can't connect."
+		return check, nil
+	}
+	defer db.Close()
+
+	differences, err := diffSchema(db)
+	if err != nil {
+		check.Status = CHECK_WARN
+		check.Message = err.Error()
+		return check, nil
+	}
+	differences, _ = splitSQLiteForeignKeys(db.Dialect().GetName(), differences)
+
+	missingTables := 0
+	for _, difference := range differences {
+		if difference.Object == "table" {
+			missingTables++
+		}
+	}
+
+	switch {
+	case len(differences) == 0:
+		check.Status = CHECK_PASS
+		check.Message = "The database matches the schema of the platform."
+	case missingTables == len(schemaTables):
+		check.Status = CHECK_PASS
+		check.Message = "The database is empty, the tables will be created."
+	case missingTables == len(differences):
+		check.Status = CHECK_PASS
+		check.Message = fmt.Sprintf("%d tables will be created.", missingTables)
+	default:
+		check.Status = CHECK_WARN
+		check.Message = fmt.Sprintf("The database differs from the schema of the platform in %d places.", len(differences))
+		check.Hint = "Creating the tables adds what is missing, the rest has to be fixed by hand (see the differences below)."
+		return check, differences
+	}
+	return check, nil
+}
+
+// Compares the database of an installation with the schema the installer creates
+func verifySchemaCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+
+	flags := flag.NewFlagSet("verify-schema", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer verify-schema [--settings path]")
+		fmt.Println("Exits with 1 if the database differs from the schema the installer creates.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	job := newInstallJob()
+	job.output = func(event InstallEvent) {
+		fmt.Fprintln(os.Stderr, event.Message)
+	}
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	differences, err := diffSchema(db)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	differences, missingKeys := splitSQLiteForeignKeys(config.Dialect, differences)
+	if len(missingKeys) > 0 {
+		fmt.Printf("SQLite only creates foreign keys with the tables, %d are missing from the tables created without them:\n\n", len(missingKeys))
+		fmt.Println(formatSchemaDiff(missingKeys))
+	}
+
+	if len(differences) == 0 {
+		fmt.Printf("The database %s at %s matches the schema.\n", config.Name, config.Address())
+		return 0
+	}
+
+	fmt.Printf("The database %s at %s differs from the schema (- missing, + extra, ~ changed):\n\n", config.Name, config.Address())
+	fmt.Print(formatSchemaDiff(differences))
+	return 1
+}
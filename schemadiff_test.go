@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestNormalizeColumnType(t *testing.T) {
+	tests := []struct {
+		dialect, definition, want string
+	}{
+		{"mysql", "int unsigned AUTO_INCREMENT", "int unsigned"},
+		{"mysql", "int(10) unsigned", "int unsigned"},
+		{"mysql", "bigint(20)", "bigint"},
+		{"mysql", "boolean", "tinyint(1)"},
+		{"mysql", "tinyint(1)", "tinyint(1)"},
+		{"mysql", "tinyint(4)", "tinyint"},
+		{"mysql", "varchar(255) NOT NULL UNIQUE", "varchar(255)"},
+		{"mysql", "DATETIME NULL", "datetime"},
+		{"postgres", "serial", "integer"},
+		{"postgres", "bigserial PRIMARY KEY", "bigint"},
+		{"postgres", "character varying(255)", "varchar(255)"},
+		{"postgres", "timestamp with time zone", "timestamp with time zone"},
+		{"sqlite3", "integer primary key autoincrement", "integer"},
+		{"sqlite3", "bool", "bool"},
+	}
+	for _, test := range tests {
+		if got := normalizeColumnType(test.dialect, test.definition); got != test.want {
+			t.Errorf("normalizeColumnType(%s, %q) = %q, want %q", test.dialect, test.definition, got, test.want)
+		}
+	}
+}
+
+// A table shaped like course_levels, as the installer creates it
+func testTableSchema() TableSchema {
+	return TableSchema{
+		Name: "course_levels",
+		Columns: []CatalogColumn{
+			{Name: "course_id", Type: "integer"},
+			{Name: "class_id", Type: "integer"},
+			{Name: "level", Type: "integer", Nullable: true},
+		},
+		Indexes: []CatalogIndex{
+			{Name: "idx_courseLevels_course_class", Columns: []string{"course_id", "class_id"}, Unique: true},
+		},
+		ForeignKeys: []ForeignKey{
+			{Name: "fk_courseLevels_classes", Columns: []string{"class_id"}, RefTable: "classes", RefColumns: []string{"id"}},
+		},
+	}
+}
+
+func TestDiffTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		live   func(*TableSchema)
+		change []string // object, name and change of each difference
+	}{
+		{"same", func(*TableSchema) {}, nil},
+		{"lowercase names (Postgres)", func(live *TableSchema) {
+			live.Indexes[0].Name = "idx_courselevels_course_class"
+			live.ForeignKeys[0].Name = "fk_courselevels_classes"
+			live.Columns[0].Name = "COURSE_ID"
+		}, nil},
+		{"unnamed foreign keys (SQLite)", func(live *TableSchema) {
+			live.ForeignKeys[0].Name = ""
+		}, nil},
+		{"missing column", func(live *TableSchema) {
+			live.Columns = live.Columns[:2]
+		}, []string{"column", "level", SCHEMA_MISSING}},
+		{"changed column", func(live *TableSchema) {
+			live.Columns[2].Nullable = false
+		}, []string{"column", "level", SCHEMA_CHANGED}},
+		{"extra column", func(live *TableSchema) {
+			live.Columns = append(live.Columns, CatalogColumn{Name: "notes", Type: "text"})
+		}, []string{"column", "notes", SCHEMA_EXTRA}},
+		{"changed index", func(live *TableSchema) {
+			live.Indexes[0].Columns = []string{"course_id"}
+		}, []string{"index", "idx_courseLevels_course_class", SCHEMA_CHANGED}},
+		{"renamed index", func(live *TableSchema) {
+			live.Indexes[0].Name = "uix_course_levels"
+		}, []string{
+			"index", "idx_courseLevels_course_class", SCHEMA_MISSING,
+			"index", "uix_course_levels", SCHEMA_EXTRA,
+		}},
+		{"plain indexes of the database", func(live *TableSchema) {
+			live.Indexes = append(live.Indexes, CatalogIndex{Name: "class_id", Columns: []string{"class_id"}})
+		}, nil},
+		{"changed foreign key", func(live *TableSchema) {
+			live.ForeignKeys[0].RefTable = "courses"
+		}, []string{"foreign key", "fk_courseLevels_classes", SCHEMA_CHANGED}},
+		{"missing foreign key", func(live *TableSchema) {
+			live.ForeignKeys = nil
+		}, []string{"foreign key", "fk_courseLevels_classes", SCHEMA_MISSING}},
+	}
+	for _, test := range tests {
+		live := testTableSchema()
+		test.live(&live)
+
+		var change []string
+		for _, difference := range diffTable(testTableSchema(), live) {
+			change = append(change, difference.Object, difference.Name, difference.Change)
+		}
+		if !reflect.DeepEqual(change, test.change) {
+			t.Errorf("%s: diffTable = %q, want %q", test.name, change, test.change)
+		}
+	}
+}
+
+// The review step only checks the database again when its fields change, or when asked to
+func TestCachedDatabaseSchemaCheck(t *testing.T) {
+	resetDatabaseSchemaCheck()
+	defer resetDatabaseSchemaCheck()
+
+	path := filepath.Join(t.TempDir(), "kumquat.db")
+	form := url.Values{"db-type": {"SQLite"}, "sqlite-path": {path}}
+	first, _ := cachedDatabaseSchemaCheck(form)
+
+	// A table the check would see
+	db, err := gorm.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, _ := cachedDatabaseSchemaCheck(form); cached != first {
+		t.Errorf("the database was checked again: %+v, first %+v", cached, first)
+	}
+	resetDatabaseSchemaCheck()
+	if rechecked, _ := cachedDatabaseSchemaCheck(form); rechecked == first {
+		t.Errorf("the database wasn't checked again: %+v", rechecked)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Inserts records unless they already exist, counting them for the progress messages.
+//
+// Like the original demo data, a record that can't be inserted is a warning
+// (the demo data can be inserted more than once).
+//
+// With an output, the records are written as INSERT statements instead (see ddl.go).
+type seeder struct {
+	db       *gorm.DB
+	job      *InstallJob
+	rows     int
+	output   io.Writer
+	accounts []string  // Usernames of the demo users
+	now      time.Time // Day the demo dates are relative to (today, unless set)
+}
+
+func newSeeder(db *gorm.DB, job *InstallJob) *seeder {
+	return &seeder{db: db, job: job}
+}
+
+// Returns the time the demo dates are relative to
+func (s *seeder) Now() time.Time {
+	if s.now.IsZero() {
+		return time.Now()
+	}
+	return s.now
+}
+
+// Finds the record matching where, or creates it into out
+func (s *seeder) Seed(out interface{}, where interface{}) {
+	// Stops inserting once the job is canceled
+	if s.job.Err() != nil {
+		return
+	}
+
+	if s.output != nil {
+		fmt.Fprintln(s.output, insertStatement(s.db, out))
+		s.rows++
+		return
+	}
+
+	if err := s.db.FirstOrCreate(out, where).Error; err != nil {
+		s.job.Warn("Can't insert the demo %s: %v", s.db.NewScope(out).TableName(), err)
+		return
+	}
+	if user, ok := out.(*models.User); ok {
+		s.accounts = append(s.accounts, user.Username)
+	}
+	s.rows++
+}
+
+// Copies a file used by the records (skipped when writing SQL)
+func (s *seeder) CopyAsset(src, dst string) error {
+	if s.output != nil {
+		return nil
+	}
+	return CopyAsset(src, dst)
+}
+
+// Reports the rows seeded since the last call
+func (s *seeder) Done(label string) {
+	if s.job.Err() != nil {
+		return
+	}
+
+	if s.output != nil {
+		fmt.Fprintln(s.output)
+	}
+	s.job.Log("Seeded %d %s", s.rows, label)
+	s.rows = 0
+}
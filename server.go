@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default address used when neither the flags nor the environment set one
+const DEFAULT_LISTEN = ":3000"
+
+// ServerConfig holds how the installer listens and when it should stop.
+type ServerConfig struct {
+	Listen          string
+	AssetsDir       string
+	StateFile       string
+	ExitOnFinish    bool
+	ShutdownTimeout time.Duration
+}
+
+var (
+	// Tracks the installations in progress, so a shutdown can wait for them
+	installsInProgress sync.WaitGroup
+
+	// Receives a value every time an installation completes
+	installFinished = make(chan struct{}, 1)
+
+	// Address the installer listens on (the API can't use it)
+	installerListen = DEFAULT_LISTEN
+)
+
+// Parses the server flags, falling back to the environment and then to the defaults.
+//
+// The listen address is taken from --listen, KUMQUAT_INSTALLER_LISTEN or PORT (in that order).
+func parseServerConfig(args []string) (*ServerConfig, error) {
+	config := &ServerConfig{
+		Listen:          DEFAULT_LISTEN,
+		StateFile:       DEFAULT_STATE_FILE,
+		ShutdownTimeout: 10 * time.Second,
+	}
+
+	// Overrides the defaults with the Environment Variables (if available)
+	if port := os.Getenv("PORT"); port != "" {
+		if _, err := strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid PORT environment variable %q", port)
+		}
+		config.Listen = ":" + port
+	}
+	if listen := os.Getenv("KUMQUAT_INSTALLER_LISTEN"); listen != "" {
+		config.Listen = listen
+	}
+	if assetsDir := os.Getenv("KUMQUAT_INSTALLER_ASSETS"); assetsDir != "" {
+		config.AssetsDir = assetsDir
+	}
+	if stateFile := os.Getenv("KUMQUAT_INSTALLER_STATE"); stateFile != "" {
+		config.StateFile = stateFile
+	}
+	if exit := os.Getenv("KUMQUAT_INSTALLER_EXIT_ON_FINISH"); exit != "" {
+		parsed, err := strconv.ParseBool(exit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KUMQUAT_INSTALLER_EXIT_ON_FINISH environment variable %q", exit)
+		}
+		config.ExitOnFinish = parsed
+	}
+
+	// The flags have the last word
+	flags := flag.NewFlagSet("installer", flag.ContinueOnError)
+	flags.StringVar(&config.Listen, "listen", config.Listen, "address the installer listens on (host:port)")
+	flags.StringVar(&config.AssetsDir, "assets", config.AssetsDir, "directory with templates/resources overriding the bundled ones")
+	flags.StringVar(&config.StateFile, "state", config.StateFile, "file the wizard progress is saved to")
+	flags.BoolVar(&config.ExitOnFinish, "exit-on-finish", config.ExitOnFinish, "stop the installer once an installation completes")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "time given to open connections when shutting down")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Registers the installer routes on its own mux (instead of the global DefaultServeMux)
+func newInstallMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// serve static assets showing how to strip/change the path.
+	resources := http.FileServer(http.FS(assetsDir("resources")))
+	mux.Handle("/images/", http.StripPrefix("/images/", resources))
+	mux.Handle("/js/", http.StripPrefix("/js/", resources))
+	mux.Handle("/css/", http.StripPrefix("/css/", resources))
+
+	// Installer pages
+	mux.HandleFunc("/", installHandler)
+	mux.HandleFunc("/step/", wizardStepHandler)
+	mux.HandleFunc("/reset", wizardResetHandler)
+	mux.HandleFunc("/do-install", doInstallHandler)
+	mux.HandleFunc("/install/", installJobHandler)
+
+	return mux
+}
+
+// Starts the Installation Server (Independent from the main Server) and blocks until it stops.
+//
+// The server stops on SIGINT / SIGTERM, or after an installation when ExitOnFinish is set.
+// In both cases it waits for any installation in progress before returning.
+func StartInstallServer(config *ServerConfig) error {
+	wizardStatePath = config.StateFile
+	installerListen = config.Listen
+
+	server := &http.Server{
+		Addr:    config.Listen,
+		Handler: newInstallMux(),
+	}
+	server.RegisterOnShutdown(stopEventStreams)
+
+	// Binds the address first, so a busy port is reported straight away
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return fmt.Errorf("can't listen on %s: %v", config.Listen, err)
+	}
+
+	// Logs the Address being Used for Installation
+	fmt.Printf("Starting Installer on: %s\n", listener.Addr())
+
+	serveError := make(chan error, 1)
+	go func() {
+		serveError <- server.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Waits for a reason to stop
+	finished := installFinished
+	if !config.ExitOnFinish {
+		finished = nil
+	}
+	select {
+	case err := <-serveError:
+		return err
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down the installer", sig)
+	case <-finished:
+		log.Println("Installation finished, shutting down the installer")
+	}
+
+	// Stops accepting connections and lets the open ones finish
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+
+	// Never leaves an installation half done
+	log.Println("Waiting for installations in progress...")
+	installsInProgress.Wait()
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Shortest time between two purges of the daemon
+const MIN_PURGE_INTERVAL = time.Minute
+
+// Subcommands of `installer session`
+var sessionCommands = []Command{
+	{"list", "Lists the active sessions (of a user or a device)", sessionListCommand},
+	{"revoke", "Signs a user out (of every device, or of one)", sessionRevokeCommand},
+	{"purge", "Deletes the expired sessions and password resets (on a schedule with --every)", sessionPurgeCommand},
+}
+
+// The rows purged from a table
+type PurgeResult struct {
+	Table   string
+	Expired int64
+}
+
+// Returns the column a model keeps its expiry date in
+func expiryColumn(db *gorm.DB, model interface{}) (string, error) {
+	field, found := db.NewScope(model).FieldByName("ExpiresIn")
+	if !found {
+		return "", fmt.Errorf("%s has no expiry date", db.NewScope(model).TableName())
+	}
+	return field.DBName, nil
+}
+
+// Deletes the sessions and the password resets that expired before now (or only counts them)
+func purgeExpired(db *gorm.DB, now time.Time, dryRun bool) ([]PurgeResult, error) {
+	results := []PurgeResult{}
+	for _, model := range []interface{}{&models.Session{}, &models.ResetPassword{}} {
+		table := db.NewScope(model).TableName()
+		column, err := expiryColumn(db, model)
+		if err != nil {
+			return results, err
+		}
+
+		query := db.Model(model).Where(db.Dialect().Quote(column)+" < ?", now)
+		result := PurgeResult{Table: table}
+		if dryRun {
+			err = query.Count(&result.Expired).Error
+		} else {
+			deleted := query.Delete(model)
+			err, result.Expired = deleted.Error, deleted.RowsAffected
+		}
+		if err != nil {
+			return results, fmt.Errorf("can't purge %s: %v", table, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Deletes the sessions of a user (only the ones of a device, if given)
+func revokeSessions(db *gorm.DB, user *models.User, device string) (int64, error) {
+	query := db.Where("user_id = ?", user.ID)
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	deleted := query.Delete(&models.Session{})
+	return deleted.RowsAffected, deleted.Error
+}
+
+// Manages the sessions of an installation
+func sessionCommand(args []string) int {
+	if len(args) > 0 {
+		for _, command := range sessionCommands {
+			if command.Name == args[0] {
+				return command.Run(args[1:])
+			}
+		}
+		if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+			fmt.Printf("Unknown session command %q\n\n", args[0])
+		}
+	}
+
+	fmt.Println("Usage: installer session <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range sessionCommands {
+		fmt.Printf("  %-16s %s\n", command.Name, command.Description)
+	}
+	return 2
+}
+
+// A session as listed by `session list` (the token is shortened, it signs the user in)
+type sessionListing struct {
+	Token     string    `json:"token"`
+	UserID    uint32    `json:"user_id"`
+	Username  string    `json:"username"`
+	DeviceID  string    `json:"device_id"`
+	CreatedOn time.Time `json:"created_on"`
+	ExpiresIn time.Time `json:"expires_in"`
+}
+
+// Lists the sessions, newest first (only the ones of a user or a device when given,
+// and the expired ones only when asked)
+func listSessions(db *gorm.DB, userID uint32, device string, now time.Time, expired bool) ([]sessionListing, error) {
+	query := db.Order("created_on desc")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	if !expired {
+		column, err := expiryColumn(db, &models.Session{})
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(db.Dialect().Quote(column)+" >= ?", now)
+	}
+	sessions := []models.Session{}
+	if err := query.Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("can't list the sessions: %v", err)
+	}
+
+	// Only the users with a session
+	ids := []uint32{}
+	for _, session := range sessions {
+		ids = append(ids, session.UserID)
+	}
+	usernames := map[uint32]string{}
+	if len(ids) > 0 {
+		users := []models.User{}
+		if err := db.Select("id, username").Where("id IN (?)", ids).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("can't read the users of the sessions: %v", err)
+		}
+		for _, user := range users {
+			usernames[user.ID] = user.Username
+		}
+	}
+
+	listing := []sessionListing{}
+	for _, session := range sessions {
+		token := session.Token
+		if len(token) > 8 {
+			token = token[:8] + "..."
+		}
+		listing = append(listing, sessionListing{
+			Token:     token,
+			UserID:    session.UserID,
+			Username:  usernames[session.UserID],
+			DeviceID:  session.DeviceID,
+			CreatedOn: session.CreatedOn,
+			ExpiresIn: session.ExpiresIn,
+		})
+	}
+	return listing, nil
+}
+
+// Lists the active sessions
+func sessionListCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	login := ""
+	device := ""
+	expired := false
+	asJSON := false
+
+	flags := flag.NewFlagSet("session list", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.StringVar(&login, "user", login, "only list the sessions of this user (username or email)")
+	flags.StringVar(&device, "device", device, "only list the sessions of this device")
+	flags.BoolVar(&expired, "expired", expired, "also list the expired sessions")
+	flags.BoolVar(&asJSON, "json", asJSON, "print the sessions as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	userID := uint32(0)
+	if login != "" {
+		user, err := findUser(db, login)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		userID = user.ID
+	}
+	listing, err := listSessions(db, userID, device, time.Now(), expired)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if asJSON {
+		content, _ := json.MarshalIndent(listing, "", "  ")
+		fmt.Println(string(content))
+		return 0
+	}
+
+	fmt.Printf("%-12s %-20s %-30s %-20s %s\n", "Token", "User", "Device", "Created", "Expires")
+	for _, session := range listing {
+		fmt.Printf("%-12s %-20s %-30s %-20s %s\n", session.Token, session.Username, session.DeviceID,
+			session.CreatedOn.Local().Format("2006-01-02 15:04:05"), session.ExpiresIn.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("\n%d sessions\n", len(listing))
+	return 0
+}
+
+// Signs a user out
+func sessionRevokeCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	device := ""
+
+	flags := flag.NewFlagSet("session revoke", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.StringVar(&device, "device", device, "only revoke the session of this device")
+	login, ok := parseUserArgs(flags, args)
+	if !ok {
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	user, err := findUser(db, login)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	revoked, err := revokeSessions(db, user, device)
+	if err != nil {
+		fmt.Printf("can't revoke the sessions of %s: %v\n", user.Username, err)
+		return 1
+	}
+	fmt.Printf("Revoked %d sessions of %s\n", revoked, user.Username)
+	return 0
+}
+
+// Deletes the expired sessions and password resets, once or on a schedule
+func sessionPurgeCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	dryRun := false
+	every := time.Duration(0)
+
+	flags := flag.NewFlagSet("session purge", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.BoolVar(&dryRun, "dry-run", dryRun, "only count the expired rows")
+	flags.DurationVar(&every, "every", every, "keep running, purging on this interval (e.g. 1h), until stopped")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if every != 0 && every < MIN_PURGE_INTERVAL {
+		fmt.Printf("--every has to be at least %s\n", MIN_PURGE_INTERVAL)
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	purge := func() error {
+		results, err := purgeExpired(db, time.Now(), dryRun)
+		for _, result := range results {
+			if dryRun {
+				log.Printf("%d expired rows in %s", result.Expired, result.Table)
+			} else {
+				log.Printf("Purged %d expired rows from %s", result.Expired, result.Table)
+			}
+		}
+		return err
+	}
+
+	if every == 0 {
+		if err := purge(); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	// Runs until it's stopped, a failed purge is retried on the next tick
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Purging the expired sessions every %s", every)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := purge(); err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Stopped purging the sessions")
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+func TestListSessions(t *testing.T) {
+	db := openTestDatabase(t, &models.User{}, &models.Session{})
+	now := time.Date(2016, 9, 12, 12, 0, 0, 0, time.UTC)
+
+	for i, username := range []string{"admin", "teacher", "student"} {
+		user := models.User{ID: uint32(i + 1), Username: username, Email: username + "@example.com", MatricNumber: fmt.Sprint(i)}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions := []models.Session{
+		{Token: "11111111-admin-laptop", UserID: 1, DeviceID: "laptop", CreatedOn: now.Add(-3 * time.Hour), ExpiresIn: now.Add(time.Hour)},
+		{Token: "22222222-admin-phone", UserID: 1, DeviceID: "phone", CreatedOn: now.Add(-2 * time.Hour), ExpiresIn: now.Add(-time.Hour)},
+		{Token: "33333333-teacher-laptop", UserID: 2, DeviceID: "laptop", CreatedOn: now.Add(-time.Hour), ExpiresIn: now.Add(time.Hour)},
+	}
+	for i := range sessions {
+		if err := db.Create(&sessions[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		userID  uint32
+		device  string
+		expired bool
+		want    []string // Username and device of each session
+	}{
+		{0, "", false, []string{"teacher", "laptop", "admin", "laptop"}},
+		{0, "", true, []string{"teacher", "laptop", "admin", "phone", "admin", "laptop"}},
+		{1, "", true, []string{"admin", "phone", "admin", "laptop"}},
+		{0, "laptop", false, []string{"teacher", "laptop", "admin", "laptop"}},
+		{3, "", true, nil},
+	}
+	for _, test := range tests {
+		listing, err := listSessions(db, test.userID, test.device, now, test.expired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, session := range listing {
+			got = append(got, session.Username, session.DeviceID)
+			if len(session.Token) != 11 {
+				t.Errorf("the token %s isn't shortened", session.Token)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("listSessions(%d, %q, %t) = %q, want %q", test.userID, test.device, test.expired, got, test.want)
+		}
+	}
+}
+
+// Only what expired before now goes, and a dry run only counts it
+func TestPurgeExpired(t *testing.T) {
+	now := time.Date(2016, 9, 12, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		now    time.Time
+		dryRun bool
+		want   []PurgeResult
+		left   []string // Tokens of the sessions and password resets left
+	}{
+		{now, false, []PurgeResult{{"sessions", 1}, {"reset_passwords", 1}}, []string{"now", "soon", "reset-soon"}},
+		{now, true, []PurgeResult{{"sessions", 1}, {"reset_passwords", 1}}, []string{"expired", "now", "soon", "reset-expired", "reset-soon"}},
+		{now.Add(time.Minute), false, []PurgeResult{{"sessions", 2}, {"reset_passwords", 1}}, []string{"soon", "reset-soon"}},
+		{now.Add(-2 * time.Hour), false, []PurgeResult{{"sessions", 0}, {"reset_passwords", 0}}, []string{"expired", "now", "soon", "reset-expired", "reset-soon"}},
+	}
+	for _, test := range tests {
+		db := openTestDatabase(t, &models.Session{}, &models.ResetPassword{})
+		for _, record := range []interface{}{
+			&models.Session{Token: "expired", UserID: 1, ExpiresIn: now.Add(-time.Hour)},
+			&models.Session{Token: "now", UserID: 1, ExpiresIn: now},
+			&models.Session{Token: "soon", UserID: 1, ExpiresIn: now.Add(time.Hour)},
+			&models.ResetPassword{Token: "reset-expired", UserID: 1, ExpiresIn: now.Add(-time.Minute)},
+			&models.ResetPassword{Token: "reset-soon", UserID: 1, ExpiresIn: now.Add(time.Hour)},
+		} {
+			if err := db.Create(record).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		results, err := purgeExpired(db, test.now, test.dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sessions, resets []string
+		db.Model(&models.Session{}).Order("expires_in").Pluck("token", &sessions)
+		db.Model(&models.ResetPassword{}).Order("expires_in").Pluck("token", &resets)
+		if left := append(sessions, resets...); !reflect.DeepEqual(results, test.want) || !reflect.DeepEqual(left, test.left) {
+			t.Errorf("purgeExpired(%s, %t) = %+v leaving %q, want %+v leaving %q", test.now, test.dryRun, results, left, test.want, test.left)
+		}
+	}
+}
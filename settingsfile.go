@@ -0,0 +1,337 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/YagoCarballo/kumquat-academy-api/tools"
+)
+
+// Format of the timestamp added to the backups (sorts in chronological order)
+const BACKUP_TIMESTAMP = "20060102-150405"
+
+// SettingChange is a setting that the installation is going to change.
+type SettingChange struct {
+	Key      string
+	OldValue string
+	NewValue string
+}
+
+// Loads a settings file (nil if it doesn't exist)
+func loadSettingsFile(path string) (*tools.Settings, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	settings := &tools.Settings{}
+	if _, err := toml.DecodeFile(path, settings); err != nil {
+		return nil, fmt.Errorf("can't read %s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// Copies the setting of each wizard field (from src to dst)
+var settingsFields = map[string]func(dst, src *tools.Settings){
+	"page-title":        func(dst, src *tools.Settings) { dst.Title = src.Title },
+	"page-description":  func(dst, src *tools.Settings) { dst.Description = src.Description },
+	"server-port":       func(dst, src *tools.Settings) { dst.Server.Port = src.Server.Port },
+	"server-debug":      func(dst, src *tools.Settings) { dst.Server.Debug = src.Server.Debug },
+	"server-production": func(dst, src *tools.Settings) { dst.Server.Production = src.Server.Production },
+	"uploads-path":      func(dst, src *tools.Settings) { dst.Server.UploadsPath = src.Server.UploadsPath },
+	"private-key":       func(dst, src *tools.Settings) { dst.Server.PrivateKey = src.Server.PrivateKey },
+	"public-key":        func(dst, src *tools.Settings) { dst.Server.PublicKey = src.Server.PublicKey },
+	"db-type":           func(dst, src *tools.Settings) { dst.Database.Type = src.Database.Type },
+	"db-host":           func(dst, src *tools.Settings) { dst.Database.Mysql.Host = src.Database.Mysql.Host },
+	"db-port":           func(dst, src *tools.Settings) { dst.Database.Mysql.Host = src.Database.Mysql.Host },
+	"db-name":           func(dst, src *tools.Settings) { dst.Database.Mysql.Name = src.Database.Mysql.Name },
+	"db-username":       func(dst, src *tools.Settings) { dst.Database.Mysql.Username = src.Database.Mysql.Username },
+	"db-password":       func(dst, src *tools.Settings) { dst.Database.Mysql.Password = src.Database.Mysql.Password },
+	"sqlite-path":       func(dst, src *tools.Settings) { dst.Database.Sqlite.Path = src.Database.Sqlite.Path },
+	"email-server":      func(dst, src *tools.Settings) { dst.Email.Server = src.Email.Server },
+	"email-port":        func(dst, src *tools.Settings) { dst.Email.Port = src.Email.Port },
+	"email-user":        func(dst, src *tools.Settings) { dst.Email.User = src.Email.User },
+	"email-password":    func(dst, src *tools.Settings) { dst.Email.Password = src.Email.Password },
+	"email-sender":      func(dst, src *tools.Settings) { dst.Email.Sender = src.Email.Sender },
+	"api-prefix":        func(dst, src *tools.Settings) { dst.Api.Prefix = src.Api.Prefix },
+	"api-version":       func(dst, src *tools.Settings) { dst.Api.Version = src.Api.Version },
+}
+
+// Applies the settings of the wizard on top of the existing ones.
+//
+// Only the fields the operator (or the environment) changed are applied, the
+// rest keep the existing values (the wizard may show stale ones, e.g. from
+// an old installer-state.json). Without existing settings, every field is.
+func mergeSettings(base *tools.Settings, wizard *tools.Settings, changed map[string]bool) *tools.Settings {
+	if base == nil {
+		return wizard
+	}
+
+	merged := *base
+	for field := range changed {
+		if apply, found := settingsFields[field]; found {
+			apply(&merged, wizard)
+		}
+	}
+	return &merged
+}
+
+// Returns the settings an installation saves: the wizard ones on top of the existing ones.
+//
+// The secrets set by the environment are never saved, settings.toml keeps what
+// it had (so the operators never have to write the credentials in it).
+func settingsToSave(existing *tools.Settings, wizard *tools.Settings, changed, secrets map[string]bool) *tools.Settings {
+	applied := map[string]bool{}
+	for field := range changed {
+		if !secrets[field] {
+			applied[field] = true
+		}
+	}
+
+	merged := *mergeSettings(existing, wizard, applied)
+	if existing == nil {
+		for field := range secrets {
+			if clear, found := settingsFields[field]; found {
+				clear(&merged, &tools.Settings{})
+			}
+		}
+	}
+	return &merged
+}
+
+// Fills the wizard values with the existing settings, so only what the operator changes is changed
+func settingsToForm(settings *tools.Settings, values map[string]string) {
+	values["page-title"] = settings.Title
+	values["page-description"] = settings.Description
+	values["server-port"] = strconv.Itoa(settings.Server.Port)
+	values["uploads-path"] = settings.Server.UploadsPath
+	values["private-key"] = settings.Server.PrivateKey
+	values["public-key"] = settings.Server.PublicKey
+	values["db-name"] = settings.Database.Mysql.Name
+	values["db-username"] = settings.Database.Mysql.Username
+	values["db-password"] = settings.Database.Mysql.Password
+	values["email-server"] = settings.Email.Server
+	values["email-user"] = settings.Email.User
+	values["email-password"] = settings.Email.Password
+	values["email-sender"] = settings.Email.Sender
+	if settings.Email.Port != 0 {
+		values["email-port"] = strconv.Itoa(settings.Email.Port)
+	}
+	if settings.Database.Type != "" {
+		values["db-type"] = settings.Database.Type
+	}
+
+	// Settings the wizard doesn't show, kept as they are
+	values["server-debug"] = checkbox(settings.Server.Debug)
+	values["server-production"] = checkbox(settings.Server.Production)
+	values["sqlite-path"] = settings.Database.Sqlite.Path
+	values["api-prefix"] = settings.Api.Prefix
+	values["api-version"] = strconv.Itoa(settings.Api.Version)
+
+	// The host is saved as host:port
+	if host, port, err := net.SplitHostPort(settings.Database.Mysql.Host); err == nil {
+		values["db-host"] = host
+		values["db-port"] = port
+	} else if settings.Database.Mysql.Host != "" {
+		values["db-host"] = settings.Database.Mysql.Host
+	}
+}
+
+// Returns the value a checkbox sends
+func checkbox(checked bool) string {
+	if checked {
+		return "on"
+	}
+	return ""
+}
+
+// Flattens the settings into "section.key" => value (following the toml names)
+func flattenSettings(prefix string, value reflect.Value, fields map[string]string) {
+	valueType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			flattenSettings(name, value.Field(i), fields)
+		} else {
+			fields[name] = fmt.Sprint(value.Field(i).Interface())
+		}
+	}
+}
+
+// Lists the settings that differ, hiding the passwords
+func diffSettings(old *tools.Settings, updated *tools.Settings) []SettingChange {
+	oldFields := map[string]string{}
+	newFields := map[string]string{}
+	if old != nil {
+		flattenSettings("", reflect.ValueOf(*old), oldFields)
+	}
+	flattenSettings("", reflect.ValueOf(*updated), newFields)
+
+	changes := []SettingChange{}
+	for key, newValue := range newFields {
+		oldValue, found := oldFields[key]
+		if found && oldValue == newValue {
+			continue
+		}
+		if strings.Contains(key, "password") {
+			if oldValue != "" {
+				oldValue = "********"
+			}
+			newValue = "********"
+		}
+		changes = append(changes, SettingChange{Key: key, OldValue: oldValue, NewValue: newValue})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// Copies the settings file to a timestamped backup (if it exists), returns the backup path
+func backupSettingsFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	file, backupPath, err := createBackupFile(path, ".bak", time.Now())
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(backupPath)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(backupPath)
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// Creates a backup file named after the time, never replacing another one
+// (the backups taken in the same second get a -2, -3... suffix)
+func createBackupFile(prefix, extension string, created time.Time) (*os.File, string, error) {
+	name := prefix + "." + created.Format(BACKUP_TIMESTAMP)
+	for i := 1; ; i++ {
+		path := name + extension
+		if i > 1 {
+			path = fmt.Sprintf("%s-%d%s", name, i, extension)
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		return file, path, err
+	}
+}
+
+// Lists the backups of the settings file (oldest first)
+func listSettingsBackups(path string) ([]string, error) {
+	backups, err := filepath.Glob(path + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".bak") < strings.TrimSuffix(backups[j], ".bak")
+	})
+	return backups, nil
+}
+
+// Replaces the settings file with a backup (backing up the current one first)
+func restoreSettingsBackup(path string, backupPath string) (string, error) {
+	content, err := ioutil.ReadFile(backupPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Makes sure the backup is a valid settings file
+	if _, err := toml.Decode(string(content), &tools.Settings{}); err != nil {
+		return "", fmt.Errorf("%s is not a valid settings file: %v", backupPath, err)
+	}
+
+	currentBackup, err := backupSettingsFile(path)
+	if err != nil {
+		return "", err
+	}
+	return currentBackup, ioutil.WriteFile(path, content, 0600)
+}
+
+// Lists the backups of settings.toml, or restores one of them
+func restoreSettingsCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+
+	flags := flag.NewFlagSet("restore-settings", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file to restore")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer restore-settings [--settings path] [backup]")
+		fmt.Println("Without a backup, lists the available ones.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	backups, err := listSettingsBackups(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if flags.NArg() == 0 {
+		if len(backups) == 0 {
+			fmt.Printf("There are no backups of %s\n", settingsPath)
+			return 0
+		}
+		for _, backup := range backups {
+			fmt.Println(backup)
+		}
+		return 0
+	}
+
+	// Accepts the backup path, or just its timestamp
+	backupPath := flags.Arg(0)
+	for _, backup := range backups {
+		if strings.Contains(filepath.Base(backup), "."+backupPath+".") {
+			backupPath = backup
+		}
+	}
+
+	currentBackup, err := restoreSettingsBackup(settingsPath, backupPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if currentBackup != "" {
+		fmt.Printf("Backed up the current settings to %s\n", currentBackup)
+	}
+	fmt.Printf("Restored %s from %s\n", settingsPath, backupPath)
+	return 0
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/YagoCarballo/kumquat-academy-api/tools"
+)
+
+func testSettings() *tools.Settings {
+	return &tools.Settings{
+		Title:       "Kumquat Academy",
+		Description: "The platform",
+		Database: tools.Database{
+			Type:  "MySQL",
+			Mysql: tools.MySQL{Username: "kumquat", Password: "s3cret", Host: "db.example.com:3306", Name: "kumquat"},
+		},
+		Server: tools.Server{Port: 3000, Debug: true, PrivateKey: "./privateKey.pem", PublicKey: "./publicKey.pub", UploadsPath: "./attachments"},
+		Email:  tools.Email{Server: "smtp.example.com", Port: 587, User: "mailer", Password: "mail-s3cret", Sender: "noreply@example.com"},
+		Api:    tools.Api{Prefix: "/api", Version: 1},
+	}
+}
+
+func TestMergeSettings(t *testing.T) {
+	base := testSettings()
+
+	// A stale wizard, which differs from the settings in every field
+	wizard := &tools.Settings{
+		Title:       "Old Title",
+		Description: "Old description",
+		Database: tools.Database{
+			Type:  "MySQL",
+			Mysql: tools.MySQL{Username: "root", Password: "old", Host: "localhost:3307", Name: "old"},
+		},
+		Server: tools.Server{Port: 8080, PrivateKey: "./old.pem", PublicKey: "./old.pub", UploadsPath: "./old"},
+		Email:  tools.Email{Server: "old.example.com", Port: 25},
+		Api:    tools.Api{Prefix: "/old", Version: 2},
+	}
+
+	tests := []struct {
+		changed map[string]bool
+		want    func(*tools.Settings)
+	}{
+		{nil, func(*tools.Settings) {}},
+		{map[string]bool{"page-title": true}, func(want *tools.Settings) { want.Title = "Old Title" }},
+		{map[string]bool{"db-port": true, "server-debug": true}, func(want *tools.Settings) {
+			want.Database.Mysql.Host = "localhost:3307"
+			want.Server.Debug = false
+		}},
+		{map[string]bool{"email-password": true, "api-version": true, "admin-username": true}, func(want *tools.Settings) {
+			want.Email.Password = ""
+			want.Api.Version = 2
+		}},
+	}
+	for _, test := range tests {
+		want := testSettings()
+		test.want(want)
+		if merged := mergeSettings(base, wizard, test.changed); !reflect.DeepEqual(merged, want) {
+			t.Errorf("mergeSettings(%v) = %+v, want %+v", test.changed, merged, want)
+		}
+	}
+
+	if !reflect.DeepEqual(base, testSettings()) {
+		t.Errorf("mergeSettings changed the existing settings")
+	}
+	if merged := mergeSettings(nil, wizard, nil); merged != wizard {
+		t.Errorf("mergeSettings without settings = %+v, want the wizard ones", merged)
+	}
+}
+
+// Every field the wizard saves to settings.toml can be merged
+func TestSettingsFieldsCoverSettingsToForm(t *testing.T) {
+	values := map[string]string{}
+	settingsToForm(testSettings(), values)
+	for field := range values {
+		if _, found := settingsFields[field]; !found {
+			t.Errorf("the field %s isn't in settingsFields", field)
+		}
+	}
+}
+
+func TestDiffSettingsHidesPasswords(t *testing.T) {
+	updated := testSettings()
+	updated.Database.Mysql.Password = "changed"
+	updated.Title = "New Title"
+
+	changes := diffSettings(testSettings(), updated)
+	want := []SettingChange{
+		{Key: "database.mysql.password", OldValue: "********", NewValue: "********"},
+		{Key: "title", OldValue: "Kumquat Academy", NewValue: "New Title"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diffSettings = %+v, want %+v", changes, want)
+	}
+}
+
+// A step only marks the fields the operator changed
+func TestWizardStepTracksChangedFields(t *testing.T) {
+	previousPath := wizardStatePath
+	wizardStatePath = filepath.Join(t.TempDir(), "installer-state.json")
+	defer func() { wizardStatePath = previousPath }()
+
+	state := newWizardState()
+	for _, step := range []string{"environment", "database", "administrator"} {
+		state.Completed[step] = true
+	}
+	state.Values["page-title"] = "Kumquat Academy"
+	state.Values["page-description"] = "The platform"
+	for _, field := range []string{"db-password", "admin-password", "admin-password-confirm"} {
+		state.Values[field] = "password"
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{
+		"page-title":       {"Kumquat Academy"},
+		"page-description": {"A new description"},
+		"server-port":      {"3000"},
+		"uploads-path":     {"./attachments"},
+	}
+	request := httptest.NewRequest(http.MethodPost, "/step/site", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	wizardStepHandler(response, request)
+	if response.Code != http.StatusSeeOther {
+		t.Fatalf("the step wasn't saved (status %d)", response.Code)
+	}
+
+	changed := readWizardState().Changed
+	if want := map[string]bool{"page-description": true}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("the changed fields are %v, want %v", changed, want)
+	}
+}
+
+// The secrets set by the environment never reach settings.toml
+func TestSettingsToSaveKeepsSecretsOut(t *testing.T) {
+	wizard := testSettings()
+	wizard.Database.Mysql.Password = "from-the-environment"
+	wizard.Email.Password = "from-the-environment"
+	wizard.Title = "New Title"
+	changed := map[string]bool{"db-password": true, "email-password": true, "page-title": true}
+	secrets := map[string]bool{"db-password": true, "email-password": true}
+
+	// A new installation leaves them empty
+	saved := settingsToSave(nil, wizard, changed, secrets)
+	if saved.Database.Mysql.Password != "" || saved.Email.Password != "" {
+		t.Errorf("the secrets were saved: %+v", saved)
+	}
+	if saved.Title != "New Title" || wizard.Database.Mysql.Password != "from-the-environment" {
+		t.Errorf("settingsToSave changed the wizard settings, or didn't apply them: %+v", saved)
+	}
+
+	// An existing one keeps what settings.toml had
+	saved = settingsToSave(testSettings(), wizard, changed, secrets)
+	if saved.Database.Mysql.Password != "s3cret" || saved.Email.Password != "mail-s3cret" {
+		t.Errorf("the existing secrets weren't kept: %+v", saved)
+	}
+	if saved.Title != "New Title" {
+		t.Errorf("the title wasn't applied: %+v", saved)
+	}
+}
+
+// The backups taken in the same second don't replace each other, and list in order
+func TestBackupSettingsFileSameSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.toml")
+	paths := []string{}
+	for _, content := range []string{"first", "second", "third"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		backupPath, err := backupSettingsFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, backupPath)
+	}
+
+	backups, err := listSettingsBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(backups, paths) {
+		t.Fatalf("listSettingsBackups = %q, want %q", backups, paths)
+	}
+	for i, content := range []string{"first", "second", "third"} {
+		if saved, _ := ioutil.ReadFile(backups[i]); string(saved) != content {
+			t.Errorf("%s has %q, want %q", backups[i], saved, content)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Formats the dates of the spreadsheets are read in (the registry uses the UK one)
+var spreadsheetDateLayouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", "02-01-2006", "2006/01/02", "02.01.2006"}
+
+// A row of a spreadsheet, by field (the line is the one shown in the reports)
+type SpreadsheetRow struct {
+	Line   int
+	Values map[string]string
+}
+
+// Reads the rows of a CSV or XLSX file (the first sheet, unless one is given)
+func readSpreadsheet(path, sheet string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		file, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("can't open %s: %v", path, err)
+		}
+		defer file.Close()
+
+		if sheet == "" {
+			sheet = file.GetSheetName(0)
+		}
+		rows, err := file.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the sheet %q of %s: %v", sheet, path, err)
+		}
+		return rows, nil
+	case ".csv", ".txt":
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("can't read %s: %v", path, err)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("%s isn't a CSV or XLSX file", path)
+	}
+}
+
+// Normalizes a column header (e.g. "First Name" and "first_name" are the same)
+func normalizeHeader(header string) string {
+	normalized := []rune{}
+	for _, r := range strings.ToLower(strings.TrimPrefix(header, "\ufeff")) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			normalized = append(normalized, r)
+		}
+	}
+	return string(normalized)
+}
+
+// Parses the --columns flag (e.g. "email=E-mail Address,matric_number=Student ID")
+func parseColumnOverrides(value string, fields []string) (map[string]string, error) {
+	overrides := map[string]string{}
+	if value == "" {
+		return overrides, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid column %q, use field=header", pair)
+		}
+		field := strings.TrimSpace(parts[0])
+		known := false
+		for _, name := range fields {
+			known = known || name == field
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown field %q, use one of: %s", field, strings.Join(fields, ", "))
+		}
+		overrides[field] = strings.TrimSpace(parts[1])
+	}
+	return overrides, nil
+}
+
+// Maps the rows of a spreadsheet to fields by their headers (the first row).
+//
+// Each field has the headers it's known by, the overrides win over them.
+func mapSpreadsheetRows(rows [][]string, fields []string, aliases map[string][]string, overrides map[string]string, required []string) ([]SpreadsheetRow, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	columns := map[string]int{}
+	for index, header := range rows[0] {
+		normalized := normalizeHeader(header)
+		for _, field := range fields {
+			if override, found := overrides[field]; found {
+				if normalized == normalizeHeader(override) {
+					columns[field] = index
+				}
+				continue
+			}
+			for _, alias := range append([]string{field}, aliases[field]...) {
+				if _, mapped := columns[field]; !mapped && normalized == normalizeHeader(alias) {
+					columns[field] = index
+				}
+			}
+		}
+	}
+	for _, field := range required {
+		if _, found := columns[field]; !found {
+			return nil, fmt.Errorf("there is no column for %s (use --columns %s=<header>)", field, field)
+		}
+	}
+
+	mapped := []SpreadsheetRow{}
+	for i, row := range rows[1:] {
+		values := map[string]string{}
+		empty := true
+		for field, index := range columns {
+			if index < len(row) {
+				values[field] = strings.TrimSpace(row[index])
+				empty = empty && values[field] == ""
+			}
+		}
+		if !empty {
+			mapped = append(mapped, SpreadsheetRow{Line: i + 2, Values: values})
+		}
+	}
+	return mapped, nil
+}
+
+// Parses a date of a spreadsheet (in the given layout, one of the usual ones or as an Excel serial number)
+func parseSpreadsheetDate(value, layout string) (time.Time, error) {
+	gmt := time.FixedZone("GMT", 0)
+	layouts := spreadsheetDateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, layout := range layouts {
+		if date, err := time.ParseInLocation(layout, value, gmt); err == nil {
+			return date, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		if date, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, gmt), nil
+		}
+	}
+	if layout == "" {
+		layout = "YYYY-MM-DD or DD/MM/YYYY"
+	}
+	return time.Time{}, fmt.Errorf("can't read the date %q (use %s)", value, layout)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := map[string]string{
+		"First Name":      "firstname",
+		"first_name":      "firstname",
+		"\ufeffE-mail":    "email",
+		" Matric No. ":    "matricno",
+		"Date of Birth ✓": "dateofbirth",
+	}
+	for header, want := range tests {
+		if got := normalizeHeader(header); got != want {
+			t.Errorf("normalizeHeader(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestParseColumnOverrides(t *testing.T) {
+	fields := []string{"email", "matric_number"}
+	overrides, err := parseColumnOverrides("email=E-mail Address, matric_number = Student ID", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"email": "E-mail Address", "matric_number": "Student ID"}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("parseColumnOverrides = %v, want %v", overrides, want)
+	}
+
+	for _, value := range []string{"email", "phone=Phone"} {
+		if _, err := parseColumnOverrides(value, fields); err == nil {
+			t.Errorf("parseColumnOverrides(%q) didn't fail", value)
+		}
+	}
+}
+
+func TestMapSpreadsheetRows(t *testing.T) {
+	fields := []string{"email", "first_name", "matric_number"}
+	aliases := map[string][]string{"first_name": {"forename"}, "matric_number": {"matric"}}
+	rows := [][]string{
+		{"Forename", "E-mail", "Student ID", "Notes"},
+		{" Jane ", "jane@example.com", "140001", "x"},
+		{"", "", "", "only notes"},
+		{"John"},
+	}
+
+	mapped, err := mapSpreadsheetRows(rows, fields, aliases, map[string]string{"matric_number": "Student ID"}, []string{"email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SpreadsheetRow{
+		{Line: 2, Values: map[string]string{"first_name": "Jane", "email": "jane@example.com", "matric_number": "140001"}},
+		{Line: 4, Values: map[string]string{"first_name": "John"}},
+	}
+	if !reflect.DeepEqual(mapped, want) {
+		t.Errorf("mapSpreadsheetRows = %+v, want %+v", mapped, want)
+	}
+
+	if _, err := mapSpreadsheetRows(rows, fields, nil, nil, []string{"first_name"}); err == nil {
+		t.Errorf("mapSpreadsheetRows didn't fail without a column for first_name")
+	}
+	if _, err := mapSpreadsheetRows(nil, fields, aliases, nil, nil); err == nil {
+		t.Errorf("mapSpreadsheetRows didn't fail on an empty file")
+	}
+}
+
+func TestParseSpreadsheetDate(t *testing.T) {
+	want := time.Date(1990, 2, 9, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value, layout string
+		ok            bool
+	}{
+		{"1990-02-09", "", true},
+		{"09/02/1990", "", true},
+		{"9/2/1990", "", true},
+		{"09.02.1990", "", true},
+		{"32913", "", true}, // Excel serial number
+		{"02/09/1990", "01/02/2006", true},
+		{"09/02/1990", "2006-01-02", false},
+		{"yesterday", "", false},
+		{"-1", "", false},
+	}
+	for _, test := range tests {
+		date, err := parseSpreadsheetDate(test.value, test.layout)
+		if test.ok && (err != nil || !date.Equal(want)) {
+			t.Errorf("parseSpreadsheetDate(%q, %q) = %v, %v, want %v", test.value, test.layout, date, err, want)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("parseSpreadsheetDate(%q, %q) didn't fail", test.value, test.layout)
+		}
+	}
+}
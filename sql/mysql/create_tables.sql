@@ -0,0 +1,289 @@
+-- Generated by `installer sql` from the models of the platform, don't edit it by hand.
+
+-- users
+CREATE TABLE `users` (
+  `id` int unsigned AUTO_INCREMENT,
+  `username` varchar(255) NOT NULL UNIQUE,
+  `password` varchar(255),
+  `email` varchar(255) UNIQUE,
+  `first_name` varchar(255),
+  `last_name` varchar(255),
+  `date_of_birth` DATETIME NULL,
+  `matric_number` varchar(255) UNIQUE,
+  `matric_date` DATETIME NULL,
+  `active` boolean,
+  `admin` boolean,
+  `avatar_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- sessions
+CREATE TABLE `sessions` (
+  `token` varchar(255),
+  `user_id` int unsigned,
+  `device_id` varchar(255),
+  `expires_in` DATETIME NULL,
+  `created_on` DATETIME NULL,
+  PRIMARY KEY (`token`)
+) ENGINE=InnoDB;
+
+-- courses
+CREATE TABLE `courses` (
+  `id` int unsigned AUTO_INCREMENT,
+  `title` varchar(255),
+  `description` varchar(255),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- classes
+CREATE TABLE `classes` (
+  `id` int unsigned AUTO_INCREMENT,
+  `course_id` int unsigned,
+  `title` varchar(255),
+  `start` DATETIME NULL,
+  `end` DATETIME NULL,
+  PRIMARY KEY (`id`, `course_id`)
+) ENGINE=InnoDB;
+CREATE UNIQUE INDEX `idx_class_course_title` ON `classes` (`course_id`, `title`);
+
+-- course_levels
+CREATE TABLE `course_levels` (
+  `level` int unsigned,
+  `course_id` int unsigned,
+  `class_id` int unsigned,
+  `start` DATETIME NULL,
+  `end` DATETIME NULL,
+  PRIMARY KEY (`level`, `class_id`)
+) ENGINE=InnoDB;
+
+-- modules
+CREATE TABLE `modules` (
+  `id` int unsigned AUTO_INCREMENT,
+  `title` varchar(255),
+  `color` varchar(255),
+  `icon` varchar(255),
+  `duration` int unsigned,
+  `description` varchar(255),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- roles
+CREATE TABLE `roles` (
+  `id` int unsigned AUTO_INCREMENT,
+  `name` varchar(255),
+  `description` varchar(255),
+  `can_read` boolean,
+  `can_write` boolean,
+  `can_delete` boolean,
+  `can_update` boolean,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- level_modules
+CREATE TABLE `level_modules` (
+  `code` varchar(255),
+  `level` int unsigned,
+  `class_id` int unsigned,
+  `module_id` int unsigned,
+  `status` varchar(255),
+  `start` DATETIME NULL,
+  PRIMARY KEY (`code`)
+) ENGINE=InnoDB;
+
+-- user_modules
+CREATE TABLE `user_modules` (
+  `user_id` int unsigned,
+  `module_code` varchar(255),
+  `role_id` int unsigned,
+  `class_id` int unsigned,
+  PRIMARY KEY (`user_id`, `module_code`)
+) ENGINE=InnoDB;
+
+-- user_courses
+CREATE TABLE `user_courses` (
+  `user_id` int unsigned,
+  `course_id` int unsigned,
+  `role_id` int unsigned,
+  PRIMARY KEY (`user_id`, `course_id`)
+) ENGINE=InnoDB;
+
+-- attachments
+CREATE TABLE `attachments` (
+  `id` int unsigned AUTO_INCREMENT,
+  `name` varchar(255),
+  `type` varchar(255),
+  `url` varchar(255),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- assignments
+CREATE TABLE `assignments` (
+  `id` int unsigned AUTO_INCREMENT,
+  `title` varchar(255),
+  `description` varchar(255),
+  `status` varchar(255),
+  `weight` double,
+  `start` DATETIME NULL,
+  `end` DATETIME NULL,
+  `module_code` varchar(255),
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- exams
+CREATE TABLE `exams` (
+  `id` int unsigned AUTO_INCREMENT,
+  `module_code` varchar(255),
+  `attachment_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- pages
+CREATE TABLE `pages` (
+  `id` int unsigned AUTO_INCREMENT,
+  `module_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- lecture_slots
+CREATE TABLE `lecture_slots` (
+  `id` int unsigned AUTO_INCREMENT,
+  `module_id` int unsigned,
+  `location` varchar(255),
+  `type` varchar(255),
+  `start` DATETIME NULL,
+  `end` DATETIME NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- lectures
+CREATE TABLE `lectures` (
+  `id` int unsigned AUTO_INCREMENT,
+  `description` varchar(255),
+  `module_id` int unsigned,
+  `lecture_slot_id` int unsigned,
+  `location` varchar(255),
+  `topic` varchar(255),
+  `start` DATETIME NULL,
+  `end` DATETIME NULL,
+  `canceled` boolean,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- materials
+CREATE TABLE `materials` (
+  `id` int unsigned AUTO_INCREMENT,
+  `module_id` int unsigned,
+  `lecture_id` int unsigned,
+  `attachment_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- submissions
+CREATE TABLE `submissions` (
+  `id` int unsigned AUTO_INCREMENT,
+  `user_id` int unsigned,
+  `assignment_id` int unsigned,
+  `attachment_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- student_exams
+CREATE TABLE `student_exams` (
+  `user_id` int unsigned,
+  `exam_id` int unsigned,
+  PRIMARY KEY (`user_id`, `exam_id`)
+) ENGINE=InnoDB;
+
+-- announcements
+CREATE TABLE `announcements` (
+  `id` int unsigned AUTO_INCREMENT,
+  `user_id` int unsigned,
+  `module_id` int unsigned,
+  `assignment_id` int unsigned,
+  `course_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- teams
+CREATE TABLE `teams` (
+  `id` int unsigned AUTO_INCREMENT,
+  `assignment_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- team_members
+CREATE TABLE `team_members` (
+  `team_id` int unsigned,
+  `user_id` int unsigned,
+  PRIMARY KEY (`team_id`, `user_id`)
+) ENGINE=InnoDB;
+
+-- tasks
+CREATE TABLE `tasks` (
+  `id` int unsigned AUTO_INCREMENT,
+  `assignment_id` int unsigned,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+-- completed_tasks
+CREATE TABLE `completed_tasks` (
+  `user_id` int unsigned,
+  `task_id` int unsigned,
+  PRIMARY KEY (`user_id`, `task_id`)
+) ENGINE=InnoDB;
+
+-- team_completed_tasks
+CREATE TABLE `team_completed_tasks` (
+  `team_id` int unsigned,
+  `task_id` int unsigned,
+  PRIMARY KEY (`team_id`, `task_id`)
+) ENGINE=InnoDB;
+
+-- reset_passwords
+CREATE TABLE `reset_passwords` (
+  `token` varchar(255),
+  `user_id` int unsigned,
+  `expires_in` DATETIME NULL,
+  PRIMARY KEY (`token`)
+) ENGINE=InnoDB;
+
+-- Foreign keys
+ALTER TABLE `sessions` ADD CONSTRAINT `sessions_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `classes` ADD CONSTRAINT `classes_course_id_courses_id_foreign` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `course_levels` ADD CONSTRAINT `fk_courseLevels_classes` FOREIGN KEY (`class_id`, `course_id`) REFERENCES `classes` (`id`, `course_id`);
+ALTER TABLE `level_modules` ADD CONSTRAINT `fk_levelModules_courseLevels_course_class` FOREIGN KEY (`level`, `class_id`) REFERENCES `course_levels` (`level`, `class_id`);
+ALTER TABLE `level_modules` ADD CONSTRAINT `level_modules_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_modules` ADD CONSTRAINT `user_modules_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_modules` ADD CONSTRAINT `user_modules_module_code_level_modules_code_foreign` FOREIGN KEY (`module_code`) REFERENCES `level_modules` (`code`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_modules` ADD CONSTRAINT `user_modules_role_id_roles_id_foreign` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_modules` ADD CONSTRAINT `user_modules_class_id_classes_id_foreign` FOREIGN KEY (`class_id`) REFERENCES `classes` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_courses` ADD CONSTRAINT `user_courses_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_courses` ADD CONSTRAINT `user_courses_course_id_courses_id_foreign` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `user_courses` ADD CONSTRAINT `user_courses_role_id_roles_id_foreign` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `assignments` ADD CONSTRAINT `assignments_module_code_level_modules_code_foreign` FOREIGN KEY (`module_code`) REFERENCES `level_modules` (`code`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `exams` ADD CONSTRAINT `exams_module_code_level_modules_code_foreign` FOREIGN KEY (`module_code`) REFERENCES `level_modules` (`code`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `exams` ADD CONSTRAINT `exams_attachment_id_attachments_id_foreign` FOREIGN KEY (`attachment_id`) REFERENCES `attachments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `pages` ADD CONSTRAINT `pages_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `lecture_slots` ADD CONSTRAINT `lecture_slots_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `lectures` ADD CONSTRAINT `lectures_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `materials` ADD CONSTRAINT `materials_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `materials` ADD CONSTRAINT `materials_lecture_id_lectures_id_foreign` FOREIGN KEY (`lecture_id`) REFERENCES `lectures` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `materials` ADD CONSTRAINT `materials_attachment_id_attachments_id_foreign` FOREIGN KEY (`attachment_id`) REFERENCES `attachments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `submissions` ADD CONSTRAINT `submissions_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `submissions` ADD CONSTRAINT `submissions_assignment_id_assignments_id_foreign` FOREIGN KEY (`assignment_id`) REFERENCES `assignments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `submissions` ADD CONSTRAINT `submissions_attachment_id_attachments_id_foreign` FOREIGN KEY (`attachment_id`) REFERENCES `attachments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `student_exams` ADD CONSTRAINT `student_exams_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `student_exams` ADD CONSTRAINT `student_exams_exam_id_exams_id_foreign` FOREIGN KEY (`exam_id`) REFERENCES `exams` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `announcements` ADD CONSTRAINT `announcements_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `announcements` ADD CONSTRAINT `announcements_module_id_modules_id_foreign` FOREIGN KEY (`module_id`) REFERENCES `modules` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `announcements` ADD CONSTRAINT `announcements_assignment_id_assignments_id_foreign` FOREIGN KEY (`assignment_id`) REFERENCES `assignments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `announcements` ADD CONSTRAINT `announcements_course_id_courses_id_foreign` FOREIGN KEY (`course_id`) REFERENCES `courses` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `teams` ADD CONSTRAINT `teams_assignment_id_assignments_id_foreign` FOREIGN KEY (`assignment_id`) REFERENCES `assignments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `team_members` ADD CONSTRAINT `team_members_team_id_teams_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `team_members` ADD CONSTRAINT `team_members_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `tasks` ADD CONSTRAINT `tasks_assignment_id_assignments_id_foreign` FOREIGN KEY (`assignment_id`) REFERENCES `assignments` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `completed_tasks` ADD CONSTRAINT `completed_tasks_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `completed_tasks` ADD CONSTRAINT `completed_tasks_task_id_tasks_id_foreign` FOREIGN KEY (`task_id`) REFERENCES `tasks` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `team_completed_tasks` ADD CONSTRAINT `team_completed_tasks_team_id_teams_id_foreign` FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `team_completed_tasks` ADD CONSTRAINT `team_completed_tasks_task_id_tasks_id_foreign` FOREIGN KEY (`task_id`) REFERENCES `tasks` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE `reset_passwords` ADD CONSTRAINT `reset_passwords_user_id_users_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;
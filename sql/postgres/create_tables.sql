@@ -0,0 +1,289 @@
+-- Generated by `installer sql` from the models of the platform, don't edit it by hand.
+
+-- users
+CREATE TABLE "users" (
+  "id" bigserial,
+  "username" text NOT NULL UNIQUE,
+  "password" text,
+  "email" text UNIQUE,
+  "first_name" text,
+  "last_name" text,
+  "date_of_birth" timestamp with time zone,
+  "matric_number" text UNIQUE,
+  "matric_date" timestamp with time zone,
+  "active" boolean,
+  "admin" boolean,
+  "avatar_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- sessions
+CREATE TABLE "sessions" (
+  "token" text,
+  "user_id" bigint,
+  "device_id" text,
+  "expires_in" timestamp with time zone,
+  "created_on" timestamp with time zone,
+  PRIMARY KEY ("token")
+);
+
+-- courses
+CREATE TABLE "courses" (
+  "id" bigserial,
+  "title" text,
+  "description" text,
+  PRIMARY KEY ("id")
+);
+
+-- classes
+CREATE TABLE "classes" (
+  "id" bigserial,
+  "course_id" bigint,
+  "title" text,
+  "start" timestamp with time zone,
+  "end" timestamp with time zone,
+  PRIMARY KEY ("id", "course_id")
+);
+CREATE UNIQUE INDEX "idx_class_course_title" ON "classes" ("course_id", "title");
+
+-- course_levels
+CREATE TABLE "course_levels" (
+  "level" bigint,
+  "course_id" bigint,
+  "class_id" bigint,
+  "start" timestamp with time zone,
+  "end" timestamp with time zone,
+  PRIMARY KEY ("level", "class_id")
+);
+
+-- modules
+CREATE TABLE "modules" (
+  "id" bigserial,
+  "title" text,
+  "color" text,
+  "icon" text,
+  "duration" bigint,
+  "description" text,
+  PRIMARY KEY ("id")
+);
+
+-- roles
+CREATE TABLE "roles" (
+  "id" bigserial,
+  "name" text,
+  "description" text,
+  "can_read" boolean,
+  "can_write" boolean,
+  "can_delete" boolean,
+  "can_update" boolean,
+  PRIMARY KEY ("id")
+);
+
+-- level_modules
+CREATE TABLE "level_modules" (
+  "code" text,
+  "level" bigint,
+  "class_id" bigint,
+  "module_id" bigint,
+  "status" text,
+  "start" timestamp with time zone,
+  PRIMARY KEY ("code")
+);
+
+-- user_modules
+CREATE TABLE "user_modules" (
+  "user_id" bigint,
+  "module_code" text,
+  "role_id" bigint,
+  "class_id" bigint,
+  PRIMARY KEY ("user_id", "module_code")
+);
+
+-- user_courses
+CREATE TABLE "user_courses" (
+  "user_id" bigint,
+  "course_id" bigint,
+  "role_id" bigint,
+  PRIMARY KEY ("user_id", "course_id")
+);
+
+-- attachments
+CREATE TABLE "attachments" (
+  "id" bigserial,
+  "name" text,
+  "type" text,
+  "url" text,
+  PRIMARY KEY ("id")
+);
+
+-- assignments
+CREATE TABLE "assignments" (
+  "id" bigserial,
+  "title" text,
+  "description" text,
+  "status" text,
+  "weight" numeric,
+  "start" timestamp with time zone,
+  "end" timestamp with time zone,
+  "module_code" text,
+  PRIMARY KEY ("id")
+);
+
+-- exams
+CREATE TABLE "exams" (
+  "id" bigserial,
+  "module_code" text,
+  "attachment_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- pages
+CREATE TABLE "pages" (
+  "id" bigserial,
+  "module_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- lecture_slots
+CREATE TABLE "lecture_slots" (
+  "id" bigserial,
+  "module_id" bigint,
+  "location" text,
+  "type" text,
+  "start" timestamp with time zone,
+  "end" timestamp with time zone,
+  PRIMARY KEY ("id")
+);
+
+-- lectures
+CREATE TABLE "lectures" (
+  "id" bigserial,
+  "description" text,
+  "module_id" bigint,
+  "lecture_slot_id" bigint,
+  "location" text,
+  "topic" text,
+  "start" timestamp with time zone,
+  "end" timestamp with time zone,
+  "canceled" boolean,
+  PRIMARY KEY ("id")
+);
+
+-- materials
+CREATE TABLE "materials" (
+  "id" bigserial,
+  "module_id" bigint,
+  "lecture_id" bigint,
+  "attachment_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- submissions
+CREATE TABLE "submissions" (
+  "id" bigserial,
+  "user_id" bigint,
+  "assignment_id" bigint,
+  "attachment_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- student_exams
+CREATE TABLE "student_exams" (
+  "user_id" bigint,
+  "exam_id" bigint,
+  PRIMARY KEY ("user_id", "exam_id")
+);
+
+-- announcements
+CREATE TABLE "announcements" (
+  "id" bigserial,
+  "user_id" bigint,
+  "module_id" bigint,
+  "assignment_id" bigint,
+  "course_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- teams
+CREATE TABLE "teams" (
+  "id" bigserial,
+  "assignment_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- team_members
+CREATE TABLE "team_members" (
+  "team_id" bigint,
+  "user_id" bigint,
+  PRIMARY KEY ("team_id", "user_id")
+);
+
+-- tasks
+CREATE TABLE "tasks" (
+  "id" bigserial,
+  "assignment_id" bigint,
+  PRIMARY KEY ("id")
+);
+
+-- completed_tasks
+CREATE TABLE "completed_tasks" (
+  "user_id" bigint,
+  "task_id" bigint,
+  PRIMARY KEY ("user_id", "task_id")
+);
+
+-- team_completed_tasks
+CREATE TABLE "team_completed_tasks" (
+  "team_id" bigint,
+  "task_id" bigint,
+  PRIMARY KEY ("team_id", "task_id")
+);
+
+-- reset_passwords
+CREATE TABLE "reset_passwords" (
+  "token" text,
+  "user_id" bigint,
+  "expires_in" timestamp with time zone,
+  PRIMARY KEY ("token")
+);
+
+-- Foreign keys
+ALTER TABLE "sessions" ADD CONSTRAINT "sessions_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "classes" ADD CONSTRAINT "classes_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "course_levels" ADD CONSTRAINT "fk_courseLevels_classes" FOREIGN KEY ("class_id", "course_id") REFERENCES "classes" ("id", "course_id");
+ALTER TABLE "level_modules" ADD CONSTRAINT "fk_levelModules_courseLevels_course_class" FOREIGN KEY ("level", "class_id") REFERENCES "course_levels" ("level", "class_id");
+ALTER TABLE "level_modules" ADD CONSTRAINT "level_modules_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_modules" ADD CONSTRAINT "user_modules_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_modules" ADD CONSTRAINT "user_modules_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_modules" ADD CONSTRAINT "user_modules_role_id_roles_id_foreign" FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_modules" ADD CONSTRAINT "user_modules_class_id_classes_id_foreign" FOREIGN KEY ("class_id") REFERENCES "classes" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_courses" ADD CONSTRAINT "user_courses_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_courses" ADD CONSTRAINT "user_courses_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "user_courses" ADD CONSTRAINT "user_courses_role_id_roles_id_foreign" FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "assignments" ADD CONSTRAINT "assignments_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "exams" ADD CONSTRAINT "exams_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "exams" ADD CONSTRAINT "exams_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "pages" ADD CONSTRAINT "pages_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "lecture_slots" ADD CONSTRAINT "lecture_slots_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "lectures" ADD CONSTRAINT "lectures_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "materials" ADD CONSTRAINT "materials_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "materials" ADD CONSTRAINT "materials_lecture_id_lectures_id_foreign" FOREIGN KEY ("lecture_id") REFERENCES "lectures" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "materials" ADD CONSTRAINT "materials_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "submissions" ADD CONSTRAINT "submissions_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "submissions" ADD CONSTRAINT "submissions_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "submissions" ADD CONSTRAINT "submissions_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "student_exams" ADD CONSTRAINT "student_exams_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "student_exams" ADD CONSTRAINT "student_exams_exam_id_exams_id_foreign" FOREIGN KEY ("exam_id") REFERENCES "exams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "announcements" ADD CONSTRAINT "announcements_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "announcements" ADD CONSTRAINT "announcements_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "announcements" ADD CONSTRAINT "announcements_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "announcements" ADD CONSTRAINT "announcements_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "teams" ADD CONSTRAINT "teams_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "team_members" ADD CONSTRAINT "team_members_team_id_teams_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "team_members" ADD CONSTRAINT "team_members_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "tasks" ADD CONSTRAINT "tasks_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "completed_tasks" ADD CONSTRAINT "completed_tasks_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "completed_tasks" ADD CONSTRAINT "completed_tasks_task_id_tasks_id_foreign" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "team_completed_tasks" ADD CONSTRAINT "team_completed_tasks_team_id_teams_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "team_completed_tasks" ADD CONSTRAINT "team_completed_tasks_task_id_tasks_id_foreign" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
+ALTER TABLE "reset_passwords" ADD CONSTRAINT "reset_passwords_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT;
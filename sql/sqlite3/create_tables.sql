@@ -0,0 +1,271 @@
+-- Generated by `installer sql` from the models of the platform, don't edit it by hand.
+
+-- users
+CREATE TABLE "users" (
+  "id" integer primary key autoincrement,
+  "username" varchar(255) NOT NULL UNIQUE,
+  "password" varchar(255),
+  "email" varchar(255) UNIQUE,
+  "first_name" varchar(255),
+  "last_name" varchar(255),
+  "date_of_birth" datetime,
+  "matric_number" varchar(255) UNIQUE,
+  "matric_date" datetime,
+  "active" bool,
+  "admin" bool,
+  "avatar_id" integer
+);
+
+-- sessions
+CREATE TABLE "sessions" (
+  "token" varchar(255),
+  "user_id" integer,
+  "device_id" varchar(255),
+  "expires_in" datetime,
+  "created_on" datetime,
+  PRIMARY KEY ("token"),
+  CONSTRAINT "sessions_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- courses
+CREATE TABLE "courses" (
+  "id" integer primary key autoincrement,
+  "title" varchar(255),
+  "description" varchar(255)
+);
+
+-- classes
+CREATE TABLE "classes" (
+  "id" integer primary key autoincrement,
+  "course_id" integer,
+  "title" varchar(255),
+  "start" datetime,
+  "end" datetime,
+  CONSTRAINT "classes_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+CREATE UNIQUE INDEX "idx_class_course_title" ON "classes" ("course_id", "title");
+
+-- course_levels
+CREATE TABLE "course_levels" (
+  "level" integer,
+  "course_id" integer,
+  "class_id" integer,
+  "start" datetime,
+  "end" datetime,
+  PRIMARY KEY ("level", "class_id"),
+  CONSTRAINT "fk_courseLevels_classes" FOREIGN KEY ("class_id", "course_id") REFERENCES "classes" ("id", "course_id")
+);
+
+-- modules
+CREATE TABLE "modules" (
+  "id" integer primary key autoincrement,
+  "title" varchar(255),
+  "color" varchar(255),
+  "icon" varchar(255),
+  "duration" integer,
+  "description" varchar(255)
+);
+
+-- roles
+CREATE TABLE "roles" (
+  "id" integer primary key autoincrement,
+  "name" varchar(255),
+  "description" varchar(255),
+  "can_read" bool,
+  "can_write" bool,
+  "can_delete" bool,
+  "can_update" bool
+);
+
+-- level_modules
+CREATE TABLE "level_modules" (
+  "code" varchar(255),
+  "level" integer,
+  "class_id" integer,
+  "module_id" integer,
+  "status" varchar(255),
+  "start" datetime,
+  PRIMARY KEY ("code"),
+  CONSTRAINT "fk_levelModules_courseLevels_course_class" FOREIGN KEY ("level", "class_id") REFERENCES "course_levels" ("level", "class_id"),
+  CONSTRAINT "level_modules_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- user_modules
+CREATE TABLE "user_modules" (
+  "user_id" integer,
+  "module_code" varchar(255),
+  "role_id" integer,
+  "class_id" integer,
+  PRIMARY KEY ("user_id", "module_code"),
+  CONSTRAINT "user_modules_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "user_modules_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "user_modules_role_id_roles_id_foreign" FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "user_modules_class_id_classes_id_foreign" FOREIGN KEY ("class_id") REFERENCES "classes" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- user_courses
+CREATE TABLE "user_courses" (
+  "user_id" integer,
+  "course_id" integer,
+  "role_id" integer,
+  PRIMARY KEY ("user_id", "course_id"),
+  CONSTRAINT "user_courses_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "user_courses_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "user_courses_role_id_roles_id_foreign" FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- attachments
+CREATE TABLE "attachments" (
+  "id" integer primary key autoincrement,
+  "name" varchar(255),
+  "type" varchar(255),
+  "url" varchar(255)
+);
+
+-- assignments
+CREATE TABLE "assignments" (
+  "id" integer primary key autoincrement,
+  "title" varchar(255),
+  "description" varchar(255),
+  "status" varchar(255),
+  "weight" real,
+  "start" datetime,
+  "end" datetime,
+  "module_code" varchar(255),
+  CONSTRAINT "assignments_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- exams
+CREATE TABLE "exams" (
+  "id" integer primary key autoincrement,
+  "module_code" varchar(255),
+  "attachment_id" integer,
+  CONSTRAINT "exams_module_code_level_modules_code_foreign" FOREIGN KEY ("module_code") REFERENCES "level_modules" ("code") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "exams_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- pages
+CREATE TABLE "pages" (
+  "id" integer primary key autoincrement,
+  "module_id" integer,
+  CONSTRAINT "pages_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- lecture_slots
+CREATE TABLE "lecture_slots" (
+  "id" integer primary key autoincrement,
+  "module_id" integer,
+  "location" varchar(255),
+  "type" varchar(255),
+  "start" datetime,
+  "end" datetime,
+  CONSTRAINT "lecture_slots_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- lectures
+CREATE TABLE "lectures" (
+  "id" integer primary key autoincrement,
+  "description" varchar(255),
+  "module_id" integer,
+  "lecture_slot_id" integer,
+  "location" varchar(255),
+  "topic" varchar(255),
+  "start" datetime,
+  "end" datetime,
+  "canceled" bool,
+  CONSTRAINT "lectures_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- materials
+CREATE TABLE "materials" (
+  "id" integer primary key autoincrement,
+  "module_id" integer,
+  "lecture_id" integer,
+  "attachment_id" integer,
+  CONSTRAINT "materials_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "materials_lecture_id_lectures_id_foreign" FOREIGN KEY ("lecture_id") REFERENCES "lectures" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "materials_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- submissions
+CREATE TABLE "submissions" (
+  "id" integer primary key autoincrement,
+  "user_id" integer,
+  "assignment_id" integer,
+  "attachment_id" integer,
+  CONSTRAINT "submissions_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "submissions_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "submissions_attachment_id_attachments_id_foreign" FOREIGN KEY ("attachment_id") REFERENCES "attachments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- student_exams
+CREATE TABLE "student_exams" (
+  "user_id" integer,
+  "exam_id" integer,
+  PRIMARY KEY ("user_id", "exam_id"),
+  CONSTRAINT "student_exams_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "student_exams_exam_id_exams_id_foreign" FOREIGN KEY ("exam_id") REFERENCES "exams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- announcements
+CREATE TABLE "announcements" (
+  "id" integer primary key autoincrement,
+  "user_id" integer,
+  "module_id" integer,
+  "assignment_id" integer,
+  "course_id" integer,
+  CONSTRAINT "announcements_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "announcements_module_id_modules_id_foreign" FOREIGN KEY ("module_id") REFERENCES "modules" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "announcements_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "announcements_course_id_courses_id_foreign" FOREIGN KEY ("course_id") REFERENCES "courses" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- teams
+CREATE TABLE "teams" (
+  "id" integer primary key autoincrement,
+  "assignment_id" integer,
+  CONSTRAINT "teams_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- team_members
+CREATE TABLE "team_members" (
+  "team_id" integer,
+  "user_id" integer,
+  PRIMARY KEY ("team_id", "user_id"),
+  CONSTRAINT "team_members_team_id_teams_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "team_members_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- tasks
+CREATE TABLE "tasks" (
+  "id" integer primary key autoincrement,
+  "assignment_id" integer,
+  CONSTRAINT "tasks_assignment_id_assignments_id_foreign" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- completed_tasks
+CREATE TABLE "completed_tasks" (
+  "user_id" integer,
+  "task_id" integer,
+  PRIMARY KEY ("user_id", "task_id"),
+  CONSTRAINT "completed_tasks_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "completed_tasks_task_id_tasks_id_foreign" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- team_completed_tasks
+CREATE TABLE "team_completed_tasks" (
+  "team_id" integer,
+  "task_id" integer,
+  PRIMARY KEY ("team_id", "task_id"),
+  CONSTRAINT "team_completed_tasks_team_id_teams_id_foreign" FOREIGN KEY ("team_id") REFERENCES "teams" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT,
+  CONSTRAINT "team_completed_tasks_task_id_tasks_id_foreign" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+-- reset_passwords
+CREATE TABLE "reset_passwords" (
+  "token" varchar(255),
+  "user_id" integer,
+  "expires_in" datetime,
+  PRIMARY KEY ("token"),
+  CONSTRAINT "reset_passwords_user_id_users_id_foreign" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE RESTRICT ON UPDATE RESTRICT
+);
@@ -0,0 +1,71 @@
+-- Generated by `installer sql` from the models of the platform, don't edit it by hand.
+-- Apply the create_tables.sql of this directory first, the records that exist already are skipped.
+-- The dates are relative to 2016-09-12.
+
+INSERT OR IGNORE INTO "attachments" ("id", "name", "type", "url") VALUES (1, '82.jpg', 'image/jpg', '1f77fb90-c32b-4de4-804d-a0cb7dde4cd5');
+INSERT OR IGNORE INTO "attachments" ("id", "name", "type", "url") VALUES (2, '62.jpg', 'image/jpg', '3abef575-0101-4487-8715-64bf2e430083');
+INSERT OR IGNORE INTO "attachments" ("id", "name", "type", "url") VALUES (3, '11.jpg', 'image/jpg', '3b891aae-8ea0-4324-8a3e-b667b5ea23d9');
+INSERT OR IGNORE INTO "attachments" ("id", "name", "type", "url") VALUES (4, '40.jpg', 'image/jpg', 'dab71f4f-3f65-487b-8f9d-5bacd3d92bc1');
+
+INSERT OR IGNORE INTO "users" ("id", "username", "password", "email", "first_name", "last_name", "date_of_birth", "matric_number", "matric_date", "active", "admin", "avatar_id") VALUES (1, 'admin', '$2a$10$1rqCHXRQ1h0se3jnJO5ZtuX5keEQOTPL1Tkb4W4yEAcV0x26l7KEO', 'jane.johnston68@example.com', 'Jane', 'Johnston', '1970-02-09 00:00:00', '000000000', '2016-09-12 00:00:00', 1, 1, 1);
+INSERT OR IGNORE INTO "users" ("id", "username", "password", "email", "first_name", "last_name", "date_of_birth", "matric_number", "matric_date", "active", "admin", "avatar_id") VALUES (3, 'student', '$2a$10$/TVggaU5mgv103DU3w1FruWKesYujzOtIjy6ik0fQ6jPGAiSkHiA.', 'anna.matthews10@example.com', 'Anna', 'Matthews', '1976-04-06 00:00:00', '222222222', '2016-09-12 00:00:00', 1, 0, 3);
+INSERT OR IGNORE INTO "users" ("id", "username", "password", "email", "first_name", "last_name", "date_of_birth", "matric_number", "matric_date", "active", "admin", "avatar_id") VALUES (2, 'teacher', '$2a$10$xiu4.QS1oUOtlsgJdbdZsu4nDLGUfRfRKLdvjsxK4RjNrnhoZbFI6', 'eugene.ward72@example.com', 'Eugene', 'Ward', '1985-02-06 00:00:00', '111111111', '2016-09-12 00:00:00', 1, 0, 2);
+INSERT OR IGNORE INTO "users" ("id", "username", "password", "email", "first_name", "last_name", "date_of_birth", "matric_number", "matric_date", "active", "admin", "avatar_id") VALUES (4, 'guest', '$2a$10$ouCsus6K//.Xr04sNS0M9O1s8BXEDHdC9pFupCCup.leWdSlPn9hm', 'rick.peters60@example.com', 'Rick', 'Peters', '1974-02-10 00:00:00', '333333333', '2016-09-12 00:00:00', 1, 0, 4);
+
+INSERT OR IGNORE INTO "sessions" ("token", "user_id", "device_id", "expires_in", "created_on") VALUES ('a077c80d-77e2-4328-80c4-f2b4ccf995c4', 1, '-Test-Device-', '2016-09-19 00:00:00', '2016-09-12 00:00:00');
+
+INSERT OR IGNORE INTO "courses" ("id", "title", "description") VALUES (1, 'BSc (Hons) Applied Computing', 'Computing');
+INSERT OR IGNORE INTO "courses" ("id", "title", "description") VALUES (2, 'MA Artificial Intelligence', 'AI');
+
+INSERT OR IGNORE INTO "classes" ("id", "course_id", "title", "start", "end") VALUES (1, 1, '2016/2017', '2016-09-12 00:00:00', '2017-09-12 00:00:00');
+INSERT OR IGNORE INTO "classes" ("id", "course_id", "title", "start", "end") VALUES (2, 2, '2017/2018', '2017-09-12 00:00:00', '2018-09-12 00:00:00');
+
+INSERT OR IGNORE INTO "course_levels" ("level", "course_id", "class_id", "start", "end") VALUES (1, 1, 1, '2016-09-12 00:00:00', '2017-09-12 00:00:00');
+INSERT OR IGNORE INTO "course_levels" ("level", "course_id", "class_id", "start", "end") VALUES (2, 1, 1, '2017-09-12 00:00:00', '2018-09-12 00:00:00');
+INSERT OR IGNORE INTO "course_levels" ("level", "course_id", "class_id", "start", "end") VALUES (1, 2, 2, '2016-09-12 00:00:00', '2017-09-12 00:00:00');
+
+INSERT OR IGNORE INTO "modules" ("id", "title", "color", "icon", "duration", "description") VALUES (1, 'Big Data', '#9C0098', 'fa-cloud', 12, 'Introduction to the world of Big Data');
+INSERT OR IGNORE INTO "modules" ("id", "title", "color", "icon", "duration", "description") VALUES (2, 'Graphics', '#006099', 'fa-codepen', 5, '3D Computer graphics');
+INSERT OR IGNORE INTO "modules" ("id", "title", "color", "icon", "duration", "description") VALUES (3, 'UX', '#009E00', 'fa-eye', 12, 'User Experience Design');
+
+INSERT OR IGNORE INTO "level_modules" ("code", "level", "class_id", "module_id", "status", "start") VALUES ('AC31007', 1, 1, 1, 'ongoing', '2016-09-12 00:00:00');
+INSERT OR IGNORE INTO "level_modules" ("code", "level", "class_id", "module_id", "status", "start") VALUES ('AC41008', 1, 1, 2, 'ongoing', '2016-09-12 00:00:00');
+INSERT OR IGNORE INTO "level_modules" ("code", "level", "class_id", "module_id", "status", "start") VALUES ('AC52001', 1, 2, 3, 'ongoing', '2016-09-12 00:00:00');
+INSERT OR IGNORE INTO "level_modules" ("code", "level", "class_id", "module_id", "status", "start") VALUES ('AC22001', 2, 1, 3, 'future', '2016-09-12 00:00:00');
+
+INSERT OR IGNORE INTO "roles" ("id", "name", "description", "can_read", "can_write", "can_delete", "can_update") VALUES (1, 'Admin', 'Admin of a module / course.', 1, 1, 1, 1);
+INSERT OR IGNORE INTO "roles" ("id", "name", "description", "can_read", "can_write", "can_delete", "can_update") VALUES (2, 'Lecturer', 'Teacher of a module / course.', 1, 1, 1, 1);
+INSERT OR IGNORE INTO "roles" ("id", "name", "description", "can_read", "can_write", "can_delete", "can_update") VALUES (3, 'Student', 'Student of a module / course.', 1, 0, 0, 0);
+
+INSERT OR IGNORE INTO "user_modules" ("user_id", "module_code", "role_id", "class_id") VALUES (2, 'AC31007', 2, 1);
+INSERT OR IGNORE INTO "user_modules" ("user_id", "module_code", "role_id", "class_id") VALUES (2, 'AC22001', 2, 1);
+INSERT OR IGNORE INTO "user_modules" ("user_id", "module_code", "role_id", "class_id") VALUES (3, 'AC31007', 3, 1);
+INSERT OR IGNORE INTO "user_modules" ("user_id", "module_code", "role_id", "class_id") VALUES (3, 'AC41008', 3, 1);
+INSERT OR IGNORE INTO "user_modules" ("user_id", "module_code", "role_id", "class_id") VALUES (3, 'AC52001', 3, 2);
+
+INSERT OR IGNORE INTO "assignments" ("title", "description", "status", "weight", "start", "end", "module_code") VALUES ('Erlang Project', '
+				<h1>Erlang Project</h1>
+				<p>Use erlang to create a concurrent </p>
+			', 'created', 0.2, '2017-09-12 00:00:00', '2017-10-17 00:00:00', 'AC31007');
+INSERT OR IGNORE INTO "assignments" ("title", "description", "status", "weight", "start", "end", "module_code") VALUES ('NoSQL Presentation', '
+				<h1>NoSQL Presentation</h1>
+				<p>Research and create a presentation for your allocated NoSQL Database.</p>
+			', 'created', 0.2, '2017-09-12 00:00:00', '2017-10-17 00:00:00', 'AC31007');
+INSERT OR IGNORE INTO "assignments" ("title", "description", "status", "weight", "start", "end", "module_code") VALUES ('Exam', '
+				<h1>Exam</h1>
+			', 'created', 0.6, '2018-09-12 00:00:00', '2018-09-12 00:00:00', 'AC31007');
+
+INSERT OR IGNORE INTO "user_courses" ("user_id", "course_id", "role_id") VALUES (2, 2, 2);
+
+INSERT OR IGNORE INTO "lecture_slots" ("id", "module_id", "location", "type", "start", "end") VALUES (1, 1, 'Seminar Room 2', 'Lecture', '2016-01-04 09:00:00', '2016-01-04 10:00:00');
+INSERT OR IGNORE INTO "lecture_slots" ("id", "module_id", "location", "type", "start", "end") VALUES (2, 1, 'Dalhousie 2F11', 'Lecture', '2016-01-06 11:00:00', '2016-01-06 13:00:00');
+INSERT OR IGNORE INTO "lecture_slots" ("id", "module_id", "location", "type", "start", "end") VALUES (3, 1, 'QMB Labs 1 & 2', 'Lab', '2016-01-08 09:00:00', '2016-01-08 13:00:00');
+INSERT OR IGNORE INTO "lecture_slots" ("id", "module_id", "location", "type", "start", "end") VALUES (4, 2, 'Dalhousie 1G05 (G)', 'Lecture', '2016-01-05 16:00:00', '2016-01-05 17:00:00');
+INSERT OR IGNORE INTO "lecture_slots" ("id", "module_id", "location", "type", "start", "end") VALUES (5, 2, 'Dalhousie 2F13', 'Lecture', '2016-01-07 09:00:00', '2016-01-07 13:00:00');
+
+INSERT OR IGNORE INTO "lectures" ("description", "module_id", "lecture_slot_id", "location", "topic", "start", "end", "canceled") VALUES ('<h1>Introduction to Big Data</h1><p>This lecture will show an overview of the module.</p>', 1, 1, 'Seminar Room 2', 'Introduction to Big Data', '2016-09-12 09:00:00', '2016-09-12 10:00:00', 0);
+INSERT OR IGNORE INTO "lectures" ("description", "module_id", "lecture_slot_id", "location", "topic", "start", "end", "canceled") VALUES ('<h1>Hadoop</h1><p>This lecture will introduce Hadoop.</p>', 1, 2, 'Dalhousie 2F11', 'Hadoop', '2016-09-14 11:00:00', '2016-09-14 13:00:00', 0);
+INSERT OR IGNORE INTO "lectures" ("description", "module_id", "lecture_slot_id", "location", "topic", "start", "end", "canceled") VALUES ('<h1>Erlang</h1><p>In this Lab we will setup Erlang in our computers and run some sample programs.</p>', 1, 3, 'QMB Labs 1 & 2', 'Erlang', '2016-09-16 09:00:00', '2016-09-16 13:00:00', 1);
+INSERT OR IGNORE INTO "lectures" ("description", "module_id", "lecture_slot_id", "location", "topic", "start", "end", "canceled") VALUES ('<h1>Introduction to OpenGL</h1><p>In this lecture we will see an overview of the module.</p>', 2, 4, 'Dalhousie 1G05 (G)', 'Introduction to OpenGL', '2016-09-13 16:00:00', '2016-09-13 17:00:00', 0);
+INSERT OR IGNORE INTO "lectures" ("description", "module_id", "lecture_slot_id", "location", "topic", "start", "end", "canceled") VALUES ('<h1>Setup OpenGL</h1><p>In this lab we will setup our development environment and run the first sample program.</p>', 2, 5, 'Dalhousie 2F13', 'Introduction to OpenGL', '2016-09-15 09:00:00', '2016-09-15 13:00:00', 0);
+
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/tools"
+	"github.com/jinzhu/gorm"
+)
+
+// Shown in the report instead of the passwords and credentials
+const REDACTED = "[redacted]"
+
+// Where the demo data copies the avatars (the API is checked out next to the installer)
+const DEMO_ATTACHMENTS_DIR = "../kumquat.academy.api/attachments/"
+
+// InstallSummary is what an installation did, shown once it finishes and offered as a JSON report.
+//
+// It never holds a secret, the report is meant for the change records.
+type InstallSummary struct {
+	Started          time.Time        `json:"started"`
+	Finished         time.Time        `json:"finished"`
+	DurationMS       int64            `json:"duration_ms"`
+	InstallerVersion string           `json:"installer_version"`
+	SchemaVersion    string           `json:"schema_version"`
+	Database         SummaryDatabase  `json:"database"`
+	TablesCreated    []string         `json:"tables_created"`
+	TablesMigrated   []string         `json:"tables_migrated"`
+	Rows             []SummaryRows    `json:"rows"`
+	Administrator    string           `json:"administrator"`
+	DemoAccounts     []string         `json:"demo_accounts"`
+	Paths            []SummaryPath    `json:"paths"`
+	Warnings         []string         `json:"warnings"`
+	NextSteps        []string         `json:"next_steps"`
+	Settings         []SummarySetting `json:"settings"`
+}
+
+// The database an installation ran on
+type SummaryDatabase struct {
+	Dialect string `json:"dialect"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// The rows of a table, and how many the installation inserted
+type SummaryRows struct {
+	Table  string `json:"table"`
+	Seeded int64  `json:"seeded"`
+	Total  int64  `json:"total"`
+}
+
+// A file or directory the installation wrote (or the platform writes to)
+type SummaryPath struct {
+	Label string `json:"label"`
+	Path  string `json:"path"`
+}
+
+// A setting chosen in the wizard (with the secrets redacted)
+type SummarySetting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Starts the summary of an installation with the settings of the wizard
+func newInstallSummary(job *InstallJob, form url.Values) *InstallSummary {
+	summary := &InstallSummary{
+		Started:          job.Started,
+		InstallerVersion: currentInstallerVersion(),
+		Administrator:    form.Get("admin-username"),
+		TablesCreated:    []string{},
+		TablesMigrated:   []string{},
+		Rows:             []SummaryRows{},
+		DemoAccounts:     []string{},
+		Paths:            []SummaryPath{},
+		Warnings:         []string{},
+		NextSteps:        []string{},
+		Settings:         []SummarySetting{},
+	}
+	for _, item := range reviewLabels {
+		value := form.Get(item.Label)
+		if value != "" && isSecretField(item.Label) {
+			value = REDACTED
+		}
+		summary.Settings = append(summary.Settings, SummarySetting{Name: item.Value, Value: value})
+	}
+	return summary
+}
+
+// Checks if a wizard field holds a password or a credential
+func isSecretField(field string) bool {
+	if strings.Contains(field, "password") {
+		return true
+	}
+	for _, variable := range environmentVariables {
+		if variable.Field == field {
+			return variable.Secret
+		}
+	}
+	return false
+}
+
+// Adds a path written by the installation (made absolute, so the report makes sense anywhere)
+func (summary *InstallSummary) AddPath(label, path string) {
+	if path == "" {
+		return
+	}
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	summary.Paths = append(summary.Paths, SummaryPath{Label: label, Path: path})
+}
+
+// Counts the rows of the tables that exist (before the installation changes them)
+func countTablesRows(db *gorm.DB) map[string]int64 {
+	counts := map[string]int64{}
+	for _, table := range existingSchemaTables(db) {
+		if count, err := countTableRows(db, table); err == nil {
+			counts[table] = count
+		}
+	}
+	return counts
+}
+
+// Completes the summary once the installation is done, comparing the tables with how they were before
+func (summary *InstallSummary) Finish(db *gorm.DB, before map[string]int64, settings *tools.Settings, dbCreate bool, job *InstallJob) {
+	summary.SchemaVersion = currentSchemaVersion(db)
+
+	for _, table := range schemaTables {
+		name := table.Name(db)
+		if !db.Dialect().HasTable(name) {
+			continue
+		}
+		previous, existed := before[name]
+		if existed {
+			if dbCreate {
+				summary.TablesMigrated = append(summary.TablesMigrated, name)
+			}
+		} else {
+			summary.TablesCreated = append(summary.TablesCreated, name)
+		}
+
+		total, err := countTableRows(db, name)
+		if err != nil {
+			job.Warn("Can't count the rows of %s: %v", name, err)
+			continue
+		}
+		summary.Rows = append(summary.Rows, SummaryRows{Table: name, Seeded: total - previous, Total: total})
+	}
+
+	events, _ := job.EventsAfter(0)
+	for _, event := range events {
+		if event.Type == EVENT_WARNING {
+			summary.Warnings = append(summary.Warnings, event.Message)
+		}
+	}
+
+	summary.NextSteps = installNextSteps(summary, settings)
+	summary.Finished = time.Now()
+	summary.DurationMS = summary.Finished.Sub(summary.Started).Milliseconds()
+}
+
+// Lists what is left to do before the platform can be used
+func installNextSteps(summary *InstallSummary, settings *tools.Settings) []string {
+	settingsPath, _ := filepath.Abs(SETTINGS_FILE)
+	steps := []string{
+		fmt.Sprintf("Copy %s (and the keys) next to the API, in ../kumquat.academy.api", settingsPath),
+		fmt.Sprintf("Start the API from ../kumquat.academy.api, it listens on port %d under %s/v%d", settings.Server.Port, settings.Api.Prefix, settings.Api.Version),
+		fmt.Sprintf("Sign in as %s with the password entered in the wizard", summary.Administrator),
+	}
+	if len(summary.DemoAccounts) > 0 {
+		steps = append(steps, fmt.Sprintf("Remove the demo accounts (%s) before opening the platform to the students", strings.Join(summary.DemoAccounts, ", ")))
+	}
+	if settings.Email.Server == "" {
+		steps = append(steps, "Set up the email server in settings.toml, the password resets can't be sent without it")
+	}
+	if !settings.Server.Production {
+		steps = append(steps, "Turn on the production mode in settings.toml before going live")
+	}
+	if len(summary.Warnings) > 0 {
+		steps = append(steps, fmt.Sprintf("Review the %d warnings of the installation", len(summary.Warnings)))
+	}
+	steps = append(steps, "Stop the installer, anyone reaching it can install the platform again")
+	return steps
+}
+
+// Downloads the summary of a finished installation as JSON
+func installReportHandler(w http.ResponseWriter, r *http.Request, job *InstallJob) {
+	// The summary is set before the job finishes
+	if job.Status() != JOB_FINISHED || job.Summary == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := json.MarshalIndent(job.Summary, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("kumquat-install-%s.json", job.Summary.Started.UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(append(content, '\n'))
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+)
+
+// Default file the upgrade report is written to
+const UPGRADE_REPORT_FILE = "upgrade-report.txt"
+
+// Changes recorded by the upgrade
+const (
+	UPGRADE_ADDED   = "added"
+	UPGRADE_RENAMED = "renamed"
+	UPGRADE_DROPPED = "dropped"
+	UPGRADE_CREATED = "created"
+)
+
+// A change made by the upgrade (a column, an index, a foreign key or a table)
+type UpgradeChange struct {
+	Table  string `json:"table"`
+	Object string `json:"object"` // table, column, index or foreign key
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// The report of the upgrade, in JSON
+type UpgradeReport struct {
+	Database string          `json:"database"`
+	Started  time.Time       `json:"started"`
+	Backup   string          `json:"backup,omitempty"`
+	Changes  []UpgradeChange `json:"changes"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Describes the change for the logs and the report
+func (change UpgradeChange) Describe() string {
+	switch change.Change {
+	case UPGRADE_RENAMED:
+		return fmt.Sprintf("%s: renamed %s %s to %s", change.Table, change.Object, change.From, change.To)
+	case UPGRADE_DROPPED:
+		return fmt.Sprintf("%s: dropped %s %s (%s)", change.Table, change.Object, change.Name, change.From)
+	case UPGRADE_CREATED:
+		return fmt.Sprintf("%s: created %s", change.Table, change.Object)
+	default:
+		return fmt.Sprintf("%s: %s %s %s (%s)", change.Table, change.Change, change.Object, change.Name, change.To)
+	}
+}
+
+// Checks if the database was built from the 2015 create_tables.sql
+// (sessions by ip instead of device, users without admin or avatar)
+func isLegacySchema(db *gorm.DB) bool {
+	dialect := db.Dialect()
+	if dialect.HasTable("sessions") && dialect.HasColumn("sessions", "ip") && !dialect.HasColumn("sessions", "device_id") {
+		return true
+	}
+	return dialect.HasTable("users") && !dialect.HasColumn("users", "admin") && !dialect.HasColumn("users", "avatar_id")
+}
+
+// Error returned by the install and migrate when the database has the legacy layout
+func legacySchemaError() error {
+	return fmt.Errorf("the database has the 2015 schema (sessions by ip, users without admin), run `installer upgrade` to migrate it first")
+}
+
+// Returns the type the model has for a column (e.g. varchar(255))
+func modelColumnType(db *gorm.DB, model interface{}, column string) string {
+	scope := db.NewScope(model)
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.DBName == column {
+			return scope.Dialect().DataTypeOf(field)
+		}
+	}
+	return ""
+}
+
+// Returns the sessions table of the registry (with the key to the users the upgrade replaces)
+func sessionsTable() (SchemaTable, error) {
+	for _, table := range schemaTables {
+		if _, ok := table.Model.(*models.Session); ok && len(table.ForeignKeys) > 0 {
+			return table, nil
+		}
+	}
+	return SchemaTable{}, fmt.Errorf("the schema has no sessions table with a foreign key, the installer can't upgrade it")
+}
+
+// Lists what the upgrade changes before migrating (what migrateSchema adds is listed apart)
+func planLegacyUpgrade(db *gorm.DB) ([]UpgradeChange, error) {
+	changes := []UpgradeChange{}
+	dialect := db.Dialect()
+	if !dialect.HasTable("sessions") || !dialect.HasColumn("sessions", "ip") || dialect.HasColumn("sessions", "device_id") {
+		return changes, nil
+	}
+
+	// The legacy key of the sessions (named fk_sessions_users), replaced by the one of gorm
+	session, err := sessionsTable()
+	if err != nil {
+		return nil, err
+	}
+	expected := session.ForeignKeys[0]
+	keys, err := listForeignKeys(db, "sessions")
+	if err != nil {
+		return nil, fmt.Errorf("can't inspect the foreign keys of sessions: %v", err)
+	}
+	for _, key := range keys {
+		if key.Name != "" && !strings.EqualFold(key.Name, expected.KeyName(db, "sessions")) && key.Matches(expected) {
+			changes = append(changes, UpgradeChange{Table: "sessions", Object: "foreign key", Name: key.Name, Change: UPGRADE_DROPPED, From: key.Describe("sessions")})
+		}
+	}
+
+	// The unique_session(user_id, ip) key
+	indexes, err := listIndexes(db, "sessions")
+	if err != nil {
+		return nil, fmt.Errorf("can't inspect the indexes of sessions: %v", err)
+	}
+	for _, index := range indexes {
+		for _, column := range index.Columns {
+			if strings.EqualFold(column, "ip") {
+				changes = append(changes, UpgradeChange{Table: "sessions", Object: "index", Name: index.Name, Change: UPGRADE_DROPPED, From: index.Describe()})
+				break
+			}
+		}
+	}
+
+	columns, err := listColumns(db, "sessions")
+	if err != nil {
+		return nil, fmt.Errorf("can't inspect the columns of sessions: %v", err)
+	}
+	from := "ip"
+	for _, column := range columns {
+		if column.Name == "ip" {
+			from = "ip " + column.Type
+		}
+	}
+	changes = append(changes, UpgradeChange{
+		Table: "sessions", Object: "column", Name: "ip", Change: UPGRADE_RENAMED,
+		From: from, To: "device_id " + modelColumnType(db, session.Model, "device_id"),
+	})
+	return changes, nil
+}
+
+// Drops an index (MySQL needs the table)
+func dropIndex(db *gorm.DB, table, name string) error {
+	if db.Dialect().GetName() == "mysql" {
+		return db.Exec(fmt.Sprintf("DROP INDEX %s ON %s", db.Dialect().Quote(name), db.Dialect().Quote(table))).Error
+	}
+	return db.Exec(fmt.Sprintf("DROP INDEX %s", db.Dialect().Quote(name))).Error
+}
+
+// Drops a foreign key (SQLite can't, its keys go with the table)
+func dropForeignKey(db *gorm.DB, table, name string) error {
+	quote := db.Dialect().Quote
+	switch dialect := db.Dialect().GetName(); dialect {
+	case "mysql":
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", quote(table), quote(name))).Error
+	case "postgres":
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quote(table), quote(name))).Error
+	default:
+		return fmt.Errorf("can't drop foreign keys on a %s database", dialect)
+	}
+}
+
+// Renames a column, changing it to the type of the model
+func renameColumn(db *gorm.DB, table, from, to, columnType string) error {
+	quote := db.Dialect().Quote
+	switch dialect := db.Dialect().GetName(); dialect {
+	case "mysql":
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s CHANGE %s %s %s", quote(table), quote(from), quote(to), columnType)).Error
+	case "postgres":
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", quote(table), quote(from), quote(to))).Error; err != nil {
+			return err
+		}
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", quote(table), quote(to), columnType)).Error
+	default:
+		// SQLite keeps the type, it doesn't enforce it anyway
+		return db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", quote(table), quote(from), quote(to))).Error
+	}
+}
+
+// Reads the columns of the tables that exist (table => column => type)
+func snapshotColumns(db *gorm.DB) (map[string]map[string]string, error) {
+	snapshot := map[string]map[string]string{}
+	for _, table := range schemaTables {
+		name := table.Name(db)
+		if !db.Dialect().HasTable(name) {
+			continue
+		}
+		columns, err := listColumns(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("can't inspect the columns of %s: %v", name, err)
+		}
+		snapshot[name] = map[string]string{}
+		for _, column := range columns {
+			snapshot[name][column.Name] = column.Type
+		}
+	}
+	return snapshot, nil
+}
+
+// Migrates a database with the 2015 layout in place, keeping its users.
+//
+// The legacy keys on sessions.ip are dropped and the column becomes device_id, then
+// migrateSchema adds the rest (users.admin, users.avatar_id and the new tables).
+// Returns every change made, for the report.
+func upgradeLegacySchema(db *gorm.DB, job *InstallJob) ([]UpgradeChange, error) {
+	before, err := snapshotColumns(db)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := planLegacyUpgrade(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys first, the indexes and the column can't go while a key uses them
+	for _, object := range []string{"foreign key", "index", "column"} {
+		for _, change := range changes {
+			if change.Object != object {
+				continue
+			}
+
+			switch object {
+			case "foreign key":
+				err = dropForeignKey(db, change.Table, change.Name)
+			case "index":
+				err = dropIndex(db, change.Table, change.Name)
+			case "column":
+				err = renameColumn(db, change.Table, "ip", "device_id", modelColumnType(db, &models.Session{}, "device_id"))
+			}
+			if err != nil {
+				return changes, fmt.Errorf("can't upgrade %s: %v", change.Describe(), err)
+			}
+			job.Log("Upgraded %s", change.Describe())
+		}
+	}
+
+	// Reports what migrateSchema added (it never drops anything), even if it stopped half way
+	migrateErr := migrateSchema(db, job)
+	for _, table := range schemaTables {
+		name := table.Name(db)
+		existing, existed := before[name]
+		if !existed {
+			if db.Dialect().HasTable(name) {
+				changes = append(changes, UpgradeChange{Table: name, Object: "table", Change: UPGRADE_CREATED})
+			}
+			continue
+		}
+		columns, err := listColumns(db, name)
+		if err != nil {
+			return changes, fmt.Errorf("can't inspect the columns of %s: %v", name, err)
+		}
+		for _, column := range columns {
+			if _, found := existing[column.Name]; found || name == "sessions" && column.Name == "device_id" {
+				continue
+			}
+			changes = append(changes, UpgradeChange{Table: name, Object: "column", Name: column.Name, Change: UPGRADE_ADDED, To: column.Type})
+		}
+	}
+	return changes, migrateErr
+}
+
+// Formats the report of the upgrade
+func formatUpgradeReport(database string, started time.Time, backup string, changes []UpgradeChange, upgradeErr error) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Upgrade of %s from the 2015 schema, %s\n", database, started.Format(time.RFC3339))
+	if backup != "" {
+		fmt.Fprintf(&out, "Backup taken before the upgrade: %s (see `installer restore`)\n", backup)
+	}
+	out.WriteString("\n")
+	if len(changes) == 0 {
+		out.WriteString("Nothing was changed.\n")
+	}
+	for _, change := range changes {
+		fmt.Fprintf(&out, "  %s\n", change.Describe())
+	}
+	if upgradeErr != nil {
+		fmt.Fprintf(&out, "\nThe upgrade failed: %v\n", upgradeErr)
+	}
+	return out.String()
+}
+
+// Upgrades a database built from the 2015 create_tables.sql to the current schema
+func upgradeCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	reportPath := UPGRADE_REPORT_FILE
+	lockTimeout := time.Duration(0)
+	dryRun := false
+
+	flags := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	flags.StringVar(&settingsPath, "settings", settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	flags.StringVar(&reportPath, "report", reportPath, "file the report is written to (JSON if it ends with .json)")
+	flags.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another migrator to finish (default KUMQUAT_DB_LOCK_TIMEOUT, or 5m)")
+	flags.BoolVar(&dryRun, "dry-run", dryRun, "only list what the upgrade would change")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	job := newInstallJob()
+	job.output = printJobEvents
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.LogMode(false)
+
+	if !isLegacySchema(db) {
+		fmt.Printf("The database %s doesn't have the 2015 schema, run `installer migrate` instead.\n", config.Name)
+		return 0
+	}
+
+	if dryRun {
+		changes, err := planLegacyUpgrade(db)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for _, change := range changes {
+			fmt.Println(change.Describe())
+		}
+		for _, change := range pendingSchemaChanges(db) {
+			fmt.Println(change)
+		}
+		return 0
+	}
+
+	lock, err := lockMigrations(db, form, lockTimeout, job)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer lock.Release()
+
+	started := time.Now()
+	run := beginInstallerRun(db, "upgrade", true, false, "", job)
+	backup, err := backupDatabase(db, config.Name, backupDir(form), job)
+	if err != nil {
+		run.Finish(db, err, job)
+		fmt.Printf("%v (nothing was changed)\n", err)
+		return 1
+	}
+	run.Backup = backup
+	changes, upgradeErr := upgradeLegacySchema(db, job)
+	run.Finish(db, upgradeErr, job)
+
+	var report []byte
+	if strings.HasSuffix(reportPath, ".json") {
+		result := UpgradeReport{Database: config.Name, Started: started, Backup: backup, Changes: changes}
+		if upgradeErr != nil {
+			result.Error = upgradeErr.Error()
+		}
+		report, _ = json.MarshalIndent(result, "", "  ")
+		report = append(report, '\n')
+	} else {
+		report = []byte(formatUpgradeReport(config.Name, started, backup, changes, upgradeErr))
+	}
+	if err := ioutil.WriteFile(reportPath, report, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "can't write the report to %s: %v\n", reportPath, err)
+		return 1
+	}
+	fmt.Printf("Wrote the report to %s\n", reportPath)
+
+	if upgradeErr != nil {
+		fmt.Println(upgradeErr)
+		return 1
+	}
+	fmt.Printf("Upgraded %s (%d changes), the users were kept.\n", config.Name, len(changes))
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A registry without the sessions table fails the upgrade instead of panicking
+func TestSessionsTable(t *testing.T) {
+	if _, err := sessionsTable(); err != nil {
+		t.Fatalf("the registry has no sessions table: %v", err)
+	}
+
+	previous := schemaTables
+	defer func() { schemaTables = previous }()
+	schemaTables = nil
+	if _, err := sessionsTable(); err == nil {
+		t.Errorf("sessionsTable didn't fail without a sessions table")
+	}
+}
+
+// A database built from the 2015 create_tables.sql is upgraded in place, keeping its users
+func TestUpgradeLegacySQLiteSchema(t *testing.T) {
+	db := openTestDatabaseFile(t)
+	for _, statement := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username VARCHAR(255) NOT NULL UNIQUE, password VARCHAR(255),
+			email VARCHAR(255) NOT NULL, first_name VARCHAR(255), last_name VARCHAR(255), date_of_birth DATETIME,
+			matric_number VARCHAR(255), matric_date DATETIME, active BOOLEAN)`,
+		`CREATE TABLE sessions (token VARCHAR(255) PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id),
+			ip VARCHAR(11) NOT NULL, expires_in DATETIME, created_on DATETIME)`,
+		"CREATE UNIQUE INDEX unique_session ON sessions (user_id, ip)",
+		"INSERT INTO users (id, username, email, matric_number, active) VALUES (1, 'admin', 'admin@example.com', '0', 1), (2, 'student', 'student@example.com', '1', 1)",
+		"INSERT INTO sessions (token, user_id, ip) VALUES ('11111111-admin', 1, '10.0.0.1')",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !isLegacySchema(db) {
+		t.Fatal("the 2015 schema isn't recognised")
+	}
+
+	plan, err := planLegacyUpgrade(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	for _, change := range plan {
+		planned = append(planned, change.Object+" "+change.Name+" "+change.Change)
+	}
+	if want := []string{"index unique_session " + UPGRADE_DROPPED, "column ip " + UPGRADE_RENAMED}; !reflect.DeepEqual(planned, want) {
+		t.Errorf("planLegacyUpgrade = %q, want %q", planned, want)
+	}
+
+	job := newInstallJob()
+	job.output = func(InstallEvent) {}
+	if _, err := upgradeLegacySchema(db, job); err != nil {
+		t.Fatal(err)
+	}
+
+	if isLegacySchema(db) || db.Dialect().HasColumn("sessions", "ip") {
+		t.Errorf("the database still has the 2015 schema")
+	}
+	var devices []string
+	if err := db.Table("sessions").Pluck("device_id", &devices).Error; err != nil || !reflect.DeepEqual(devices, []string{"10.0.0.1"}) {
+		t.Errorf("sessions.device_id = %q (%v), want the ip of the session", devices, err)
+	}
+	var usernames []string
+	if err := db.Table("users").Order("id").Pluck("username", &usernames).Error; err != nil || !reflect.DeepEqual(usernames, []string{"admin", "student"}) {
+		t.Errorf("the users are %q (%v) after the upgrade", usernames, err)
+	}
+	if !db.Dialect().HasColumn("users", "admin") {
+		t.Errorf("users.admin wasn't added")
+	}
+}
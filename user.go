@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Length of the passwords generated for the users
+const GENERATED_PASSWORD_LENGTH = 16
+
+// Characters of the generated passwords (without the ones that look alike, like 0 and O)
+const PASSWORD_ALPHABET = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Bytes of a password bcrypt reads
+const BCRYPT_MAX_LENGTH = 72
+
+// Subcommands of `installer user`
+var userCommands = []Command{
+	{"create", "Creates a user (an administrator with --admin)", userCreateCommand},
+	{"set-password", "Changes the password of a user (a random one if none is given)", userSetPasswordCommand},
+	{"promote-admin", "Makes a user an administrator (or revokes it with --revoke)", userPromoteAdminCommand},
+	{"deactivate", "Stops a user from signing in and signs them out (or lets them in again with --activate)", userDeactivateCommand},
+	{"list", "Lists the users", userListCommand},
+	{"import", "Creates (or updates) the users of a CSV or XLSX file", userImportCommand},
+}
+
+// Returns what the platform hashes instead of the password itself: its SHA-512,
+// in hex (the API gets that digest from the clients, then checks it with bcrypt)
+func passwordDigest(password string) string {
+	digest := sha512.Sum512([]byte(password))
+	return hex.EncodeToString(digest[:])
+}
+
+// Hashes a password the way the platform checks it (the same as the seeded accounts).
+//
+// bcrypt only reads the first 72 bytes of the digest, the newer versions
+// refuse longer ones instead of cutting them, so it's cut here.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passwordDigest(password)[:BCRYPT_MAX_LENGTH]), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Checks a password against a hash of the platform
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(passwordDigest(password)[:BCRYPT_MAX_LENGTH])) == nil
+}
+
+// Generates a random password, for the users created without one
+func generatePassword() (string, error) {
+	password := make([]byte, GENERATED_PASSWORD_LENGTH)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(PASSWORD_ALPHABET))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = PASSWORD_ALPHABET[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// Connects to the database of an installation (the waiting messages go to stderr)
+func openInstalledDatabase(settingsPath string) (*gorm.DB, *DatabaseConfig, error) {
+	_, form, err := loadInstallerForm(settingsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job := newInstallJob()
+	job.output = func(event InstallEvent) {
+		fmt.Fprintln(os.Stderr, event.Message)
+	}
+	db, config, err := openDatabase(form, job)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.LogMode(false)
+	return db, config, nil
+}
+
+// Finds a user by username (or email)
+func findUser(db *gorm.DB, login string) (*models.User, error) {
+	user := &models.User{}
+	err := db.Where("username = ? OR email = ?", login, login).First(user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, fmt.Errorf("there is no user %q", login)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't find the user %q: %v", login, err)
+	}
+	return user, nil
+}
+
+// Reads the password of --password-stdin (a single line, like `docker login`)
+func readPasswordStdin() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("can't read the password from stdin: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Returns the password given to a command, or a random one (generated is true then)
+func passwordFromFlags(password string, stdin bool) (value string, generated bool, err error) {
+	if stdin {
+		if password, err = readPasswordStdin(); err != nil {
+			return "", false, err
+		}
+	}
+	if password == "" {
+		password, err = generatePassword()
+		return password, true, err
+	}
+	if message := fieldValidators["admin-password"](password, nil); message != "" {
+		return "", false, fmt.Errorf("invalid password: %s", message)
+	}
+	return password, false, nil
+}
+
+// Registers the flags every user subcommand has
+func userFlags(name string, settingsPath *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("user "+name, flag.ContinueOnError)
+	flags.StringVar(settingsPath, "settings", *settingsPath, "settings file of the installation (KUMQUAT_* variables apply on top)")
+	return flags
+}
+
+// Parses the flags of a subcommand that takes a single user (by username or email),
+// the flags can also follow the user (e.g. `user deactivate bob --activate`)
+func parseUserArgs(flags *flag.FlagSet, args []string) (string, bool) {
+	if err := flags.Parse(args); err != nil {
+		return "", false
+	}
+	login := flags.Arg(0)
+	if flags.NArg() > 1 {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return "", false
+		}
+	} else if login != "" {
+		return login, true
+	}
+	if login == "" || flags.NArg() > 0 {
+		fmt.Printf("Usage: installer %s [flags] <username or email>\n", flags.Name())
+		flags.PrintDefaults()
+		return "", false
+	}
+	return login, true
+}
+
+// Manages the users of an installation
+func userCommand(args []string) int {
+	if len(args) > 0 {
+		for _, command := range userCommands {
+			if command.Name == args[0] {
+				return command.Run(args[1:])
+			}
+		}
+		if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+			fmt.Printf("Unknown user command %q\n\n", args[0])
+		}
+	}
+
+	fmt.Println("Usage: installer user <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range userCommands {
+		fmt.Printf("  %-16s %s\n", command.Name, command.Description)
+	}
+	return 2
+}
+
+// Creates a user
+func userCreateCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	values := map[string]*string{}
+	password := ""
+	passwordStdin := false
+	admin := false
+
+	flags := userFlags("create", &settingsPath)
+	for _, field := range []struct{ flag, field, usage string }{
+		{"username", "admin-username", "username (required)"},
+		{"email", "admin-email", "email (required)"},
+		{"first-name", "admin-first-name", "first name (required)"},
+		{"last-name", "admin-last-name", "last name (required)"},
+		{"date-of-birth", "admin-date-of-birth", "date of birth, as YYYY-MM-DD (required)"},
+		{"matric-number", "admin-matric-number", "matric number (default the username)"},
+	} {
+		values[field.field] = flags.String(field.flag, "", field.usage)
+	}
+	flags.StringVar(&password, "password", password, "password (a random one is generated and printed if none is given)")
+	flags.BoolVar(&passwordStdin, "password-stdin", passwordStdin, "read the password from stdin")
+	flags.BoolVar(&admin, "admin", admin, "make the user an administrator")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Validated like the administrator of the wizard
+	form := url.Values{}
+	for field, value := range values {
+		form.Set(field, strings.TrimSpace(*value))
+	}
+	required := []string{"admin-username", "admin-email", "admin-first-name", "admin-last-name", "admin-date-of-birth"}
+	fields := append(required, "admin-matric-number")
+	if errors := validateFields(fields, required, form); len(errors) > 0 {
+		for _, field := range fields {
+			if message, failed := errors[field]; failed {
+				fmt.Printf("--%s: %s\n", strings.TrimPrefix(field, "admin-"), message)
+			}
+		}
+		return 2
+	}
+
+	password, generated, err := passwordFromFlags(password, passwordStdin)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	username := form.Get("admin-username")
+	var count int
+	if err := db.Model(&models.User{}).Where("username = ? OR email = ?", username, form.Get("admin-email")).Count(&count).Error; err != nil {
+		fmt.Printf("can't check the existing users: %v\n", err)
+		return 1
+	}
+	if count > 0 {
+		fmt.Printf("There is already a user with the username %s or the email %s\n", username, form.Get("admin-email"))
+		return 1
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	matricNumber := form.Get("admin-matric-number")
+	if matricNumber == "" {
+		matricNumber = username
+	}
+	gmt := time.FixedZone("GMT", 0)
+	dateOfBirth, _ := time.ParseInLocation("2006-01-02", form.Get("admin-date-of-birth"), gmt)
+
+	user := models.User{
+		Username:     username,
+		Password:     hash,
+		Email:        form.Get("admin-email"),
+		FirstName:    form.Get("admin-first-name"),
+		LastName:     form.Get("admin-last-name"),
+		DateOfBirth:  dateOfBirth,
+		MatricNumber: matricNumber,
+		MatricDate:   time.Now().In(gmt),
+		Active:       true,
+		Admin:        admin,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		fmt.Printf("can't create the user %s: %v\n", username, err)
+		return 1
+	}
+
+	fmt.Printf("Created the user %s (id %d)\n", user.Username, user.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return 0
+}
+
+// Changes the password of a user
+func userSetPasswordCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	password := ""
+	passwordStdin := false
+
+	flags := userFlags("set-password", &settingsPath)
+	flags.StringVar(&password, "password", password, "new password (a random one is generated and printed if none is given)")
+	flags.BoolVar(&passwordStdin, "password-stdin", passwordStdin, "read the new password from stdin")
+	login, ok := parseUserArgs(flags, args)
+	if !ok {
+		return 2
+	}
+
+	password, generated, err := passwordFromFlags(password, passwordStdin)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	user, err := findUser(db, login)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if err := db.Model(user).Update("password", hash).Error; err != nil {
+		fmt.Printf("can't change the password of %s: %v\n", user.Username, err)
+		return 1
+	}
+
+	fmt.Printf("Changed the password of %s\n", user.Username)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return 0
+}
+
+// Makes a user an administrator (or a regular user again)
+func userPromoteAdminCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	revoke := false
+
+	flags := userFlags("promote-admin", &settingsPath)
+	flags.BoolVar(&revoke, "revoke", revoke, "make the administrator a regular user instead")
+	login, ok := parseUserArgs(flags, args)
+	if !ok {
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	user, err := findUser(db, login)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// The platform can't be managed without an administrator
+	if revoke && user.Admin {
+		var admins int
+		db.Model(&models.User{}).Where("admin = ? AND active = ?", true, true).Count(&admins)
+		if admins <= 1 {
+			fmt.Printf("%s is the last active administrator, promote another user first\n", user.Username)
+			return 1
+		}
+	}
+
+	if err := db.Model(user).Update("admin", !revoke).Error; err != nil {
+		fmt.Printf("can't change %s: %v\n", user.Username, err)
+		return 1
+	}
+	if revoke {
+		fmt.Printf("%s isn't an administrator anymore\n", user.Username)
+	} else {
+		fmt.Printf("%s is an administrator\n", user.Username)
+	}
+	return 0
+}
+
+// Stops a user from signing in (or lets them sign in again)
+func userDeactivateCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	activate := false
+
+	flags := userFlags("deactivate", &settingsPath)
+	flags.BoolVar(&activate, "activate", activate, "activate the user again instead")
+	login, ok := parseUserArgs(flags, args)
+	if !ok {
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	user, err := findUser(db, login)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if !activate && user.Admin && user.Active {
+		var admins int
+		db.Model(&models.User{}).Where("admin = ? AND active = ?", true, true).Count(&admins)
+		if admins <= 1 {
+			fmt.Printf("%s is the last active administrator, promote another user first\n", user.Username)
+			return 1
+		}
+	}
+
+	if err := db.Model(user).Update("active", activate).Error; err != nil {
+		fmt.Printf("can't change %s: %v\n", user.Username, err)
+		return 1
+	}
+	if activate {
+		fmt.Printf("Activated %s\n", user.Username)
+		return 0
+	}
+
+	// Signs the user out too, the sessions would keep working until they expire
+	revoked, err := revokeSessions(db, user, "")
+	if err != nil {
+		fmt.Printf("Deactivated %s, but can't revoke the sessions: %v\n", user.Username, err)
+		return 1
+	}
+	fmt.Printf("Deactivated %s (revoked %d sessions)\n", user.Username, revoked)
+	return 0
+}
+
+// A user as listed by `user list` (without the password)
+type userListing struct {
+	ID           uint32 `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	MatricNumber string `json:"matric_number"`
+	Admin        bool   `json:"admin"`
+	Active       bool   `json:"active"`
+}
+
+// Lists the users
+func userListCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	adminsOnly := false
+	inactiveOnly := false
+	search := ""
+	asJSON := false
+
+	flags := userFlags("list", &settingsPath)
+	flags.BoolVar(&adminsOnly, "admins", adminsOnly, "only list the administrators")
+	flags.BoolVar(&inactiveOnly, "inactive", inactiveOnly, "only list the deactivated users")
+	flags.StringVar(&search, "search", search, "only list the users whose username, email or name contain this")
+	flags.BoolVar(&asJSON, "json", asJSON, "print the users as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	query := db.Order("id")
+	if adminsOnly {
+		query = query.Where("admin = ?", true)
+	}
+	if inactiveOnly {
+		query = query.Where("active = ?", false)
+	}
+	if search != "" {
+		like := "%" + search + "%"
+		query = query.Where("username LIKE ? OR email LIKE ? OR first_name LIKE ? OR last_name LIKE ?", like, like, like, like)
+	}
+	users := []models.User{}
+	if err := query.Find(&users).Error; err != nil {
+		fmt.Printf("can't list the users: %v\n", err)
+		return 1
+	}
+
+	listing := []userListing{}
+	for _, user := range users {
+		listing = append(listing, userListing{
+			ID:           user.ID,
+			Username:     user.Username,
+			Email:        user.Email,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			MatricNumber: user.MatricNumber,
+			Admin:        user.Admin,
+			Active:       user.Active,
+		})
+	}
+
+	if asJSON {
+		content, _ := json.MarshalIndent(listing, "", "  ")
+		fmt.Println(string(content))
+		return 0
+	}
+
+	fmt.Printf("%-6s %-20s %-30s %-30s %-14s %-6s %s\n", "ID", "Username", "Email", "Name", "Matric", "Admin", "Active")
+	for _, user := range listing {
+		fmt.Printf("%-6d %-20s %-30s %-30s %-14s %-6t %t\n", user.ID, user.Username, user.Email,
+			strings.TrimSpace(user.FirstName+" "+user.LastName), user.MatricNumber, user.Admin, user.Active)
+	}
+	fmt.Printf("\n%d users\n", len(listing))
+	return 0
+}
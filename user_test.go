@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// The accounts of the demo data, hashed by the platform
+var seededPasswords = []struct {
+	password string
+	hash     string
+}{
+	{"admin", "$2a$10$1rqCHXRQ1h0se3jnJO5ZtuX5keEQOTPL1Tkb4W4yEAcV0x26l7KEO"},
+	{"teacher", "$2a$10$xiu4.QS1oUOtlsgJdbdZsu4nDLGUfRfRKLdvjsxK4RjNrnhoZbFI6"},
+	{"student", "$2a$10$/TVggaU5mgv103DU3w1FruWKesYujzOtIjy6ik0fQ6jPGAiSkHiA."},
+	{"guest", "$2a$10$ouCsus6K//.Xr04sNS0M9O1s8BXEDHdC9pFupCCup.leWdSlPn9hm"},
+}
+
+func TestPasswordDigest(t *testing.T) {
+	// The digest of the demo admin, as written next to it in the demo data
+	digest := passwordDigest("admin")
+	if !strings.HasPrefix(digest, "c7ad44cbad762a5da0a452f9e854fdc1e0e7a52a38015f23f3eab1d80b931dd4") || len(digest) != 128 {
+		t.Errorf("passwordDigest(admin) = %s", digest)
+	}
+}
+
+func TestCheckPasswordSeeded(t *testing.T) {
+	for _, seeded := range seededPasswords {
+		if !checkPassword(seeded.hash, seeded.password) {
+			t.Errorf("the seeded hash of %s doesn't match it", seeded.password)
+		}
+		if checkPassword(seeded.hash, seeded.password+"x") {
+			t.Errorf("the seeded hash of %s matches another password", seeded.password)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("s3cret-Pa55")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(hash, "s3cret-Pa55") {
+		t.Errorf("the hash doesn't match its password")
+	}
+	if checkPassword(hash, "s3cret-pa55") {
+		t.Errorf("the hash matches another password")
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := generatePassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(password) != GENERATED_PASSWORD_LENGTH {
+		t.Errorf("the password has %d characters, not %d", len(password), GENERATED_PASSWORD_LENGTH)
+	}
+	for _, r := range password {
+		if !strings.ContainsRune(PASSWORD_ALPHABET, r) {
+			t.Errorf("the password has %q, which isn't in the alphabet", r)
+		}
+	}
+}
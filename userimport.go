@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Results of each imported row
+const (
+	IMPORT_CREATED = "created"
+	IMPORT_UPDATED = "updated"
+	IMPORT_SKIPPED = "skipped"
+	IMPORT_FAILED  = "failed"
+)
+
+// Longest username the wizard accepts
+const MAX_USERNAME_LENGTH = 30
+
+// Fields of the user import, and the headers they are also known by
+var userImportFields = []string{"username", "email", "first_name", "last_name", "date_of_birth", "matric_number", "matric_date"}
+
+var userImportAliases = map[string][]string{
+	"username":      {"login", "user"},
+	"email":         {"e-mail", "email address", "mail"},
+	"first_name":    {"first name", "given name", "forename"},
+	"last_name":     {"last name", "surname", "family name"},
+	"date_of_birth": {"dob", "birth date", "birthdate", "birthday"},
+	"matric_number": {"matric", "matriculation number", "student id", "student number"},
+	"matric_date":   {"matriculation date", "enrolment date", "enrollment date"},
+}
+
+// The result of a row of the import
+type UserImportResult struct {
+	Line     int
+	Status   string
+	Username string
+	Message  string
+	Password string // Temporary password of the created users
+}
+
+// Imports the users of a spreadsheet, matching the existing ones by email and matric number
+type userImporter struct {
+	db         *gorm.DB
+	dryRun     bool
+	update     bool
+	dateLayout string
+
+	// Usernames taken (by the database or earlier rows)
+	usernames map[string]bool
+
+	// First line of each email and matric number, to find the repeated ones
+	emails        map[string]int
+	matricNumbers map[string]int
+}
+
+func newUserImporter(db *gorm.DB, dryRun, update bool, dateLayout string) (*userImporter, error) {
+	importer := &userImporter{
+		db:            db,
+		dryRun:        dryRun,
+		update:        update,
+		dateLayout:    dateLayout,
+		usernames:     map[string]bool{},
+		emails:        map[string]int{},
+		matricNumbers: map[string]int{},
+	}
+
+	users := []models.User{}
+	if err := db.Select("username").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("can't read the users: %v", err)
+	}
+	for _, user := range users {
+		importer.usernames[strings.ToLower(user.Username)] = true
+	}
+	return importer, nil
+}
+
+// Keeps the letters and digits of a name, without the accents (e.g. "Ó Súilleabháin" is "osuilleabhain")
+func usernamePart(name string) string {
+	part := []rune{}
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			part = append(part, r)
+		}
+	}
+	return string(part)
+}
+
+// Generates a username that isn't taken: the initial and the last name (e.g. jsmith, jsmith2...),
+// falling back to the email or the matric number
+func (importer *userImporter) generateUsername(values map[string]string) string {
+	base := ""
+	first, last := usernamePart(values["first_name"]), usernamePart(values["last_name"])
+	switch {
+	case first != "" && last != "":
+		base = first[:1] + last
+	case values["email"] != "":
+		base = usernamePart(strings.SplitN(values["email"], "@", 2)[0])
+	default:
+		base = usernamePart(values["matric_number"])
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > MAX_USERNAME_LENGTH-3 {
+		base = base[:MAX_USERNAME_LENGTH-3]
+	}
+
+	username := base
+	for i := 2; importer.usernames[username]; i++ {
+		username = base + strconv.Itoa(i)
+	}
+	return username
+}
+
+// Validates the values of a row, returning the problems found
+func validateUserImportRow(values map[string]string, dateLayout string) []string {
+	problems := []string{}
+	if values["email"] == "" && values["matric_number"] == "" {
+		problems = append(problems, "it needs an email or a matric number")
+	}
+	if values["email"] != "" {
+		if message := validateEmail(values["email"], nil); message != "" {
+			problems = append(problems, "email: "+message)
+		}
+	}
+	if values["username"] != "" {
+		if message := fieldValidators["admin-username"](values["username"], nil); message != "" {
+			problems = append(problems, "username: "+message)
+		}
+	}
+	for _, field := range []string{"first_name", "last_name"} {
+		if message := validateLength(values[field], 50); message != "" {
+			problems = append(problems, field+": "+message)
+		}
+	}
+	for _, field := range []string{"date_of_birth", "matric_date"} {
+		if values[field] == "" {
+			continue
+		}
+		if _, err := parseSpreadsheetDate(values[field], dateLayout); err != nil {
+			problems = append(problems, field+": "+err.Error())
+		}
+	}
+	return problems
+}
+
+// Finds the user with the email or the matric number of a row (an error if they belong to different users)
+func (importer *userImporter) findExisting(values map[string]string) (*models.User, error) {
+	var byEmail, byMatric *models.User
+	if values["email"] != "" {
+		user := models.User{}
+		if err := importer.db.Where("LOWER(email) = LOWER(?)", values["email"]).First(&user).Error; err == nil {
+			byEmail = &user
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+	}
+	if values["matric_number"] != "" {
+		user := models.User{}
+		if err := importer.db.Where("matric_number = ?", values["matric_number"]).First(&user).Error; err == nil {
+			byMatric = &user
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+	}
+
+	if byEmail != nil && byMatric != nil && byEmail.ID != byMatric.ID {
+		return nil, fmt.Errorf("the email belongs to %s and the matric number to %s", byEmail.Username, byMatric.Username)
+	}
+	if byEmail != nil {
+		return byEmail, nil
+	}
+	return byMatric, nil
+}
+
+// Imports a row
+func (importer *userImporter) Import(row SpreadsheetRow) UserImportResult {
+	values := row.Values
+	result := UserImportResult{Line: row.Line, Username: values["username"]}
+	fail := func(format string, args ...interface{}) UserImportResult {
+		result.Status, result.Message = IMPORT_FAILED, fmt.Sprintf(format, args...)
+		return result
+	}
+
+	if problems := validateUserImportRow(values, importer.dateLayout); len(problems) > 0 {
+		return fail("%s", strings.Join(problems, "; "))
+	}
+
+	// The same student twice in the file is only imported once
+	email, matric := strings.ToLower(values["email"]), values["matric_number"]
+	if line, found := importer.emails[email]; found && email != "" {
+		result.Status, result.Message = IMPORT_SKIPPED, fmt.Sprintf("the email is repeated from line %d", line)
+		return result
+	}
+	if line, found := importer.matricNumbers[matric]; found && matric != "" {
+		result.Status, result.Message = IMPORT_SKIPPED, fmt.Sprintf("the matric number is repeated from line %d", line)
+		return result
+	}
+	if email != "" {
+		importer.emails[email] = row.Line
+	}
+	if matric != "" {
+		importer.matricNumbers[matric] = row.Line
+	}
+
+	existing, err := importer.findExisting(values)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if existing != nil {
+		return importer.updateUser(existing, values, result)
+	}
+	return importer.createUser(values, result)
+}
+
+// Creates the user of a row, with a temporary password
+func (importer *userImporter) createUser(values map[string]string, result UserImportResult) UserImportResult {
+	if values["first_name"] == "" || values["last_name"] == "" {
+		result.Status, result.Message = IMPORT_FAILED, "a new user needs a first and a last name"
+		return result
+	}
+
+	username := values["username"]
+	if username == "" {
+		username = importer.generateUsername(values)
+	} else if importer.usernames[strings.ToLower(username)] {
+		result.Status, result.Message = IMPORT_FAILED, fmt.Sprintf("the username %s is taken", username)
+		return result
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		result.Status, result.Message = IMPORT_FAILED, err.Error()
+		return result
+	}
+
+	gmt := time.FixedZone("GMT", 0)
+	user := models.User{
+		Username:     username,
+		Email:        values["email"],
+		FirstName:    values["first_name"],
+		LastName:     values["last_name"],
+		MatricNumber: values["matric_number"],
+		MatricDate:   time.Now().In(gmt),
+		Active:       true,
+	}
+	if user.MatricNumber == "" {
+		user.MatricNumber = username
+	}
+	if values["date_of_birth"] != "" {
+		user.DateOfBirth, _ = parseSpreadsheetDate(values["date_of_birth"], importer.dateLayout)
+	}
+	if values["matric_date"] != "" {
+		user.MatricDate, _ = parseSpreadsheetDate(values["matric_date"], importer.dateLayout)
+	}
+
+	result.Username = username
+	importer.usernames[strings.ToLower(username)] = true
+	if !importer.dryRun {
+		if user.Password, err = hashPassword(password); err != nil {
+			result.Status, result.Message = IMPORT_FAILED, err.Error()
+			return result
+		}
+		if err := importer.db.Create(&user).Error; err != nil {
+			result.Status, result.Message = IMPORT_FAILED, fmt.Sprintf("can't create the user: %v", err)
+			return result
+		}
+		result.Password = password
+	}
+
+	result.Status, result.Message = IMPORT_CREATED, "new user"
+	if values["username"] == "" {
+		result.Message = "new user, generated username"
+	}
+	return result
+}
+
+// Updates the fields of an existing user that the row changes (the username and the password are kept)
+func (importer *userImporter) updateUser(user *models.User, values map[string]string, result UserImportResult) UserImportResult {
+	result.Username = user.Username
+
+	changes := map[string]interface{}{}
+	described := []string{}
+	change := func(column, label string, from, to interface{}) {
+		changes[column] = to
+		described = append(described, fmt.Sprintf("%s %v -> %v", label, from, to))
+	}
+	if values["email"] != "" && !strings.EqualFold(values["email"], user.Email) {
+		change("email", "email", user.Email, values["email"])
+	}
+	if values["matric_number"] != "" && values["matric_number"] != user.MatricNumber {
+		change("matric_number", "matric number", user.MatricNumber, values["matric_number"])
+	}
+	if values["first_name"] != "" && values["first_name"] != user.FirstName {
+		change("first_name", "first name", user.FirstName, values["first_name"])
+	}
+	if values["last_name"] != "" && values["last_name"] != user.LastName {
+		change("last_name", "last name", user.LastName, values["last_name"])
+	}
+	for _, field := range []struct {
+		column, label string
+		current       time.Time
+	}{
+		{"date_of_birth", "date of birth", user.DateOfBirth},
+		{"matric_date", "matric date", user.MatricDate},
+	} {
+		if values[field.column] == "" {
+			continue
+		}
+		date, _ := parseSpreadsheetDate(values[field.column], importer.dateLayout)
+		if date.Format("2006-01-02") != field.current.Format("2006-01-02") {
+			change(field.column, field.label, field.current.Format("2006-01-02"), date.Format("2006-01-02"))
+		}
+	}
+
+	if len(changes) == 0 {
+		result.Status, result.Message = IMPORT_SKIPPED, "already up to date"
+		return result
+	}
+	if !importer.update {
+		result.Status, result.Message = IMPORT_SKIPPED, "exists (use --update to change: "+strings.Join(described, ", ")+")"
+		return result
+	}
+
+	if !importer.dryRun {
+		if err := importer.db.Model(user).Updates(changes).Error; err != nil {
+			result.Status, result.Message = IMPORT_FAILED, fmt.Sprintf("can't update the user: %v", err)
+			return result
+		}
+	}
+	result.Status, result.Message = IMPORT_UPDATED, strings.Join(described, ", ")
+	return result
+}
+
+// Writes the results of an import as CSV (with the temporary passwords, so only the owner can read it)
+func writeUserImportReport(path string, results []UserImportResult) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"line", "status", "username", "temporary_password", "message"})
+	for _, result := range results {
+		writer.Write([]string{strconv.Itoa(result.Line), result.Status, result.Username, result.Password, result.Message})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Imports the users of a CSV or XLSX file
+func userImportCommand(args []string) int {
+	settingsPath := SETTINGS_FILE
+	dryRun := false
+	update := false
+	sheet := ""
+	columns := ""
+	dateLayout := ""
+	reportPath := ""
+
+	flags := userFlags("import", &settingsPath)
+	flags.BoolVar(&dryRun, "dry-run", dryRun, "only show what would change")
+	flags.BoolVar(&update, "update", update, "update the existing users (matched by email or matric number) with the values of the file")
+	flags.StringVar(&sheet, "sheet", sheet, "sheet of the XLSX file (default the first one)")
+	flags.StringVar(&columns, "columns", columns, "headers of the columns, if the usual ones aren't used (e.g. \"matric_number=Student ID,email=Uni Mail\")")
+	flags.StringVar(&dateLayout, "date-format", dateLayout, "format of the dates, as a Go layout (default YYYY-MM-DD, DD/MM/YYYY and the Excel dates)")
+	flags.StringVar(&reportPath, "report", reportPath, "CSV file the results are written to, with the temporary passwords (printed otherwise)")
+	flags.Usage = func() {
+		fmt.Println("Usage: installer user import [flags] <users.csv or users.xlsx>")
+		fmt.Printf("The first row has the headers of the columns: %s.\n", strings.Join(userImportFields, ", "))
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	overrides, err := parseColumnOverrides(columns, userImportFields)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	spreadsheet, err := readSpreadsheet(flags.Arg(0), sheet)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	rows, err := mapSpreadsheetRows(spreadsheet, userImportFields, userImportAliases, overrides, nil)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	db, _, err := openInstalledDatabase(settingsPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	importer, err := newUserImporter(db, dryRun, update, dateLayout)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	results := []UserImportResult{}
+	counts := map[string]int{}
+	for _, row := range rows {
+		result := importer.Import(row)
+		results = append(results, result)
+		counts[result.Status]++
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, nothing was changed.")
+		fmt.Println()
+	}
+	fmt.Printf("%-6s %-8s %-20s %s\n", "Line", "Result", "Username", "Details")
+	for _, result := range results {
+		message := result.Message
+		if result.Password != "" && reportPath == "" {
+			message += ", temporary password " + result.Password
+		}
+		fmt.Printf("%-6d %-8s %-20s %s\n", result.Line, result.Status, result.Username, message)
+	}
+	fmt.Printf("\n%d created, %d updated, %d skipped, %d failed\n", counts[IMPORT_CREATED], counts[IMPORT_UPDATED], counts[IMPORT_SKIPPED], counts[IMPORT_FAILED])
+
+	if reportPath != "" {
+		if err := writeUserImportReport(reportPath, results); err != nil {
+			fmt.Printf("can't write the report to %s: %v\n", reportPath, err)
+			return 1
+		}
+		fmt.Printf("Wrote the results (and the temporary passwords) to %s\n", reportPath)
+	}
+
+	if counts[IMPORT_FAILED] > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/YagoCarballo/kumquat-academy-api/database/models"
+	"github.com/jinzhu/gorm"
+)
+
+// Opens an empty SQLite database in memory, with the tables of the models
+func openTestDatabase(t *testing.T, tables ...interface{}) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.LogMode(false)
+	if err := db.AutoMigrate(tables...).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUsernamePart(t *testing.T) {
+	tests := map[string]string{
+		"Smith":          "smith",
+		"Ó Súilleabháin": "osuilleabhain",
+		"O'Neill-Brown":  "oneillbrown",
+		"Zoë":            "zoe",
+		"李":              "",
+	}
+	for name, want := range tests {
+		if got := usernamePart(name); got != want {
+			t.Errorf("usernamePart(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestGenerateUsername(t *testing.T) {
+	importer := &userImporter{usernames: map[string]bool{"jsmith": true, "jsmith2": true}}
+	tests := []struct {
+		values map[string]string
+		want   string
+	}{
+		{map[string]string{"first_name": "Jane", "last_name": "Smith"}, "jsmith3"},
+		{map[string]string{"first_name": "Seán", "last_name": "Ó Súilleabháin"}, "sosuilleabhain"},
+		{map[string]string{"email": "Anna.M@example.com"}, "annam"},
+		{map[string]string{"matric_number": "140001"}, "140001"},
+		{map[string]string{"first_name": "李", "last_name": "李"}, "user"},
+		{map[string]string{"first_name": "Ann", "last_name": "Abcdefghijklmnopqrstuvwxyzabcdef"}, "aabcdefghijklmnopqrstuvwxyz"},
+	}
+	for _, test := range tests {
+		if got := importer.generateUsername(test.values); got != test.want {
+			t.Errorf("generateUsername(%v) = %q, want %q", test.values, got, test.want)
+		}
+	}
+}
+
+func TestValidateUserImportRow(t *testing.T) {
+	tests := []struct {
+		values   map[string]string
+		problems int
+	}{
+		{map[string]string{"email": "jane@example.com", "first_name": "Jane", "last_name": "Smith"}, 0},
+		{map[string]string{"matric_number": "140001", "date_of_birth": "09/02/1990"}, 0},
+		{map[string]string{"first_name": "Jane"}, 1},
+		{map[string]string{"email": "not an email"}, 1},
+		{map[string]string{"email": "jane@example.com", "date_of_birth": "1990-31-02", "matric_date": "yesterday"}, 2},
+	}
+	for _, test := range tests {
+		if problems := validateUserImportRow(test.values, ""); len(problems) != test.problems {
+			t.Errorf("validateUserImportRow(%v) = %q, want %d problems", test.values, problems, test.problems)
+		}
+	}
+}
+
+// The temporary passwords have to sign the users in
+func TestImportTemporaryPassword(t *testing.T) {
+	db := openTestDatabase(t, &models.User{})
+	importer, err := newUserImporter(db, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := importer.Import(SpreadsheetRow{Line: 2, Values: map[string]string{
+		"email": "jane@example.com", "first_name": "Jane", "last_name": "Smith", "matric_number": "140001",
+	}})
+	if result.Status != IMPORT_CREATED || result.Password == "" {
+		t.Fatalf("the row wasn't created: %+v", result)
+	}
+
+	user := models.User{}
+	if err := db.Where("username = ?", result.Username).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(user.Password, result.Password) {
+		t.Errorf("the temporary password of %s doesn't match its hash", user.Username)
+	}
+}
+
+func TestImportRepeatedRows(t *testing.T) {
+	db := openTestDatabase(t, &models.User{})
+	importer, err := newUserImporter(db, true, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []map[string]string{
+		{"email": "jane@example.com", "first_name": "Jane", "last_name": "Smith"},
+		{"email": "JANE@example.com", "first_name": "Jane", "last_name": "Smith"},
+		{"email": "john@example.com", "first_name": "John", "last_name": "Smith"},
+	}
+	want := []string{IMPORT_CREATED, IMPORT_SKIPPED, IMPORT_CREATED}
+	for i, values := range rows {
+		result := importer.Import(SpreadsheetRow{Line: i + 2, Values: values})
+		if result.Status != want[i] {
+			t.Errorf("line %d: %s (%s), want %s", i+2, result.Status, result.Message, want[i])
+		}
+		if result.Password != "" {
+			t.Errorf("line %d: a dry run has a temporary password", i+2)
+		}
+	}
+}
+
+// The users are found by their email in any case
+func TestImportExistingEmailCase(t *testing.T) {
+	db := openTestDatabase(t, &models.User{})
+	if err := db.Create(&models.User{ID: 1, Username: "jane", Email: "Jane.Smith@Example.com", FirstName: "Jane", LastName: "Smith"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	importer, err := newUserImporter(db, false, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := importer.Import(SpreadsheetRow{Line: 2, Values: map[string]string{
+		"email": "jane.smith@example.com", "first_name": "Jane", "last_name": "Smith-Jones",
+	}})
+	if result.Status != IMPORT_UPDATED || result.Username != "jane" {
+		t.Errorf("the row is %s for %s (%s), want it to update jane", result.Status, result.Username, result.Message)
+	}
+	var count int
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("the import left %d users, want 1", count)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of the site info
+const (
+	MAX_TITLE_LENGTH       = 100
+	MAX_DESCRIPTION_LENGTH = 255
+)
+
+// ValidationErrors holds the error of each invalid field (by field name).
+type ValidationErrors map[string]string
+
+var (
+	// Characters MySQL allows in unquoted database names
+	databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+
+	// RFC 1123 host names (e.g. db.example.com)
+	hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+)
+
+// Validation rules of the wizard fields, each one returns the error message (or "").
+//
+// The rules only run on fields with a value, the required ones are checked before.
+var fieldValidators = map[string]func(value string, form url.Values) string{
+	"server-port": validatePort,
+	"db-port":     validatePort,
+	"email-port":  validatePort,
+	"db-host":     validateDatabaseHost,
+	"db-name": func(value string, form url.Values) string {
+		if !databaseNamePattern.MatchString(value) {
+			return "Use up to 64 letters, numbers, _ or $."
+		}
+		return ""
+	},
+	"db-url": func(value string, form url.Values) string {
+		if _, err := parseDatabaseURL(value); err != nil {
+			return fmt.Sprintf("Can't read the URL: %v", err)
+		}
+		return ""
+	},
+	"db-params":   validateDatabaseParams,
+	"db-tls-ca":   validateCertificatePath,
+	"db-tls-cert": validateCertificatePath,
+	"db-tls-key": func(value string, form url.Values) string {
+		if form.Get("db-tls-cert") == "" {
+			return "The key needs a client certificate."
+		}
+		return validateCertificatePath(value, form)
+	},
+	"db-wait-timeout": func(value string, form url.Values) string {
+		if _, err := databaseWaitFromForm(form); err != nil {
+			return "Use a duration like 30s or 2m (0 doesn't wait)."
+		}
+		return ""
+	},
+	"db-type": func(value string, form url.Values) string {
+		if _, err := databaseDialect(value); err != nil {
+			return fmt.Sprintf("Choose one of: %s.", strings.Join(databaseTypes, ", "))
+		}
+		return ""
+	},
+	"sqlite-path": func(value string, form url.Values) string {
+		if strings.HasPrefix(value, "~") {
+			return "The ~ isn't expanded, use an absolute path instead."
+		}
+		if strings.ContainsRune(value, 0) {
+			return "The path contains invalid characters."
+		}
+		if strings.HasSuffix(value, "/") {
+			return "Use the path of the database file, not of its directory."
+		}
+		return ""
+	},
+	"uploads-path": func(value string, form url.Values) string {
+		if strings.HasPrefix(value, "~") {
+			return "The ~ isn't expanded, use an absolute path instead."
+		}
+		if strings.ContainsRune(value, 0) {
+			return "The path contains invalid characters."
+		}
+		if !filepath.IsAbs(value) && strings.HasPrefix(filepath.Clean(value), "..") {
+			return "Use an absolute path, or a path inside the API directory."
+		}
+		return ""
+	},
+	"db-backup-dir": func(value string, form url.Values) string {
+		if strings.HasPrefix(value, "~") {
+			return "The ~ isn't expanded, use an absolute path instead."
+		}
+		if strings.ContainsRune(value, 0) {
+			return "The path contains invalid characters."
+		}
+		return ""
+	},
+	"page-title": func(value string, form url.Values) string {
+		return validateLength(value, MAX_TITLE_LENGTH)
+	},
+	"page-description": func(value string, form url.Values) string {
+		return validateLength(value, MAX_DESCRIPTION_LENGTH)
+	},
+	"admin-username": func(value string, form url.Values) string {
+		if strings.ContainsAny(value, " \t") {
+			return "The username can't contain spaces."
+		}
+		return validateLength(value, 30)
+	},
+	"public-key": func(value string, form url.Values) string {
+		if filepath.Clean(value) == filepath.Clean(form.Get("private-key")) {
+			return "The public key can't use the same file as the private key."
+		}
+		return ""
+	},
+	"admin-email":  validateEmail,
+	"email-sender": validateEmail,
+	"admin-first-name": func(value string, form url.Values) string {
+		return validateLength(value, 50)
+	},
+	"admin-last-name": func(value string, form url.Values) string {
+		return validateLength(value, 50)
+	},
+	"admin-date-of-birth": func(value string, form url.Values) string {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return "Use the format YYYY-MM-DD."
+		}
+		if date.After(time.Now()) {
+			return "The date of birth can't be in the future."
+		}
+		return ""
+	},
+	"admin-password": func(value string, form url.Values) string {
+		if len(value) < 8 {
+			return "Use at least 8 characters."
+		}
+		return ""
+	},
+	"admin-password-confirm": func(value string, form url.Values) string {
+		if value != form.Get("admin-password") {
+			return "The passwords don't match."
+		}
+		return ""
+	},
+}
+
+// Database types the installer supports (see databaseDialect)
+var databaseTypes = []string{"MySQL", "Postgres", "SQLite"}
+
+func validatePort(value string, form url.Values) string {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return "Use a port between 1 and 65535."
+	}
+	return ""
+}
+
+// Accepts host names, IP addresses and unix socket paths
+func validateDatabaseHost(value string, form url.Values) string {
+	if strings.HasPrefix(value, "/") {
+		return ""
+	}
+	if net.ParseIP(strings.Trim(value, "[]")) != nil {
+		return ""
+	}
+	if len(value) > 253 || !hostnamePattern.MatchString(value) {
+		return "Use a host name (e.g. localhost), an IP address or the path of a unix socket."
+	}
+	return ""
+}
+
+func validateEmail(value string, form url.Values) string {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return "Use a valid email address (e.g. admin@example.com)."
+	}
+	return ""
+}
+
+func validateLength(value string, max int) string {
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Sprintf("Use %d characters or less.", max)
+	}
+	return ""
+}
+
+// Validates the fields, returning the errors (empty if everything is valid)
+func validateFields(fields []string, required []string, form url.Values) ValidationErrors {
+	errors := ValidationErrors{}
+
+	for _, field := range required {
+		if strings.TrimSpace(form.Get(field)) == "" {
+			errors[field] = "This field is required."
+		}
+	}
+
+	for _, field := range fields {
+		value := form.Get(field)
+		if _, failed := errors[field]; failed || value == "" {
+			continue
+		}
+		if validator, found := fieldValidators[field]; found {
+			if message := validator(value, form); message != "" {
+				errors[field] = message
+			}
+		}
+	}
+
+	return errors
+}
+
+// Validates every step of the wizard (before installing without it)
+func validateForm(form url.Values) ValidationErrors {
+	errors := ValidationErrors{}
+	for _, step := range wizardSteps {
+		for field, message := range validateFields(step.Fields, step.RequiredFields(form), form) {
+			errors[field] = message
+		}
+	}
+	return errors
+}
+
+// Joins the errors into a single one (sorted by field)
+func (errors ValidationErrors) Error() string {
+	fields := []string{}
+	for field := range errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := []string{}
+	for _, field := range fields {
+		messages = append(messages, field+": "+errors[field])
+	}
+	return "invalid settings: " + strings.Join(messages, "; ")
+}
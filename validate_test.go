@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidateFields(t *testing.T) {
+	fields := []string{"server-port", "db-host", "db-name", "db-type", "uploads-path", "admin-email", "admin-password", "admin-password-confirm", "admin-date-of-birth"}
+	tests := []struct {
+		form    url.Values
+		invalid []string
+	}{
+		{url.Values{"page-title": {"Kumquat"}, "server-port": {"3000"}, "db-host": {"db.example.com"}, "db-name": {"kumquat"}, "uploads-path": {"./attachments"}}, []string{}},
+		{url.Values{"page-title": {"Kumquat"}, "db-host": {"/var/run/mysqld/mysqld.sock"}, "admin-email": {"admin@example.com"}}, []string{}},
+		{url.Values{"page-title": {"Kumquat"}, "db-host": {"::1"}, "db-type": {"postgres"}}, []string{}},
+		{url.Values{"page-title": {"Kumquat"}, "db-type": {"SQLite"}, "admin-date-of-birth": {"1990-02-09"}}, []string{}},
+		{url.Values{"page-title": {" "}}, []string{"page-title"}},
+		{url.Values{"server-port": {"0"}, "db-host": {"db_example"}}, []string{"db-host", "page-title", "server-port"}},
+		{url.Values{"page-title": {"Kumquat"}, "db-name": {"kumquat-db"}, "db-type": {"Oracle"}}, []string{"db-name", "db-type"}},
+		{url.Values{"page-title": {"Kumquat"}, "uploads-path": {"~/attachments"}, "admin-email": {"Admin <admin@example.com>"}}, []string{"admin-email", "uploads-path"}},
+		{url.Values{"page-title": {"Kumquat"}, "admin-password": {"short"}, "admin-password-confirm": {"other"}}, []string{"admin-password", "admin-password-confirm"}},
+		{url.Values{"page-title": {"Kumquat"}, "admin-date-of-birth": {"09/02/1990"}}, []string{"admin-date-of-birth"}},
+	}
+	for _, test := range tests {
+		invalid := []string{}
+		for field := range validateFields(fields, []string{"page-title"}, test.form) {
+			invalid = append(invalid, field)
+		}
+		sort.Strings(invalid)
+		if !reflect.DeepEqual(invalid, test.invalid) {
+			t.Errorf("validateFields(%v) failed %v, want %v", test.form, invalid, test.invalid)
+		}
+	}
+}
+
+// SQLite only needs the path of the database, the servers their address and credentials
+func TestDatabaseStepRequiredFields(t *testing.T) {
+	step, _ := findWizardStep("database")
+	tests := []struct {
+		form    url.Values
+		invalid []string
+	}{
+		{url.Values{"db-type": {"SQLite"}, "sqlite-path": {"./kumquat.db"}}, []string{}},
+		{url.Values{"db-type": {"SQLite"}}, []string{"sqlite-path"}},
+		{url.Values{"db-type": {"Postgres"}, "sqlite-path": {"./kumquat.db"}}, []string{"db-host", "db-name", "db-password", "db-port", "db-username"}},
+		{url.Values{"db-type": {"MySQL"}, "db-host": {"localhost"}, "db-port": {"3306"}, "db-name": {"kumquat"}, "db-username": {"root"}, "db-password": {"root"}}, []string{}},
+		// Without a type it is MySQL
+		{url.Values{}, []string{"db-host", "db-name", "db-password", "db-port", "db-type", "db-username"}},
+	}
+	for _, test := range tests {
+		invalid := []string{}
+		for field := range step.Validate(test.form) {
+			invalid = append(invalid, field)
+		}
+		sort.Strings(invalid)
+		if !reflect.DeepEqual(invalid, test.invalid) {
+			t.Errorf("the database step with %v failed %v, want %v", test.form, invalid, test.invalid)
+		}
+	}
+}
@@ -0,0 +1,697 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default file the wizard progress is saved to
+const DEFAULT_STATE_FILE = "./installer-state.json"
+
+// WizardStep is one page of the installation wizard.
+type WizardStep struct {
+	ID       string
+	Title    string
+	Intro    string
+	Fields   []string // Form fields saved by this step
+	Required []string // Fields that can't be left empty
+
+	// Fields that can't be left empty with each database dialect (on top of Required)
+	DialectRequired map[string][]string
+}
+
+// WizardState is the progress of the wizard, saved after every step
+// so a refresh (or a crashed installer) resumes where it was left.
+type WizardState struct {
+	Completed map[string]bool   `json:"completed"`
+	Values    map[string]string `json:"values"`
+	JobID     string            `json:"job_id,omitempty"` // Installation started from this wizard
+	Changed   map[string]bool   `json:"changed"`          // Fields the operator changed in the wizard
+
+	// Fields set by the environment (they win over the wizard)
+	environment map[string]EnvironmentVariable
+
+	// Variables the wizard ignores, settings.toml can't keep what they set
+	ignored map[string]bool
+
+	// Why the environment couldn't be applied (the installation waits until it's fixed)
+	environmentErr error
+}
+
+// Data passed to the wizard templates
+type WizardPage struct {
+	Header        *Header
+	Intro         string
+	Steps         []WizardStepLink
+	Step          *WizardStep
+	Previous      *WizardStep
+	Action        string
+	SubmitLabel   string
+	Values        map[string]string
+	Errors        []string
+	FieldErrors   ValidationErrors // Error of each invalid field
+	DatabaseTypes []string
+	Review        []ReviewItem
+	Checks        []EnvironmentCheck
+	Changes       []SettingChange
+	NewSettings   bool
+	Environment   []string
+	Locked        map[string]bool // Fields set by the environment
+	Stored        map[string]bool // Secret fields with a value kept on the server
+	SchemaDiff    string          // Differences between the database and the schema
+}
+
+type WizardStepLink struct {
+	ID      string
+	Title   string
+	Done    bool
+	Current bool
+}
+
+type ReviewItem struct {
+	Label string
+	Value string
+}
+
+var wizardSteps = []WizardStep{
+	{
+		ID:    "environment",
+		Title: "Environment",
+		Intro: "Checks the server the platform is going to be installed on.",
+	},
+	{
+		ID:       "database",
+		Title:    "Database",
+		Intro:    "The database the platform will store its data in.",
+		Fields:   []string{"db-url", "db-type", "db-name", "db-host", "db-port", "db-username", "db-password", "sqlite-path", "db-wait-timeout"},
+		Required: []string{"db-type"},
+		DialectRequired: map[string][]string{
+			"mysql":    {"db-name", "db-host", "db-port", "db-username", "db-password"},
+			"postgres": {"db-name", "db-host", "db-port", "db-username", "db-password"},
+			"sqlite3":  {"sqlite-path"},
+		},
+	},
+	{
+		ID:       "administrator",
+		Title:    "Administrator",
+		Intro:    "The account used to manage the platform.",
+		Fields:   []string{"admin-username", "admin-email", "admin-first-name", "admin-last-name", "admin-date-of-birth", "admin-matric-number", "admin-password", "admin-password-confirm"},
+		Required: []string{"admin-username", "admin-email", "admin-first-name", "admin-last-name", "admin-date-of-birth", "admin-password", "admin-password-confirm"},
+	},
+	{
+		ID:       "site",
+		Title:    "Site Info",
+		Intro:    "How the platform presents itself and where it runs.",
+		Fields:   []string{"page-title", "page-description", "server-port", "uploads-path"},
+		Required: []string{"page-title", "page-description", "server-port", "uploads-path"},
+	},
+	{
+		ID:     "email",
+		Title:  "Email",
+		Intro:  "The mail server used to send notifications and password resets (optional).",
+		Fields: []string{"email-server", "email-port", "email-user", "email-password", "email-sender"},
+	},
+	{
+		ID:       "keys",
+		Title:    "Keys",
+		Intro:    "The key pair used to sign the sessions.",
+		Fields:   []string{"private-key", "public-key", "keys-generate"},
+		Required: []string{"private-key", "public-key"},
+	},
+	{
+		ID:     "demo",
+		Title:  "Demo Data",
+		Intro:  "What should be created in the database.",
+		Fields: []string{"db-create", "db-demo", "db-backup", "db-backup-dir"},
+	},
+	{
+		ID:    "review",
+		Title: "Review",
+		Intro: "Check the settings before installing.",
+	},
+	{
+		ID:    "install",
+		Title: "Install",
+		Intro: "Everything is ready.",
+	},
+}
+
+// Labels used on the review step (in the order they are shown)
+var reviewLabels = []ReviewItem{
+	{"page-title", "Title"},
+	{"page-description", "Description"},
+	{"server-port", "Server Port"},
+	{"uploads-path", "Uploads Path"},
+	{"db-type", "Database Type"},
+	{"db-host", "Database Host"},
+	{"db-port", "Database Port"},
+	{"db-name", "Database Name"},
+	{"db-username", "Database Username"},
+	{"db-password", "Database Password"},
+	{"sqlite-path", "SQLite File"},
+	{"admin-username", "Administrator"},
+	{"admin-email", "Administrator Email"},
+	{"admin-password", "Administrator Password"},
+	{"email-server", "Email Server"},
+	{"email-port", "Email Port"},
+	{"email-user", "Email User"},
+	{"email-password", "Email Password"},
+	{"email-sender", "Email Sender"},
+	{"private-key", "Private Key"},
+	{"public-key", "Public Key"},
+	{"keys-generate", "Generate Keys"},
+	{"db-create", "Create Tables"},
+	{"db-demo", "Insert Sample Data"},
+	{"db-backup", "Back Up the Existing Tables"},
+	{"db-backup-dir", "Backup Directory"},
+}
+
+// Fields settings.toml can't keep, so the wizard ignores them
+// (the other commands still take them from the KUMQUAT_DB_* variables)
+var unsavedFields = []string{"db-tls", "db-tls-ca", "db-tls-cert", "db-tls-key", "db-tls-skip-verify", "db-params"}
+
+// Fields never sent back to the browser (an empty one keeps the value on the server)
+var secretFields = map[string]bool{
+	"db-password":            true,
+	"email-password":         true,
+	"admin-password":         true,
+	"admin-password-confirm": true,
+}
+
+var (
+	// File the wizard progress is saved to
+	wizardStatePath = DEFAULT_STATE_FILE
+
+	// Passwords entered in the wizard, only kept in memory (asked again after a restart)
+	wizardSecrets = map[string]string{}
+
+	// Guards the state file and the passwords
+	wizardStateLock sync.Mutex
+)
+
+// Creates the state of a wizard that hasn't started yet, with the default values
+func newWizardState() *WizardState {
+	return &WizardState{
+		Completed: map[string]bool{},
+		Changed:   map[string]bool{},
+		Values: map[string]string{
+			"db-type":         "MySQL",
+			"db-host":         "localhost",
+			"db-port":         "3306",
+			"db-wait-timeout": "60s",
+			"server-port":     "3000",
+			"uploads-path":    "./attachments",
+			"private-key":     "./privateKey.pem",
+			"public-key":      "./publicKey.pub",
+			"keys-generate":   "on",
+			"db-create":       "on",
+			"db-demo":         "on",
+			"db-backup":       "on",
+			"db-backup-dir":   DEFAULT_BACKUP_DIR,
+			"api-prefix":      "/api",
+			"api-version":     "1",
+		},
+		environment: map[string]EnvironmentVariable{},
+	}
+}
+
+// Loads the wizard progress (or a new one if there is nothing saved),
+// with the environment variables applied on top.
+func loadWizardState() *WizardState {
+	state := readWizardState()
+
+	environment, err := applyEnvironment(state.Values)
+	if err != nil {
+		log.Println(err)
+	}
+	state.environment = environment
+	state.environmentErr = err
+
+	state.ignored = map[string]bool{}
+	for _, field := range unsavedFields {
+		if variable, found := environment[field]; found {
+			state.ignored[variable.Name] = true
+			delete(environment, field)
+		}
+		delete(state.Values, field)
+	}
+
+	// Goes back to the steps whose passwords were lost with a restart
+	form := state.Form()
+	for _, step := range wizardSteps {
+		if !state.Completed[step.ID] {
+			continue
+		}
+		required := map[string]bool{}
+		for _, field := range step.RequiredFields(form) {
+			required[field] = true
+		}
+		for _, field := range step.Fields {
+			if secretFields[field] && state.Values[field] == "" && (required[field] || state.Changed[field]) {
+				state.Completed[step.ID] = false
+			}
+		}
+	}
+	return state
+}
+
+// Reads the saved wizard progress
+func readWizardState() *WizardState {
+	wizardStateLock.Lock()
+	defer wizardStateLock.Unlock()
+
+	state := newWizardState()
+	content, err := ioutil.ReadFile(wizardStatePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+
+		// Starts from the existing settings (if the platform is installed already)
+		existing, err := loadSettingsFile(SETTINGS_FILE)
+		if err != nil {
+			log.Println(err)
+		} else if existing != nil {
+			settingsToForm(existing, state.Values)
+		}
+		return state
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		log.Printf("Ignoring the corrupted wizard state %s: %v", wizardStatePath, err)
+		return newWizardState()
+	}
+
+	// The passwords aren't in the file, they come from memory or the existing settings
+	existing := map[string]string{}
+	if settings, err := loadSettingsFile(SETTINGS_FILE); err != nil {
+		log.Println(err)
+	} else if settings != nil {
+		settingsToForm(settings, existing)
+	}
+	for field := range secretFields {
+		if value, found := wizardSecrets[field]; found {
+			state.Values[field] = value
+		} else if existing[field] != "" && !state.Changed[field] {
+			state.Values[field] = existing[field]
+		}
+	}
+	return state
+}
+
+// Saves the wizard progress, only readable by the owner.
+func (state *WizardState) Save() error {
+	wizardStateLock.Lock()
+	defer wizardStateLock.Unlock()
+
+	// The passwords and the secrets from the environment never touch the disk
+	saved := *state
+	saved.Values = map[string]string{}
+	wizardSecrets = map[string]string{}
+	for key, value := range state.Values {
+		if variable, found := state.environment[key]; found && variable.Secret {
+			continue
+		}
+		if secretFields[key] {
+			wizardSecrets[key] = value
+			continue
+		}
+		saved.Values[key] = value
+	}
+
+	content, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Writes to a temporary file first, so a crash never leaves half a state behind
+	tmpPath := wizardStatePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, wizardStatePath)
+}
+
+// Removes the saved progress (once installed, or when starting over)
+func clearWizardState() {
+	wizardStateLock.Lock()
+	defer wizardStateLock.Unlock()
+
+	wizardSecrets = map[string]string{}
+	if err := os.Remove(wizardStatePath); err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+}
+
+// Sets a value entered in the wizard, remembering if it changed
+func (state *WizardState) setValue(field, value string) {
+	if state.Values[field] != value {
+		state.Changed[field] = true
+	}
+	state.Values[field] = value
+}
+
+// Returns the saved values as a form
+func (state *WizardState) Form() url.Values {
+	form := url.Values{}
+	for key, value := range state.Values {
+		form.Set(key, value)
+	}
+	return form
+}
+
+// Returns the fields the operator changed in the wizard, or the environment set
+// (the ones applied on top of the existing settings)
+func (state *WizardState) ChangedFields() map[string]bool {
+	changed := map[string]bool{}
+	for field, isChanged := range state.Changed {
+		changed[field] = isChanged
+	}
+	for field := range state.environment {
+		changed[field] = true
+	}
+	return changed
+}
+
+// Returns the secret fields set by the environment (they aren't saved)
+func (state *WizardState) EnvironmentSecrets() map[string]bool {
+	secrets := map[string]bool{}
+	for field, variable := range state.environment {
+		if variable.Secret {
+			secrets[field] = true
+		}
+	}
+	return secrets
+}
+
+// Returns the first step that isn't completed yet
+func (state *WizardState) CurrentStep() *WizardStep {
+	for i := range wizardSteps {
+		if !state.Completed[wizardSteps[i].ID] {
+			return &wizardSteps[i]
+		}
+	}
+	return &wizardSteps[len(wizardSteps)-1]
+}
+
+// Checks if every step before the install one is completed (and the environment applied)
+func (state *WizardState) ReadyToInstall() bool {
+	return state.environmentErr == nil && state.CurrentStep().ID == "install"
+}
+
+// Finds a step by its id (and its position)
+func findWizardStep(id string) (*WizardStep, int) {
+	for i := range wizardSteps {
+		if wizardSteps[i].ID == id {
+			return &wizardSteps[i], i
+		}
+	}
+	return nil, -1
+}
+
+// Returns the fields that can't be left empty (some depend on the database type)
+func (step *WizardStep) RequiredFields(form url.Values) []string {
+	dialect, err := databaseDialect(form.Get("db-type"))
+	if err != nil || len(step.DialectRequired[dialect]) == 0 {
+		return step.Required
+	}
+	return append(append([]string{}, step.Required...), step.DialectRequired[dialect]...)
+}
+
+// Validates the values submitted for a step
+func (step *WizardStep) Validate(form url.Values) ValidationErrors {
+	errors := validateFields(step.Fields, step.RequiredFields(form), form)
+
+	// settings.toml keeps a host and a port, the API can't use a unix socket
+	if dialect, _ := databaseDialect(form.Get("db-type")); step.ID == "database" && dialect != "sqlite3" && strings.HasPrefix(form.Get("db-host"), "/") {
+		errors["db-host"] = "settings.toml can't keep a unix socket, use the host and port of the database."
+	}
+
+	if step.ID == "environment" && checksFailed(runEnvironmentChecks(doctorOptionsFromForm(form, installerListen))) {
+		errors["environment"] = "Some of the checks failed, fix them before continuing."
+	}
+
+	return errors
+}
+
+// Redirects to the step the wizard is at
+func installHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := loadWizardState()
+
+	// Reconnects to the installation if it is still running
+	if state.JobID != "" {
+		if job := findInstallJob(state.JobID); job != nil && job.Status() == JOB_RUNNING {
+			http.Redirect(w, r, "/install/"+job.ID, http.StatusSeeOther)
+			return
+		}
+	}
+
+	// A database the installer already set up shows its history (until a step is completed)
+	if state.CurrentStep().ID == wizardSteps[0].ID {
+		if runs := cachedInstalledRuns(); lastFinishedRun(runs) != nil {
+			installedHandler(w, r, runs)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/step/"+state.CurrentStep().ID, http.StatusSeeOther)
+}
+
+// Shows (GET) or saves (POST) a step of the wizard
+func wizardStepHandler(w http.ResponseWriter, r *http.Request) {
+	step, index := findWizardStep(strings.TrimPrefix(r.URL.Path, "/step/"))
+	if step == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state := loadWizardState()
+
+	// Doesn't allow skipping steps
+	current := state.CurrentStep()
+	if _, currentIndex := findWizardStep(current.ID); index > currentIndex {
+		http.Redirect(w, r, "/step/"+current.ID, http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		if step.ID == "review" && r.URL.Query().Get("recheck") != "" {
+			resetDatabaseSchemaCheck()
+		}
+		renderWizardStep(w, state, step, nil)
+		return
+	}
+
+	r.ParseForm()
+
+	// Saves the step values (unchecked boxes aren't sent, so they are cleared)
+	for _, field := range step.Fields {
+		if _, found := state.environment[field]; found {
+			continue
+		}
+		value := strings.TrimSpace(r.Form.Get(field))
+		if secretFields[field] && value == "" && state.Values[field] != "" {
+			continue
+		}
+		state.setValue(field, value)
+	}
+
+	// A database URL fills the database fields (and isn't kept, the fields are)
+	if databaseURL := state.Values["db-url"]; databaseURL != "" {
+		fields, err := parseDatabaseURL(databaseURL)
+		if err != nil {
+			state.Completed[step.ID] = false
+			renderWizardStep(w, state, step, ValidationErrors{"db-url": fmt.Sprintf("Can't read the URL: %v", err)})
+			return
+		}
+		var unsaved []string
+		for _, field := range unsavedFields {
+			if fields[field] != "" {
+				unsaved = append(unsaved, field)
+			}
+		}
+		if len(unsaved) > 0 {
+			state.Completed[step.ID] = false
+			renderWizardStep(w, state, step, ValidationErrors{"db-url": fmt.Sprintf("settings.toml can't keep the TLS options nor the driver parameters of the URL (%s), remove them.", strings.Join(unsaved, ", "))})
+			return
+		}
+		for field, value := range fields {
+			if _, found := state.environment[field]; !found {
+				state.setValue(field, value)
+			}
+		}
+		delete(state.Values, "db-url")
+	}
+
+	if errors := step.Validate(state.Form()); len(errors) > 0 {
+		state.Completed[step.ID] = false
+		renderWizardStep(w, state, step, errors)
+		return
+	}
+
+	state.Completed[step.ID] = true
+	if err := state.Save(); err != nil {
+		log.Println(err)
+		renderWizardStep(w, state, step, ValidationErrors{"state": "Can't save the progress: " + err.Error()})
+		return
+	}
+
+	http.Redirect(w, r, "/step/"+state.CurrentStep().ID, http.StatusSeeOther)
+}
+
+// Forgets the saved progress and starts the wizard again
+func wizardResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clearWizardState()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Renders a step of the wizard
+func renderWizardStep(w http.ResponseWriter, state *WizardState, step *WizardStep, errors ValidationErrors) {
+	headerObj := Header{
+		Title:       "Kumquat Academy - Installer",
+		Description: "Install Asistant for the Kumquat Academy - Learning Platform",
+		Author:      "Yago Carballo",
+	}
+
+	// Hides the secrets (the ones set by the environment too)
+	values := map[string]string{}
+	for key, value := range state.Values {
+		values[key] = value
+	}
+	environment := []string{}
+	locked := map[string]bool{}
+	stored := map[string]bool{}
+	for _, field := range step.Fields {
+		if secretFields[field] {
+			stored[field] = values[field] != ""
+			values[field] = ""
+		}
+		if variable, found := state.environment[field]; found {
+			locked[field] = true
+			environment = append(environment, variable.Name)
+			if variable.Secret {
+				values[field] = ""
+			}
+		}
+	}
+
+	_, index := findWizardStep(step.ID)
+	passedObj := WizardPage{
+		Header:        &headerObj,
+		Intro:         step.Intro,
+		Step:          step,
+		Action:        "/step/" + step.ID,
+		SubmitLabel:   "Continue",
+		Values:        values,
+		Environment:   environment,
+		Locked:        locked,
+		Stored:        stored,
+		FieldErrors:   errors,
+		DatabaseTypes: databaseTypes,
+	}
+
+	// The variables of the process only change with a restart
+	if state.environmentErr != nil {
+		passedObj.Errors = append(passedObj.Errors, fmt.Sprintf("The KUMQUAT_* variables can't be applied, fix them and restart the installer: %v", state.environmentErr))
+	}
+
+	// The field errors are shown next to each field, the rest on top
+	isField := map[string]bool{}
+	for _, field := range step.Fields {
+		isField[field] = true
+	}
+	invalidFields := 0
+	for key, message := range errors {
+		if isField[key] {
+			invalidFields++
+		} else {
+			passedObj.Errors = append(passedObj.Errors, message)
+		}
+	}
+	if invalidFields == 1 {
+		passedObj.Errors = append(passedObj.Errors, "One of the fields is not valid, check the message below it.")
+	} else if invalidFields > 1 {
+		passedObj.Errors = append(passedObj.Errors, fmt.Sprintf("%d fields are not valid, check the messages below them.", invalidFields))
+	}
+
+	// The variables settings.toml can't keep are only used by the other commands
+	if step.ID == "database" {
+		ignored := []string{}
+		for name := range state.ignored {
+			ignored = append(ignored, name)
+		}
+		sort.Strings(ignored)
+		for _, name := range ignored {
+			passedObj.Errors = append(passedObj.Errors, fmt.Sprintf("%s is ignored here, settings.toml can't keep what it sets (the other commands still use it).", name))
+		}
+	}
+
+	if index > 0 {
+		passedObj.Previous = &wizardSteps[index-1]
+	}
+
+	for _, wizardStep := range wizardSteps {
+		passedObj.Steps = append(passedObj.Steps, WizardStepLink{
+			ID:      wizardStep.ID,
+			Title:   wizardStep.Title,
+			Done:    state.Completed[wizardStep.ID],
+			Current: wizardStep.ID == step.ID,
+		})
+	}
+
+	switch step.ID {
+	case "environment":
+		passedObj.Checks = runEnvironmentChecks(doctorOptionsFromForm(state.Form(), installerListen))
+	case "review":
+		for _, item := range reviewLabels {
+			value := state.Values[item.Label]
+			if strings.Contains(item.Label, "password") && value != "" {
+				value = "********"
+			}
+			passedObj.Review = append(passedObj.Review, ReviewItem{Label: item.Value, Value: value})
+		}
+
+		// Shows what is going to change in the settings file
+		existing, err := loadSettingsFile(SETTINGS_FILE)
+		if err != nil {
+			passedObj.Errors = append(passedObj.Errors, err.Error())
+		}
+		wizardSettings, _, _ := parseSettings(state.Form())
+		passedObj.NewSettings = existing == nil
+		passedObj.Changes = diffSettings(existing, settingsToSave(existing, wizardSettings, state.ChangedFields(), state.EnvironmentSecrets()))
+
+		// Shows how the database differs from the schema the installation creates
+		// (checked again when the database fields change, or on demand)
+		schemaCheck, differences := cachedDatabaseSchemaCheck(state.Form())
+		passedObj.Checks = []EnvironmentCheck{schemaCheck}
+		passedObj.SchemaDiff = formatSchemaDiff(differences)
+	case "install":
+		passedObj.Action = "/do-install"
+		passedObj.SubmitLabel = "Start Installation"
+	}
+
+	templates.ExecuteTemplate(w, "header", headerObj)
+	templates.ExecuteTemplate(w, "wizardStart", passedObj)
+	if err := templates.ExecuteTemplate(w, "step-"+step.ID, passedObj); err != nil {
+		log.Println(err)
+	}
+	templates.ExecuteTemplate(w, "wizardEnd", passedObj)
+}